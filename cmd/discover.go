@@ -16,12 +16,15 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/muka/camd/device"
 	"github.com/muka/camd/hook"
 	"github.com/muka/camd/onvif"
+	"github.com/muka/camd/registry"
 	"github.com/muka/camd/video"
 	"github.com/spf13/cobra"
 )
@@ -33,29 +36,38 @@ var discoverCmd = &cobra.Command{
 	Long:  `This command search for camera sources on the local network(s).`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		emitter := make(chan device.OnChangeEvent)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// the registry merges the sources and is the only producer of the hooks
+		devices := registry.New()
+		// persist the devices for the commands, eg. camd onvif info <name>
+		devices.Persist(onvif.LoadDeviceStore())
+		hooks := devices.Subscribe(ctx)
 
 		go func() {
-			for {
-				select {
-				case ev := <-emitter:
-					// case dev := <-emitter:
-					// log.Printf("Received device name=%s", dev.Device.Name)
-					err := hook.Request(ev)
-					if err != nil {
-						log.Printf("Error on request: %s", err)
-					}
+			for ev := range hooks {
+				err := hook.Request(ev)
+				if err != nil {
+					log.Printf("Error on request: %s", err)
 				}
 			}
 		}()
 
-		err := video.WatchDevices(emitter)
+		err := video.WatchDevices(devices.Input(ctx, registry.SourceVideo))
 		if err != nil {
 			log.Fatal(err)
 			os.Exit(1)
 		}
 
-		err = onvif.Discover(emitter)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sig
+			cancel()
+		}()
+
+		err = onvif.Discover(ctx, devices.Input(ctx, registry.SourceONVIF))
 		if err != nil {
 			log.Fatal(err)
 			os.Exit(1)
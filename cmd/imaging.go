@@ -0,0 +1,183 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/muka/camd/onvif"
+	"github.com/spf13/cobra"
+)
+
+// imagingCmd represents the imaging command
+var imagingCmd = &cobra.Command{
+	Use:   "imaging <device> [action] [args]",
+	Short: "Read and adjust the image settings of an ONVIF camera",
+	Long: `This command read and adjust the image settings of an ONVIF camera, found
+by UUID, name, address or device service URL.
+
+Actions:
+  get                       print the image settings (default)
+  options                   print the allowed image settings
+  set <key=value>...        change the image settings
+  focus <position>          move the focus to a position
+  focus-relative <distance> move the focus by a distance
+  focus-continuous <speed>  move the focus until focus-stop
+  focus-stop                stop moving the focus
+  focus-status              print the focus position and move status
+
+Settings keys: ` + strings.Join(onvif.ImagingSettingKeys, ", "),
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		source, _ := cmd.Flags().GetString("source")
+		persist, _ := cmd.Flags().GetBool("persist")
+
+		var speed *float64
+		if cmd.Flags().Changed("speed") {
+			s, _ := cmd.Flags().GetFloat64("speed")
+			speed = &s
+		}
+
+		ctx := context.Background()
+
+		_, client, err := onvif.Lookup(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		imaging, err := onvif.NewImaging(ctx, client, source)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		action := "get"
+		if len(args) > 1 {
+			action = args[1]
+		}
+
+		var values []string
+		if len(args) > 2 {
+			values = args[2:]
+		}
+
+		err = runImaging(ctx, imaging, action, values, speed, persist)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// runImaging perform an imaging command action
+func runImaging(ctx context.Context, imaging *onvif.Imaging, action string, values []string, speed *float64, persist bool) error {
+
+	value := func() (float64, error) {
+		if len(values) == 0 {
+			return 0, fmt.Errorf("Missing %s value", action)
+		}
+		return strconv.ParseFloat(values[0], 64)
+	}
+
+	switch action {
+	case "get":
+		settings, err := imaging.Settings(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(settings)
+	case "options":
+		options, err := imaging.Options(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(options)
+	case "set":
+		changes := map[string]string{}
+		for _, pair := range values {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("Invalid setting %s, expected key=value", pair)
+			}
+			changes[kv[0]] = kv[1]
+		}
+		if len(changes) == 0 {
+			return fmt.Errorf("Missing settings")
+		}
+		current, err := imaging.Settings(ctx)
+		if err != nil {
+			return err
+		}
+		update, err := onvif.UpdateImagingSettings(current, changes)
+		if err != nil {
+			return err
+		}
+		return imaging.SetSettings(ctx, update, persist)
+	case "focus":
+		position, err := value()
+		if err != nil {
+			return err
+		}
+		return imaging.Focus(ctx, onvif.FocusMove{Absolute: &onvif.AbsoluteFocus{Position: position, Speed: speed}})
+	case "focus-relative":
+		distance, err := value()
+		if err != nil {
+			return err
+		}
+		return imaging.Focus(ctx, onvif.FocusMove{Relative: &onvif.RelativeFocus{Distance: distance, Speed: speed}})
+	case "focus-continuous":
+		s, err := value()
+		if err != nil {
+			return err
+		}
+		return imaging.Focus(ctx, onvif.FocusMove{Continuous: &onvif.ContinuousFocus{Speed: s}})
+	case "focus-stop":
+		return imaging.StopFocus(ctx)
+	case "focus-status":
+		status, err := imaging.FocusStatus(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(status)
+	}
+	return fmt.Errorf("Unknown action %s", action)
+}
+
+// printJSON print a value as indented JSON
+func printJSON(value interface{}) error {
+	b, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(imagingCmd)
+
+	imagingCmd.Flags().StringP("source", "s", "", "Video source token (the primary profile source if empty)")
+	imagingCmd.Flags().Bool("persist", false, "Keep the settings after a reboot")
+	imagingCmd.Flags().Float64("speed", 0, "Focus speed (device default if not set)")
+}
@@ -0,0 +1,564 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif"
+	"github.com/spf13/cobra"
+)
+
+// onvifCmd represents the onvif command
+var onvifCmd = &cobra.Command{
+	Use:   "onvif",
+	Short: "Manage ONVIF devices",
+	Long: `The onvif commands manage one or more ONVIF devices, selected by UUID,
+name, address, device service URL, a glob pattern (eg. "Parking*") or "all".
+
+The selected devices are processed concurrently, reporting the result of each one.`,
+}
+
+// deviceOperation an operation run by an onvif subcommand on each selected device
+type deviceOperation func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error)
+
+// runOnDevices run an operation on the devices matching the selector,
+// printing the results and exiting with an error if any failed
+func runOnDevices(cmd *cobra.Command, selector string, op deviceOperation) {
+	runOnDeviceList(cmd, lookupDevices(selector), op)
+}
+
+// runOnDeviceList run an operation on devices already looked up, eg. the
+// ones confirmed by confirmDevices, as runOnDevices
+func runOnDeviceList(cmd *cobra.Command, devices []device.Device, op deviceOperation) {
+
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	results, err := onvif.RunOnDevices(context.Background(), devices, concurrency, timeout, op)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+
+	if !printResults(results) {
+		os.Exit(1)
+	}
+}
+
+// printResults print the result of each device, returning false if any failed
+func printResults(results []onvif.Result) bool {
+	ok := true
+	for _, result := range results {
+		name := result.Device.Name
+		if name == "" {
+			name = result.Device.UUID
+		}
+		if result.Err != nil {
+			ok = false
+			fmt.Printf("FAIL\t%s\t%s\n", name, strings.ReplaceAll(result.Err.Error(), "\n", "\n\t\t"))
+			continue
+		}
+		fmt.Printf("OK\t%s\t%s\n", name, strings.ReplaceAll(strings.TrimSpace(result.Message), "\n", "\n\t\t"))
+	}
+	return ok
+}
+
+var setNTPCmd = &cobra.Command{
+	Use:   "set-ntp <selector> [server]...",
+	Short: "Set the NTP servers, by IP address or DNS name",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dhcp, _ := cmd.Flags().GetBool("dhcp")
+		servers := args[1:]
+		if len(servers) == 0 && !dhcp {
+			log.Fatal("Missing NTP servers, or --dhcp")
+		}
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			if dhcp {
+				return "NTP from DHCP", onvif.SetNTPServers(ctx, client, nil, true)
+			}
+			return "NTP " + strings.Join(servers, ", "), onvif.SetNTPServers(ctx, client, servers, false)
+		})
+	},
+}
+
+var syncTimeCmd = &cobra.Command{
+	Use:   "sync-time <selector>",
+	Short: "Set the device clock to the local time, or switch it to NTP",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ntp, _ := cmd.Flags().GetBool("ntp")
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			skew := client.ClockOffset()
+			if err := onvif.SyncTime(ctx, client, ntp); err != nil {
+				return "", err
+			}
+			if ntp {
+				return fmt.Sprintf("Clock set to NTP (skew was %s)", skew), nil
+			}
+			return fmt.Sprintf("Clock synchronized (skew was %s)", skew), nil
+		})
+	},
+}
+
+var setHostnameCmd = &cobra.Command{
+	Use:   "set-hostname <selector> <hostname>",
+	Short: "Set the hostname",
+	Long: `Set the hostname of the selected devices. The hostname can contain {name},
+{serial}, {model} and {mac}, replaced with the values of each device (eg.
+cam-{serial}), and is required to do so if the selector matches many devices.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		template := args[1]
+		devices := lookupDevices(args[0])
+		if !strings.Contains(template, "{") && len(devices) > 1 {
+			log.Fatalf("%d devices match %s, use a template such as cam-{serial}", len(devices), args[0])
+		}
+		runOnDeviceList(cmd, devices, func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			hostname, err := onvif.ExpandHostname(ctx, client, dev, template)
+			if err != nil {
+				return "", err
+			}
+			return "Hostname " + hostname, onvif.SetDeviceHostname(ctx, client, hostname)
+		})
+	},
+}
+
+var rebootCmd = &cobra.Command{
+	Use:   "reboot <selector>",
+	Short: "Reboot the devices",
+	Long: `Reboot the selected devices. If the selector matches more than one device,
+--yes is required to confirm.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		devices := confirmDevices(cmd, args[0])
+		runOnDeviceList(cmd, devices, func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			return onvif.Reboot(ctx, client)
+		})
+	},
+}
+
+// lookupDevices return the devices matching the selector, exiting on error
+func lookupDevices(selector string) []device.Device {
+	devices, err := onvif.LookupAll(context.Background(), selector)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return devices
+}
+
+// confirmDevices return the devices matching the selector, exiting listing
+// them if there are more than one, unless confirmed by --yes. The operation
+// must run on the returned devices, not on a new lookup.
+func confirmDevices(cmd *cobra.Command, selector string) []device.Device {
+	devices := lookupDevices(selector)
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return devices
+	}
+	if len(devices) > 1 {
+		for _, dev := range devices {
+			fmt.Printf("%s\t%s\n", dev.Name, dev.Address)
+		}
+		log.Fatalf("%d devices match %s, confirm with --yes", len(devices), selector)
+	}
+	return devices
+}
+
+var ioCmd = &cobra.Command{
+	Use:   "io <selector>",
+	Short: "List the relay outputs and digital inputs",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			relays, err := onvif.RelayOutputs(ctx, client)
+			if err != nil {
+				return "", err
+			}
+			lines := []string{}
+			for _, relay := range relays {
+				line := fmt.Sprintf("relay %s: %s, idle %s", relay.Token, relay.Mode, relay.IdleState)
+				if relay.DelayTime > 0 {
+					line += fmt.Sprintf(", delay %s", relay.DelayTime)
+				}
+				lines = append(lines, line)
+			}
+			if client.HasService(ctx, "deviceio") {
+				inputs, err := onvif.DigitalInputs(ctx, client)
+				if err != nil {
+					return "", err
+				}
+				for _, input := range inputs {
+					lines = append(lines, fmt.Sprintf("input %s: idle %s", input.Token, input.IdleState))
+				}
+			}
+			if len(lines) == 0 {
+				return "No relay outputs or digital inputs", nil
+			}
+			return strings.Join(lines, "\n"), nil
+		})
+	},
+}
+
+var relayCmd = &cobra.Command{
+	Use:   "relay <selector> <relay> [active|inactive]",
+	Short: "Trigger a relay output",
+	Long: `Set the state of a relay output of the selected devices, active by default.
+With --pulse, the relay is activated for the given duration then deactivated,
+eg. to open a door strike. A Monostable relay goes back to inactive by itself
+after its delay time. If the selector matches more than one device, --yes is
+required to confirm.`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		pulse, _ := cmd.Flags().GetDuration("pulse")
+		active := true
+		if len(args) > 2 {
+			switch args[2] {
+			case onvif.RelayActive, "on":
+			case onvif.RelayInactive, "off":
+				active = false
+			default:
+				log.Fatalf("Invalid relay state %s, expected active or inactive", args[2])
+			}
+		}
+		if pulse > 0 && !active {
+			log.Fatal("--pulse requires the active state")
+		}
+		if timeout, _ := cmd.Flags().GetDuration("timeout"); pulse > 0 && timeout > 0 && pulse >= timeout {
+			log.Fatalf("--pulse %s must be shorter than --timeout %s", pulse, timeout)
+		}
+		devices := confirmDevices(cmd, args[0])
+		token := args[1]
+		runOnDeviceList(cmd, devices, func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			if pulse > 0 {
+				return fmt.Sprintf("Relay %s pulsed for %s", token, pulse), onvif.PulseRelay(ctx, client, token, pulse)
+			}
+			state := onvif.RelayInactive
+			if active {
+				state = onvif.RelayActive
+			}
+			return fmt.Sprintf("Relay %s %s", token, state), onvif.SetRelay(ctx, client, token, active)
+		})
+	},
+}
+
+var getSystemLogCmd = &cobra.Command{
+	Use:   "get-system-log <selector>",
+	Short: "Print the system log, or the access log with --access",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logType := onvif.LogSystem
+		if access, _ := cmd.Flags().GetBool("access"); access {
+			logType = onvif.LogAccess
+		}
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			return onvif.SystemLog(ctx, client, logType)
+		})
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <selector>",
+	Short: "Save the devices configuration",
+	Long: `Save the profiles, video and audio encoders, imaging, network and NTP
+configuration of the selected devices, one file per device named after its name
+and serial number.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "json" && format != "yaml" {
+			log.Fatalf("Invalid format %s, expected json or yaml", format)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatal(err)
+		}
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			backup, err := onvif.CreateBackup(ctx, client, dev)
+			if err != nil {
+				return "", err
+			}
+			path := filepath.Join(dir, onvif.BackupFilename(backup, format))
+			return path, onvif.WriteBackup(backup, path)
+		})
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file> [selector]",
+	Short: "Apply a saved configuration",
+	Long: `Apply a backup to the device it was taken from, or to the selected device
+of the same model (eg. a replaced camera). Only the changed configurations are
+applied, --dry-run prints them without applying. The network interfaces are not
+restored, nor the video sources of the profiles, printed as not restored.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+
+		backup, err := onvif.ReadBackup(args[0])
+		if err != nil {
+			log.Fatalf("Failed to read %s: %s", args[0], err)
+		}
+
+		selector := backup.Device.UUID
+		if len(args) > 1 {
+			selector = args[1]
+		}
+		devices := lookupDevices(selector)
+		if len(devices) > 1 {
+			log.Fatalf("%d devices match %s, restore one device at a time", len(devices), selector)
+		}
+
+		runOnDeviceList(cmd, devices, func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			changes, err := onvif.RestoreBackup(ctx, client, dev, backup, onvif.RestoreOptions{DryRun: dryRun, Force: force})
+			supported := 0
+			for _, change := range changes {
+				if !change.Unsupported {
+					supported++
+				}
+			}
+			lines := []string{}
+			switch {
+			case dryRun:
+				lines = append(lines, fmt.Sprintf("%d changes to apply", supported))
+			default:
+				lines = append(lines, fmt.Sprintf("%d changes applied", supported))
+			}
+			for _, change := range changes {
+				lines = append(lines, change.String())
+			}
+			if err != nil && len(changes) > 0 {
+				log.Printf("Partially restored %s:\n%s", dev.Name, strings.Join(lines, "\n"))
+			}
+			return strings.Join(lines, "\n"), err
+		})
+	},
+}
+
+var encodersCmd = &cobra.Command{
+	Use:   "encoders <selector>",
+	Short: "Check or apply the video encoder policies",
+	Long: `Check the selected devices against the video encoder policies of
+onvif.encoders, or the one set by the flags, reporting the changes to apply and
+the settings the devices cannot satisfy. --apply applies the changes, as done
+when a device is discovered. --options prints the allowed settings.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apply, _ := cmd.Flags().GetBool("apply")
+		options, _ := cmd.Flags().GetBool("options")
+
+		policies, err := encoderPolicies(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(policies) == 0 && !options {
+			log.Fatal("No encoder policies, set onvif.encoders or the policy flags")
+		}
+
+		runOnDevices(cmd, args[0], func(ctx context.Context, dev device.Device, client *onvif.Client) (string, error) {
+			if options {
+				return encoderOptions(ctx, client)
+			}
+			reports, err := onvif.ApplyEncoderPolicies(ctx, client, dev, policies, !apply)
+			if err != nil {
+				return "", err
+			}
+			if len(reports) == 0 {
+				return "No matching policy", nil
+			}
+			lines := []string{}
+			violations := 0
+			for _, report := range reports {
+				status := "compliant"
+				if len(report.Violations) > 0 {
+					status = "not compliant"
+				}
+				if len(report.Changes) > 0 {
+					status = fmt.Sprintf("%d changes to apply", len(report.Changes))
+					if apply {
+						status = fmt.Sprintf("%d changes applied", len(report.Changes))
+					}
+				}
+				lines = append(lines, fmt.Sprintf("%s (%s): %s", report.Profile, report.Encoder, status))
+				for _, change := range report.Changes {
+					lines = append(lines, "  "+change.String())
+				}
+				for _, violation := range report.Violations {
+					lines = append(lines, "  not satisfied: "+violation)
+				}
+				violations += len(report.Violations)
+			}
+			if violations > 0 {
+				return "", errors.New(strings.Join(lines, "\n"))
+			}
+			return strings.Join(lines, "\n"), nil
+		})
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin <selector>",
+	Short: "Forget the pinned certificates",
+	Long: `Remove the certificate fingerprints pinned for the selected devices, so that
+the next certificate they present is trusted, eg. after a factory reset.
+
+The pins are stored in onvif.tls.pins, by default pins.json next to
+onvif.store, or in the user configuration directory (eg. ~/.config/camd).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		trust, err := onvif.LoadTrust()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		devices, err := onvif.LookupAll(context.Background(), args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(devices) == 0 {
+			log.Fatalf("No devices match %s", args[0])
+		}
+
+		results := []onvif.Result{}
+		for _, dev := range devices {
+			result := onvif.Result{Device: dev, Message: "Not pinned"}
+			removed, err := trust.Pins().Delete(onvif.PinKey(dev))
+			if err != nil {
+				result.Err = err
+			} else if removed {
+				result.Message = "Unpinned"
+			}
+			results = append(results, result)
+		}
+
+		if !printResults(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+// encoderPolicies return the policy set by the flags, or the configured ones
+func encoderPolicies(cmd *cobra.Command) ([]onvif.EncoderPolicy, error) {
+
+	policy := onvif.EncoderPolicy{}
+	policy.Profile, _ = cmd.Flags().GetString("profile")
+	policy.Encoding, _ = cmd.Flags().GetString("encoding")
+	policy.Resolution, _ = cmd.Flags().GetString("resolution")
+	policy.FrameRate, _ = cmd.Flags().GetInt("fps")
+	policy.Bitrate, _ = cmd.Flags().GetInt("bitrate")
+	policy.GovLength, _ = cmd.Flags().GetInt("gop")
+	policy.Quality, _ = cmd.Flags().GetFloat64("quality")
+
+	if policy.Encoding == "" && policy.Resolution == "" && policy.FrameRate == 0 &&
+		policy.Bitrate == 0 && policy.GovLength == 0 && policy.Quality == 0 {
+		return onvif.LoadEncoderPolicies()
+	}
+
+	policy.Encoding = strings.ToUpper(policy.Encoding)
+	return []onvif.EncoderPolicy{policy}, policy.Validate()
+}
+
+// encoderOptions describe the allowed settings of the video encoders
+func encoderOptions(ctx context.Context, client *onvif.Client) (string, error) {
+
+	encoders, err := onvif.GetVideoEncoders(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, encoder := range encoders {
+		options, err := onvif.GetVideoEncoderOptions(ctx, client, encoder.Token, "")
+		if err != nil {
+			return "", err
+		}
+		for _, o := range options {
+			resolutions := []string{}
+			for _, r := range o.Resolutions {
+				resolutions = append(resolutions, r.String())
+			}
+			line := fmt.Sprintf("%s %s: %s fps %d-%d quality %d-%d", encoder.Token, o.Encoding,
+				strings.Join(resolutions, ","), o.FrameRate.Min, o.FrameRate.Max, o.Quality.Min, o.Quality.Max)
+			if o.Bitrate != nil {
+				line += fmt.Sprintf(" bitrate %d-%d", o.Bitrate.Min, o.Bitrate.Max)
+			}
+			if o.GovLength != nil {
+				line += fmt.Sprintf(" gop %d-%d", o.GovLength.Min, o.GovLength.Max)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func init() {
+	rootCmd.AddCommand(onvifCmd)
+
+	onvifCmd.PersistentFlags().IntP("concurrency", "c", 4, "Devices processed at the same time")
+	onvifCmd.PersistentFlags().Duration("timeout", 30*time.Second, "Timeout for each device")
+
+	onvifCmd.AddCommand(setNTPCmd)
+	setNTPCmd.Flags().Bool("dhcp", false, "Use the NTP servers provided by DHCP")
+
+	onvifCmd.AddCommand(syncTimeCmd)
+	syncTimeCmd.Flags().Bool("ntp", false, "Switch the clock to NTP instead of setting it")
+
+	onvifCmd.AddCommand(setHostnameCmd)
+
+	onvifCmd.AddCommand(rebootCmd)
+	rebootCmd.Flags().Bool("yes", false, "Confirm rebooting many devices")
+
+	onvifCmd.AddCommand(ioCmd)
+
+	onvifCmd.AddCommand(relayCmd)
+	relayCmd.Flags().Duration("pulse", 0, "Activate the relay for this duration, within --timeout")
+	relayCmd.Flags().Bool("yes", false, "Confirm triggering the relay of many devices")
+
+	onvifCmd.AddCommand(getSystemLogCmd)
+	getSystemLogCmd.Flags().Bool("access", false, "Print the access log")
+
+	onvifCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringP("dir", "d", ".", "Directory of the backup files")
+	backupCmd.Flags().String("format", "json", "Backup format, json or yaml")
+
+	onvifCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+	restoreCmd.Flags().Bool("force", false, "Restore to another model, skipping the missing configurations")
+
+	onvifCmd.AddCommand(unpinCmd)
+
+	onvifCmd.AddCommand(encodersCmd)
+	encodersCmd.Flags().Bool("apply", false, "Apply the changes")
+	encodersCmd.Flags().Bool("options", false, "Print the allowed encoder settings")
+	encodersCmd.Flags().String("profile", "", "Profile to configure, by token or name, highest, lowest or all")
+	encodersCmd.Flags().String("encoding", "", "Encoding, eg. H264")
+	encodersCmd.Flags().String("resolution", "", "Resolution, eg. 1920x1080")
+	encodersCmd.Flags().Int("fps", 0, "Frame rate limit")
+	encodersCmd.Flags().Int("bitrate", 0, "Bitrate limit, in kbps")
+	encodersCmd.Flags().Int("gop", 0, "H264 GOP length")
+	encodersCmd.Flags().Float64("quality", 0, "Encoding quality")
+}
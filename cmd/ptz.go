@@ -0,0 +1,149 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/muka/camd/onvif"
+	"github.com/spf13/cobra"
+)
+
+// ptzCmd represents the ptz command
+var ptzCmd = &cobra.Command{
+	Use:   "ptz <device> <action> [preset]",
+	Short: "Control the pan, tilt and zoom of an ONVIF camera",
+	Long: `This command control the pan, tilt and zoom of an ONVIF camera, found by
+UUID, name, address or device service URL.
+
+Actions:
+  status              print the position and move status
+  move                move continuously at --pan, --tilt and --zoom velocity
+  absolute            move to the --pan, --tilt and --zoom position
+  relative            move by the --pan, --tilt and --zoom translation
+  stop                stop moving
+  presets             list the presets
+  goto <preset>       move to a preset, by token or name
+  set-preset <name>   store the current position as a preset
+  home                move to the home position`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		profile, _ := cmd.Flags().GetString("profile")
+		pan, _ := cmd.Flags().GetFloat64("pan")
+		tilt, _ := cmd.Flags().GetFloat64("tilt")
+		zoom, _ := cmd.Flags().GetFloat64("zoom")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		var speed *onvif.PTZPosition
+		if cmd.Flags().Changed("speed") {
+			s, _ := cmd.Flags().GetFloat64("speed")
+			speed = &onvif.PTZPosition{Pan: s, Tilt: s, Zoom: s}
+		}
+
+		ctx := context.Background()
+
+		_, client, err := onvif.Lookup(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		ptz, err := onvif.NewPTZ(ctx, client, profile)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		value := ""
+		if len(args) > 2 {
+			value = args[2]
+		}
+
+		position := onvif.PTZPosition{Pan: pan, Tilt: tilt, Zoom: zoom}
+
+		err = runPTZ(ctx, ptz, args[1], value, position, speed, timeout)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// runPTZ perform a ptz command action
+func runPTZ(ctx context.Context, ptz *onvif.PTZ, action string, value string, position onvif.PTZPosition, speed *onvif.PTZPosition, timeout time.Duration) error {
+	switch action {
+	case "status":
+		status, err := ptz.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("pan=%.3f tilt=%.3f zoom=%.3f pantilt=%s zoom=%s\n",
+			status.Position.Pan, status.Position.Tilt, status.Position.Zoom, status.PanTilt, status.Zoom)
+		return nil
+	case "move":
+		return ptz.ContinuousMove(ctx, position, timeout)
+	case "absolute":
+		return ptz.AbsoluteMove(ctx, position, speed)
+	case "relative":
+		return ptz.RelativeMove(ctx, position, speed)
+	case "stop":
+		return ptz.Stop(ctx)
+	case "presets":
+		presets, err := ptz.Presets(ctx)
+		if err != nil {
+			return err
+		}
+		for _, preset := range presets {
+			fmt.Printf("%s\t%s\n", preset.Token, preset.Name)
+		}
+		return nil
+	case "goto":
+		preset, err := ptz.FindPreset(ctx, value)
+		if err != nil {
+			return err
+		}
+		return ptz.GotoPreset(ctx, preset.Token, speed)
+	case "set-preset":
+		if value == "" {
+			return fmt.Errorf("Missing preset name")
+		}
+		token, err := ptz.SetPreset(ctx, value, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Preset %s saved with token %s\n", value, token)
+		return nil
+	case "home":
+		return ptz.GotoHomePosition(ctx, speed)
+	}
+	return fmt.Errorf("Unknown action %s", action)
+}
+
+func init() {
+	rootCmd.AddCommand(ptzCmd)
+
+	ptzCmd.Flags().StringP("profile", "p", "", "Media profile token (the primary profile if empty)")
+	ptzCmd.Flags().Float64("pan", 0, "Pan position, translation or velocity (-1 to 1)")
+	ptzCmd.Flags().Float64("tilt", 0, "Tilt position, translation or velocity (-1 to 1)")
+	ptzCmd.Flags().Float64("zoom", 0, "Zoom position, translation or velocity (0 to 1)")
+	ptzCmd.Flags().Float64("speed", 0, "Movement speed (device default if not set)")
+	ptzCmd.Flags().Duration("timeout", 0, "Stop a continuous move after timeout")
+}
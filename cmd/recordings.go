@@ -0,0 +1,143 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif"
+	"github.com/spf13/cobra"
+)
+
+// recordingsCmd represents the recordings command
+var recordingsCmd = &cobra.Command{
+	Use:   "recordings <device>",
+	Short: "List the recordings of an ONVIF camera or NVR",
+	Long: `This command list the recordings stored by an ONVIF device (Profile G),
+eg. on a camera SD card or an NVR, with their time range and replay RTSP URI.
+The device is found by UUID, name, address or device service URL.
+
+The replay URI plays the recording from the time set by the Range header of
+the RTSP PLAY request (eg. Range: clock=20201020T100000Z-).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		from, err := parseTimeFlag(cmd, "from")
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+		to, err := parseTimeFlag(cmd, "to")
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		dev, client, err := onvif.Lookup(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		recordings, err := onvif.SearchRecordings(ctx, client)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+		recordings = filterRecordings(recordings, from, to)
+
+		if asJSON {
+			err = printJSON(recordings)
+			if err != nil {
+				log.Fatal(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		name := dev.Name
+		if name == "" {
+			name = args[0]
+		}
+		fmt.Printf("%s: %d recordings\n", name, len(recordings))
+		for _, recording := range recordings {
+			fmt.Printf("%s\t%s - %s\t%s\t%s\n",
+				recording.Token,
+				formatTime(recording.Start),
+				formatTime(recording.End),
+				recording.Status,
+				recording.SourceName,
+			)
+			if recording.ReplayURI != "" {
+				fmt.Printf("  %s\n", recording.ReplayURI)
+			}
+		}
+	},
+}
+
+// parseTimeFlag parse an RFC3339 time flag, zero if not set
+func parseTimeFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid --%s time %s, expected eg. 2020-10-20T10:00:00Z", name, value)
+	}
+	return t, nil
+}
+
+// filterRecordings keep the recordings overlapping the from-to range, open if zero
+func filterRecordings(recordings []device.Recording, from, to time.Time) []device.Recording {
+	filtered := []device.Recording{}
+	for _, recording := range recordings {
+		if !from.IsZero() && !recording.End.IsZero() && recording.End.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !recording.Start.IsZero() && recording.Start.After(to) {
+			continue
+		}
+		filtered = append(filtered, recording)
+	}
+	return filtered
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "?"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func init() {
+	rootCmd.AddCommand(recordingsCmd)
+
+	recordingsCmd.Flags().String("from", "", "List the recordings ending after this time (RFC3339)")
+	recordingsCmd.Flags().String("to", "", "List the recordings starting before this time (RFC3339)")
+	recordingsCmd.Flags().Bool("json", false, "Print the recordings as JSON")
+	recordingsCmd.Flags().Duration("timeout", 30*time.Second, "Search timeout")
+}
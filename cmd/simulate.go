@@ -0,0 +1,98 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/spf13/cobra"
+)
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate ONVIF cameras",
+	Long: `This command runs one or more simulated ONVIF NetworkVideoTransmitters,
+answering WS-Discovery probes and the device and media SOAP services.
+
+A script file (YAML or JSON) can list the cameras to start and the steps
+to play, such as cameras appearing, vanishing or changing address.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		count, _ := cmd.Flags().GetInt("count")
+		port, _ := cmd.Flags().GetInt("port")
+		scriptPath, _ := cmd.Flags().GetString("script")
+		useTLS, _ := cmd.Flags().GetBool("tls")
+
+		script := simulator.Script{}
+		if scriptPath != "" {
+			var err error
+			script, err = simulator.LoadScript(scriptPath)
+			if err != nil {
+				log.Fatal(err)
+				os.Exit(1)
+			}
+		} else {
+			for i := 0; i < count; i++ {
+				address := "127.0.0.1:0"
+				if port > 0 {
+					address = fmt.Sprintf("127.0.0.1:%d", port+i)
+				}
+				script.Cameras = append(script.Cameras, simulator.Config{
+					Name:    fmt.Sprintf("Simulated Camera %d", i+1),
+					Address: address,
+					TLS:     useTLS,
+				})
+			}
+		}
+
+		sim := simulator.NewSimulator()
+		err := sim.Start()
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		stop := make(chan struct{})
+		go func() {
+			err := sim.Run(script, stop)
+			if err != nil {
+				log.Printf("Simulation failed: %s", err)
+			}
+		}()
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+
+		close(stop)
+		sim.Stop()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	simulateCmd.Flags().IntP("count", "n", 1, "Number of cameras to simulate")
+	simulateCmd.Flags().IntP("port", "p", 0, "First port for the cameras SOAP endpoints (random if 0)")
+	simulateCmd.Flags().StringP("script", "s", "", "Simulation script file (YAML or JSON)")
+	simulateCmd.Flags().Bool("tls", false, "Serve HTTPS with self-signed certificates")
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2020 luca.capra@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/muka/camd/onvif"
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot <device>",
+	Short: "Fetch a JPEG snapshot from an ONVIF camera",
+	Long: `This command fetch a JPEG snapshot from an ONVIF camera, found by UUID,
+name, address or device service URL.
+
+The image is written to the output file, or to stdout if not set.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		profile, _ := cmd.Flags().GetString("profile")
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx := context.Background()
+
+		dev, client, err := onvif.Lookup(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		image, err := onvif.FetchSnapshot(ctx, client, dev, profile, onvif.LoadSnapshotCache())
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		if output == "" {
+			os.Stdout.Write(image)
+			return
+		}
+
+		err = ioutil.WriteFile(output, image, 0644)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Snapshot saved to %s\n", output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+
+	snapshotCmd.Flags().StringP("profile", "p", "", "Media profile token (the primary profile if empty)")
+	snapshotCmd.Flags().StringP("output", "o", "", "Output file (stdout if empty)")
+}
@@ -1,5 +1,7 @@
 package device
 
+import "time"
+
 //DeviceChanged base enum type
 type DeviceChanged uint8
 
@@ -8,6 +10,13 @@ const (
 	DeviceAdded DeviceChanged = 1
 	//DeviceRemoved notify of a device removed
 	DeviceRemoved DeviceChanged = 2
+	//DeviceUpdated notify of a device changing its metadata or address
+	DeviceUpdated DeviceChanged = 3
+	//DeviceEvent notify of an event published by a device, eg. motion detected
+	DeviceEvent DeviceChanged = 4
+	//DevicePending notify of a device failing to resolve, retried until
+	//DeviceAdded notifies it is resolved
+	DevicePending DeviceChanged = 5
 )
 
 //Device API wrapper
@@ -21,12 +30,66 @@ type Device struct {
 	Types      []string
 	Hardware   string
 	Country    string
+	City       string
+	Location   string
+	MAC        string
+	// OnvifProfiles lists the supported ONVIF profiles (eg. S, T, G)
+	OnvifProfiles []string
+	// Scopes holds the discovery scopes not mapped to a field
+	Scopes map[string]string
+	// XAddrs lists all the addresses advertised by the device
+	XAddrs []string
+	// MetadataVersion is incremented by the device when its metadata change
+	MetadataVersion string
+	// Profiles lists the media profiles, MediaURI being the stream of the primary one
+	Profiles []MediaProfile
+	// SnapshotURI is the JPEG snapshot of the primary profile
+	SnapshotURI string
+	// Manufacturer, Model, FirmwareVersion, SerialNumber and HardwareID are
+	// reported by the device, as opposed to the discovery scopes
+	Manufacturer    string
+	Model           string
+	FirmwareVersion string
+	SerialNumber    string
+	HardwareID      string
+	Hostname        string
+	// Services maps the ONVIF services (eg. media, ptz) to their address and version
+	Services map[string]Service
+	// Capabilities flags the optional services supported by the device
+	Capabilities Capabilities
+	// ClockSkew is the offset of the device clock from the local one
+	ClockSkew time.Duration
+	// ResolveError is the last error of a pending device, failing to resolve
+	ResolveError string
+	// ResolveAttempts counts the failed resolutions of a pending device
+	ResolveAttempts int
+	// PolicyViolations lists the encoder policy settings the device cannot satisfy
+	PolicyViolations []string
+	// Recordings lists the recordings stored by the device (Profile G), if
+	// enabled by onvif.recordings, as of the last resolution
+	Recordings []Recording
+	// RelayOutputs and DigitalInputs list the device I/O, eg. door strikes
+	// and sirens wired to the relays
+	RelayOutputs  []RelayOutput
+	DigitalInputs []DigitalInput
+	// VideoSources lists the video source tokens, one per channel of an NVR
+	// or a multi-input encoder
+	VideoSources []string
+	// Parent is the UUID of the NVR or encoder of a channel device, bound to
+	// its VideoSource
+	Parent      string
+	VideoSource string
+	// Container is true for an NVR or encoder expanded into channel devices,
+	// without a stream of its own duplicating one of the channels
+	Container bool
 }
 
 //OnChangeEvent notify of an event for a device
 type OnChangeEvent struct {
 	Device Device
 	Event  DeviceChanged
+	// Notification is set for DeviceEvent
+	Notification *Notification
 }
 
 // OnChanged return a OnChangeEvent instance
@@ -36,3 +99,116 @@ func OnChanged(dev Device, ev DeviceChanged) OnChangeEvent {
 		Event:  ev,
 	}
 }
+
+//VideoEncoder the video encoder settings of a media profile
+type VideoEncoder struct {
+	Token     string  `json:"token,omitempty"`
+	Codec     string  `json:"codec"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"fps"`
+	Bitrate   int     `json:"bitrate"`
+}
+
+//AudioEncoder the audio encoder settings of a media profile
+type AudioEncoder struct {
+	Token      string `json:"token,omitempty"`
+	Codec      string `json:"codec"`
+	Bitrate    int    `json:"bitrate"`
+	SampleRate int    `json:"sampleRate"`
+}
+
+//MediaProfile an ONVIF media profile and its stream URIs
+type MediaProfile struct {
+	Token string        `json:"token"`
+	Name  string        `json:"name"`
+	Video *VideoEncoder `json:"video,omitempty"`
+	Audio *AudioEncoder `json:"audio,omitempty"`
+	// VideoSource is the token of the video source the profile is bound to
+	VideoSource string `json:"videoSource,omitempty"`
+	RTSPURI     string `json:"rtspUri,omitempty"`
+	HTTPURI     string `json:"httpUri,omitempty"`
+	RTSPSURI    string `json:"rtspsUri,omitempty"`
+	SnapshotURI string `json:"snapshotUri,omitempty"`
+	// URIExpires is when the stream URIs expire (UnixNano), zero if they do not
+	URIExpires int64 `json:"uriExpires,omitempty"`
+	// InvalidAfterReboot is true if the stream URIs change when the device reboots
+	InvalidAfterReboot bool `json:"invalidAfterReboot,omitempty"`
+	// InvalidAfterConnect is true if the stream URIs are valid for a single
+	// connection, the consumer requesting new ones to connect again
+	InvalidAfterConnect bool `json:"invalidAfterConnect,omitempty"`
+	// Media2 is true if the profile comes from the Media2 (ver20) service
+	Media2 bool `json:"media2,omitempty"`
+}
+
+//Recording a recording stored by a device, eg. on an SD card or an NVR
+type Recording struct {
+	Token string `json:"token"`
+	// SourceID and SourceName identify the recorded camera or input
+	SourceID   string `json:"sourceId,omitempty"`
+	SourceName string `json:"sourceName,omitempty"`
+	Content    string `json:"content,omitempty"`
+	// Start and End are the time range of the recorded data
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Status is one of Initiated, Recording, Stopped, Removing, Removed or Unknown
+	Status string           `json:"status,omitempty"`
+	Tracks []RecordingTrack `json:"tracks,omitempty"`
+	// ReplayURI is the RTSP URI replaying the recording, positioned by the
+	// Range header of the PLAY request
+	ReplayURI string `json:"replayUri,omitempty"`
+}
+
+//RecordingTrack a video, audio or metadata track of a recording
+type RecordingTrack struct {
+	Token       string    `json:"token"`
+	Type        string    `json:"type"`
+	Description string    `json:"description,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+//RelayOutput a relay output of a device
+type RelayOutput struct {
+	Token string `json:"token"`
+	// Mode is Monostable (back to idle after DelayTime) or Bistable
+	Mode      string        `json:"mode"`
+	DelayTime time.Duration `json:"delayTime,omitempty"`
+	// IdleState is the physical state of the inactive relay, open or closed
+	IdleState string `json:"idleState"`
+}
+
+//DigitalInput a digital input of a device
+type DigitalInput struct {
+	Token string `json:"token"`
+	// IdleState is the physical state of the inactive input, open or closed
+	IdleState string `json:"idleState,omitempty"`
+}
+
+//Service the address and version of an ONVIF service
+type Service struct {
+	XAddr   string `json:"xaddr"`
+	Version string `json:"version,omitempty"`
+}
+
+//Capabilities the optional ONVIF services supported by a device
+type Capabilities struct {
+	PTZ       bool `json:"ptz"`
+	Events    bool `json:"events"`
+	Analytics bool `json:"analytics"`
+	Recording bool `json:"recording"`
+	Imaging   bool `json:"imaging"`
+	DeviceIO  bool `json:"deviceIO"`
+}
+
+//Notification an event published by a device, such as motion or tampering
+type Notification struct {
+	// Topic is the event topic without namespace prefixes, eg. RuleEngine/CellMotionDetector/Motion
+	Topic string    `json:"topic"`
+	Time  time.Time `json:"time"`
+	// Operation is one of Initialized, Changed or Deleted for property events
+	Operation string            `json:"operation,omitempty"`
+	Source    map[string]string `json:"source,omitempty"`
+	Key       map[string]string `json:"key,omitempty"`
+	Data      map[string]string `json:"data,omitempty"`
+}
@@ -7,5 +7,5 @@ require (
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.0
 	github.com/stretchr/testify v1.6.1
-	github.com/use-go/onvif v0.0.0-20200526023928-918ce541d2e4
+	gopkg.in/yaml.v2 v2.2.4
 )
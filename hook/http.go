@@ -16,9 +16,45 @@ import (
 
 //CameraSource a json payload
 type CameraSource struct {
-	Live bool   `json:"live"`
-	URI  string `json:"uri"`
-	Type string `json:"type"`
+	Live     bool                  `json:"live"`
+	URI      string                `json:"uri"`
+	Type     string                `json:"type"`
+	Profiles []device.MediaProfile `json:"profiles,omitempty"`
+	Snapshot string                `json:"snapshot,omitempty"`
+	Info     *SourceInfo           `json:"info,omitempty"`
+	// Capabilities is set for ONVIF sources only
+	Capabilities *device.Capabilities `json:"capabilities,omitempty"`
+	// Pending is set for a device failing to resolve, Error being the last failure
+	Pending bool   `json:"pending,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// PolicyViolations lists the encoder policy settings the device cannot satisfy
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+	// Recordings is set for the devices storing recordings, if enabled by onvif.recordings
+	Recordings []device.Recording `json:"recordings,omitempty"`
+	// RelayOutputs and DigitalInputs are set for the devices with I/O
+	RelayOutputs  []device.RelayOutput  `json:"relayOutputs,omitempty"`
+	DigitalInputs []device.DigitalInput `json:"digitalInputs,omitempty"`
+	// Parent is the UUID of the NVR or encoder of a channel, Channel being
+	// its video source token
+	Parent  string `json:"parent,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	// Container is set for an NVR or encoder expanded into channels, which
+	// has no stream of its own
+	Container bool `json:"container,omitempty"`
+}
+
+//SourceInfo identify the device providing a source
+type SourceInfo struct {
+	Name            string `json:"name,omitempty"`
+	Manufacturer    string `json:"manufacturer,omitempty"`
+	Model           string `json:"model,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+	SerialNumber    string `json:"serialNumber,omitempty"`
+	HardwareID      string `json:"hardwareId,omitempty"`
+	Hostname        string `json:"hostname,omitempty"`
+	MAC             string `json:"mac,omitempty"`
+	// ClockSkew is the device clock offset in seconds
+	ClockSkew float64 `json:"clockSkew,omitempty"`
 }
 
 // Request Perform an HTTP request based on the event
@@ -28,6 +64,17 @@ func Request(ev device.OnChangeEvent) error {
 	if url == "" {
 		url = "http://localhost:8778/api/config/source/%uuid"
 	}
+
+	if ev.Event == device.DeviceEvent {
+		if ev.Notification == nil {
+			return nil
+		}
+		url = viper.GetViper().GetString("event_url")
+		if url == "" {
+			url = "http://localhost:8778/api/event/source/%uuid"
+		}
+	}
+
 	contentType := "application/json"
 
 	url = strings.ReplaceAll(url, "%uuid", ev.Device.UUID)
@@ -35,7 +82,7 @@ func Request(ev device.OnChangeEvent) error {
 	var body io.Reader
 	method := "DELETE"
 
-	if ev.Event == device.DeviceAdded {
+	if ev.Event == device.DeviceAdded || ev.Event == device.DeviceUpdated {
 		method = "PUT"
 
 		uri := ev.Device.MediaURI
@@ -44,9 +91,28 @@ func Request(ev device.OnChangeEvent) error {
 		}
 
 		source := CameraSource{
-			Type: "video",
-			URI:  uri,
-			Live: true,
+			Type:     "video",
+			URI:      uri,
+			Live:     !ev.Device.Container,
+			Profiles: ev.Device.Profiles,
+			Snapshot: ev.Device.SnapshotURI,
+
+			PolicyViolations: ev.Device.PolicyViolations,
+			Recordings:       ev.Device.Recordings,
+			RelayOutputs:     ev.Device.RelayOutputs,
+			DigitalInputs:    ev.Device.DigitalInputs,
+			Parent:           ev.Device.Parent,
+			Channel:          ev.Device.VideoSource,
+			Container:        ev.Device.Container,
+		}
+
+		if ev.Device.Manufacturer != "" || ev.Device.SerialNumber != "" || ev.Device.MAC != "" {
+			source.Info = sourceInfo(ev.Device)
+		}
+
+		if len(ev.Device.Services) > 0 {
+			capabilities := ev.Device.Capabilities
+			source.Capabilities = &capabilities
 		}
 
 		b, err := json.Marshal(source)
@@ -57,6 +123,43 @@ func Request(ev device.OnChangeEvent) error {
 		body = bytes.NewReader(b)
 	}
 
+	if ev.Event == device.DevicePending {
+		method = "PUT"
+
+		// identify the device with what discovery found, eg. the name and
+		// hardware scopes, as it could not be queried
+		info := sourceInfo(ev.Device)
+		if info.Model == "" {
+			info.Model = ev.Device.Hardware
+		}
+
+		b, err := json.Marshal(CameraSource{
+			Type:    "video",
+			Live:    false,
+			Pending: true,
+			Error:   ev.Device.ResolveError,
+			Info:    info,
+			Parent:  ev.Device.Parent,
+			Channel: ev.Device.VideoSource,
+		})
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	if ev.Event == device.DeviceEvent {
+		method = "POST"
+
+		b, err := json.Marshal(ev.Notification)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
 	client := &http.Client{}
 
 	// Create request
@@ -94,3 +197,18 @@ func Request(ev device.OnChangeEvent) error {
 
 	return nil
 }
+
+// sourceInfo return the identification of a device
+func sourceInfo(dev device.Device) *SourceInfo {
+	return &SourceInfo{
+		Name:            dev.Name,
+		Manufacturer:    dev.Manufacturer,
+		Model:           dev.Model,
+		FirmwareVersion: dev.FirmwareVersion,
+		SerialNumber:    dev.SerialNumber,
+		HardwareID:      dev.HardwareID,
+		Hostname:        dev.Hostname,
+		MAC:             dev.MAC,
+		ClockSkew:       dev.ClockSkew.Seconds(),
+	}
+}
@@ -0,0 +1,615 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+	"gopkg.in/yaml.v2"
+)
+
+// BackupVersion is the version of the backup format, newer backups are refused
+const BackupVersion = 1
+
+// Backup the configuration of a device, as written by WriteBackup
+type Backup struct {
+	Version       int                         `json:"version"`
+	Created       time.Time                   `json:"created"`
+	Device        BackupDevice                `json:"device"`
+	Profiles      []BackupProfile             `json:"profiles"`
+	VideoEncoders []VideoEncoderConfiguration `json:"videoEncoders"`
+	AudioEncoders []AudioEncoderConfiguration `json:"audioEncoders,omitempty"`
+	// Imaging holds the image settings by video source token
+	Imaging map[string]ImagingSettings `json:"imaging,omitempty"`
+	Network BackupNetwork              `json:"network"`
+	NTP     BackupNTP                  `json:"ntp"`
+}
+
+// BackupDevice identifies the device a backup was taken from
+type BackupDevice struct {
+	UUID            string `json:"uuid"`
+	Name            string `json:"name"`
+	Address         string `json:"address"`
+	Manufacturer    string `json:"manufacturer"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	SerialNumber    string `json:"serialNumber"`
+}
+
+// BackupProfile a media profile and the configurations it uses
+type BackupProfile struct {
+	Token        string `json:"token"`
+	Name         string `json:"name"`
+	VideoSource  string `json:"videoSource,omitempty"`
+	VideoEncoder string `json:"videoEncoder,omitempty"`
+	AudioEncoder string `json:"audioEncoder,omitempty"`
+}
+
+// BackupNetwork the hostname and network interfaces. The interfaces are
+// recorded for reference and not restored, as it would move the device.
+type BackupNetwork struct {
+	Hostname         string            `json:"hostname"`
+	HostnameFromDHCP bool              `json:"hostnameFromDHCP"`
+	Interfaces       []BackupInterface `json:"interfaces,omitempty"`
+}
+
+// BackupInterface a network interface
+type BackupInterface struct {
+	Token     string   `json:"token"`
+	MAC       string   `json:"mac"`
+	DHCP      bool     `json:"dhcp"`
+	Addresses []string `json:"addresses"`
+}
+
+// BackupNTP the NTP servers, provided by DHCP if FromDHCP
+type BackupNTP struct {
+	FromDHCP bool     `json:"fromDHCP"`
+	Servers  []string `json:"servers,omitempty"`
+}
+
+// CreateBackup read the device configuration
+func CreateBackup(ctx context.Context, client *Client, dev device.Device) (Backup, error) {
+
+	backup := Backup{
+		Version: BackupVersion,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Device: BackupDevice{
+			UUID:    dev.UUID,
+			Name:    dev.Name,
+			Address: client.XAddr(),
+		},
+	}
+
+	info, err := client.DeviceInformation(ctx)
+	if err != nil {
+		return backup, err
+	}
+	backup.Device.Manufacturer = strings.TrimSpace(info.Body.GetDeviceInformationResponse.Manufacturer)
+	backup.Device.Model = strings.TrimSpace(info.Body.GetDeviceInformationResponse.Model)
+	backup.Device.FirmwareVersion = strings.TrimSpace(info.Body.GetDeviceInformationResponse.FirmwareVersion)
+	backup.Device.SerialNumber = strings.TrimSpace(info.Body.GetDeviceInformationResponse.SerialNumber)
+
+	profiles, err := getProfiles(ctx, client)
+	if err != nil {
+		return backup, err
+	}
+	sources := []string{}
+	for _, profile := range profiles {
+		p := BackupProfile{Token: profile.Token, Name: profile.Name, VideoSource: profile.VideoSource}
+		if profile.Video != nil {
+			p.VideoEncoder = profile.Video.Token
+		}
+		if profile.Audio != nil {
+			p.AudioEncoder = profile.Audio.Token
+		}
+		backup.Profiles = append(backup.Profiles, p)
+		if profile.VideoSource != "" && !containsString(sources, profile.VideoSource) {
+			sources = append(sources, profile.VideoSource)
+		}
+	}
+
+	backup.VideoEncoders, err = GetVideoEncoders(ctx, client)
+	if err != nil {
+		return backup, err
+	}
+
+	// audio is optional
+	backup.AudioEncoders, err = getAudioEncoderConfigurations(ctx, client)
+	if err != nil {
+		log.Printf("Audio encoders not available for %s: %s", dev.Name, err)
+	}
+
+	if client.HasService(ctx, "imaging") {
+		backup.Imaging = map[string]ImagingSettings{}
+		for _, source := range sources {
+			imaging, err := NewImaging(ctx, client, source)
+			if err != nil {
+				return backup, err
+			}
+			settings, err := imaging.Settings(ctx)
+			if err != nil {
+				return backup, fmt.Errorf("Imaging settings of %s: %s", source, err)
+			}
+			backup.Imaging[source] = settings
+		}
+	}
+
+	hostname := GetHostnameResponse{}
+	err = client.Call(ctx, client.xaddr, GetHostname{}, &hostname)
+	if err != nil {
+		return backup, err
+	}
+	backup.Network.Hostname = strings.TrimSpace(hostname.Body.GetHostnameResponse.HostnameInformation.Name)
+	backup.Network.HostnameFromDHCP = hostname.Body.GetHostnameResponse.HostnameInformation.FromDHCP
+
+	interfaces, err := getNetworkInterfaces(ctx, client)
+	if err != nil {
+		return backup, err
+	}
+	for _, iface := range interfaces {
+		backup.Network.Interfaces = append(backup.Network.Interfaces, BackupInterface{
+			Token:     iface.Token,
+			MAC:       normalizeMAC(iface.Info.HwAddress),
+			DHCP:      iface.IPv4.Config.DHCP,
+			Addresses: iface.Addresses(),
+		})
+	}
+
+	backup.NTP.Servers, backup.NTP.FromDHCP, err = getNTP(ctx, client)
+	if err != nil {
+		return backup, err
+	}
+
+	return backup, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Change a difference between a backup and the device configuration
+type Change struct {
+	// Section is the changed configuration, eg. videoEncoders/Profile_1_VideoEncoder
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	// Unsupported is set for the differences reported but not restored
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+func (c Change) String() string {
+	from := c.From
+	if from == "" {
+		from = "(none)"
+	}
+	if c.Unsupported {
+		return fmt.Sprintf("%s %s: %s -> %s (not restored)", c.Section, c.Key, from, c.To)
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", c.Section, c.Key, from, c.To)
+}
+
+// RestoreOptions control RestoreBackup
+type RestoreOptions struct {
+	// DryRun only return the changes
+	DryRun bool
+	// Force restore a backup of another model, skipping the configurations
+	// missing on the device
+	Force bool
+}
+
+// restoreStep the changes to a configuration and how to apply them
+type restoreStep struct {
+	changes []Change
+	apply   func(ctx context.Context) error
+}
+
+// RestoreBackup apply a backup to a device, possibly another device of the
+// same model, returning the changes made or to make if opts.DryRun. The
+// profiles and the video and audio encoders are matched by token, then by
+// name, the imaging settings by video source. Unchanged configurations are
+// not applied. The profiles are bound to their encoders, while a different
+// video source is reported as unsupported, as the backup does not hold the
+// source configurations.
+func RestoreBackup(ctx context.Context, client *Client, dev device.Device, backup Backup, opts RestoreOptions) ([]Change, error) {
+
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return nil, fmt.Errorf("Unsupported backup version %d", backup.Version)
+	}
+
+	current, err := CreateBackup(ctx, client, dev)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(backup.Device.Model, current.Device.Model) && !opts.Force {
+		return nil, fmt.Errorf("Backup of model %s cannot be restored on model %s without force", backup.Device.Model, current.Device.Model)
+	}
+
+	steps := []restoreStep{}
+	missing := func(section string) error {
+		if opts.Force {
+			log.Printf("Skipping %s, not found on %s", section, dev.Name)
+			return nil
+		}
+		return fmt.Errorf("%s not found on the device", section)
+	}
+
+	// the profile bindings, before the encoder settings
+	unsupported := []Change{}
+	for _, profile := range backup.Profiles {
+		section := "profiles/" + profile.Token
+		target, ok := findBackupProfile(current.Profiles, profile)
+		if !ok {
+			if err := missing(section); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if profile.VideoSource != "" && profile.VideoSource != target.VideoSource {
+			unsupported = append(unsupported, Change{Section: section, Key: "videoSource", From: target.VideoSource, To: profile.VideoSource, Unsupported: true})
+		}
+		bindings := []struct {
+			key   string
+			from  string
+			to    string
+			audio bool
+		}{
+			{"videoEncoder", target.VideoEncoder, mapVideoEncoder(backup, current, profile.VideoEncoder), false},
+			{"audioEncoder", target.AudioEncoder, mapAudioEncoder(backup, current, profile.AudioEncoder), true},
+		}
+		for _, binding := range bindings {
+			if binding.to == "" || binding.to == binding.from {
+				continue
+			}
+			token, config, audio := target.Token, binding.to, binding.audio
+			steps = append(steps, restoreStep{[]Change{{Section: section, Key: binding.key, From: binding.from, To: config}}, func(ctx context.Context) error {
+				return bindEncoder(ctx, client, token, config, audio)
+			}})
+		}
+	}
+
+	for _, encoder := range backup.VideoEncoders {
+		section := "videoEncoders/" + encoder.Token
+		target, ok := findVideoEncoder(current.VideoEncoders, encoder)
+		if !ok {
+			if err := missing(section); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		config := encoder
+		config.Token = target.Token
+		config.UseCount = target.UseCount
+		changes := diffValues(section, flattenJSON(target), flattenJSON(config))
+		if len(changes) > 0 {
+			steps = append(steps, restoreStep{changes, func(ctx context.Context) error {
+				return SetVideoEncoder(ctx, client, config, true)
+			}})
+		}
+	}
+
+	for _, encoder := range backup.AudioEncoders {
+		section := "audioEncoders/" + encoder.Token
+		target, ok := findAudioEncoder(current.AudioEncoders, encoder)
+		if !ok {
+			if err := missing(section); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		config := encoder
+		config.Token = target.Token
+		config.UseCount = target.UseCount
+		changes := diffValues(section, flattenJSON(target), flattenJSON(config))
+		if len(changes) > 0 {
+			steps = append(steps, restoreStep{changes, func(ctx context.Context) error {
+				return setAudioEncoderConfiguration(ctx, client, config, true)
+			}})
+		}
+	}
+
+	sources := make([]string, 0, len(backup.Imaging))
+	for source := range backup.Imaging {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		section := "imaging/" + source
+		settings := backup.Imaging[source]
+		target, ok := current.Imaging[source]
+		if !ok {
+			if err := missing(section); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		changes := diffValues(section, flattenJSON(target), flattenJSON(settings))
+		if len(changes) > 0 {
+			source := source
+			steps = append(steps, restoreStep{changes, func(ctx context.Context) error {
+				imaging, err := NewImaging(ctx, client, source)
+				if err != nil {
+					return err
+				}
+				return imaging.SetSettings(ctx, settings, true)
+			}})
+		}
+	}
+
+	// the servers provided by DHCP are not compared
+	ntpServers := func(ntp BackupNTP) string {
+		if ntp.FromDHCP {
+			return "DHCP"
+		}
+		return strings.Join(ntp.Servers, ", ")
+	}
+	if from, to := ntpServers(current.NTP), ntpServers(backup.NTP); to != "" && from != to {
+		steps = append(steps, restoreStep{[]Change{{Section: "ntp", Key: "servers", From: from, To: to}}, func(ctx context.Context) error {
+			return SetNTPServers(ctx, client, backup.NTP.Servers, backup.NTP.FromDHCP)
+		}})
+	}
+
+	// the hostname is set last, as the device may restart its services
+	hostname := backup.Network.Hostname
+	if !backup.Network.HostnameFromDHCP && hostname != "" && hostname != current.Network.Hostname {
+		steps = append(steps, restoreStep{
+			[]Change{{Section: "network", Key: "hostname", From: current.Network.Hostname, To: hostname}},
+			func(ctx context.Context) error {
+				return SetDeviceHostname(ctx, client, hostname)
+			},
+		})
+	}
+
+	changes := []Change{}
+	for _, step := range steps {
+		if !opts.DryRun {
+			if err := step.apply(ctx); err != nil {
+				return changes, fmt.Errorf("Restore of %s failed: %s", step.changes[0].Section, err)
+			}
+		}
+		changes = append(changes, step.changes...)
+	}
+
+	return append(changes, unsupported...), nil
+}
+
+func findBackupProfile(profiles []BackupProfile, profile BackupProfile) (BackupProfile, bool) {
+	for _, p := range profiles {
+		if p.Token == profile.Token {
+			return p, true
+		}
+	}
+	for _, p := range profiles {
+		if p.Name != "" && p.Name == profile.Name {
+			return p, true
+		}
+	}
+	return BackupProfile{}, false
+}
+
+// mapVideoEncoder return the token on the device of a video encoder of the
+// backup, matched as by RestoreBackup, empty if missing as reported for the
+// encoders
+func mapVideoEncoder(backup Backup, current Backup, token string) string {
+	for _, encoder := range backup.VideoEncoders {
+		if encoder.Token == token {
+			if target, ok := findVideoEncoder(current.VideoEncoders, encoder); ok {
+				return target.Token
+			}
+		}
+	}
+	return ""
+}
+
+// mapAudioEncoder return the token on the device of an audio encoder of the
+// backup, matched as by RestoreBackup, empty if missing as reported for the
+// encoders
+func mapAudioEncoder(backup Backup, current Backup, token string) string {
+	for _, encoder := range backup.AudioEncoders {
+		if encoder.Token == token {
+			if target, ok := findAudioEncoder(current.AudioEncoders, encoder); ok {
+				return target.Token
+			}
+		}
+	}
+	return ""
+}
+
+func findVideoEncoder(encoders []VideoEncoderConfiguration, encoder VideoEncoderConfiguration) (VideoEncoderConfiguration, bool) {
+	for _, e := range encoders {
+		if e.Token == encoder.Token {
+			return e, true
+		}
+	}
+	for _, e := range encoders {
+		if e.Name != "" && e.Name == encoder.Name {
+			return e, true
+		}
+	}
+	return VideoEncoderConfiguration{}, false
+}
+
+func findAudioEncoder(encoders []AudioEncoderConfiguration, encoder AudioEncoderConfiguration) (AudioEncoderConfiguration, bool) {
+	for _, e := range encoders {
+		if e.Token == encoder.Token {
+			return e, true
+		}
+	}
+	for _, e := range encoders {
+		if e.Name != "" && e.Name == encoder.Name {
+			return e, true
+		}
+	}
+	return AudioEncoderConfiguration{}, false
+}
+
+// flattenJSON return the values of v by JSON path, eg. resolution.width
+func flattenJSON(v interface{}) map[string]string {
+
+	values := map[string]string{}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return values
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return values
+	}
+
+	flatten("", doc, values)
+	return values
+}
+
+func flatten(prefix string, value interface{}, values map[string]string) {
+	key := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			flatten(key(name), item, values)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flatten(key(strconv.Itoa(i)), item, values)
+		}
+	case nil:
+	default:
+		values[prefix] = fmt.Sprint(v)
+	}
+}
+
+// diffValues return the values of to differing from from, sorted by key.
+// The values missing in to are left unchanged.
+func diffValues(section string, from, to map[string]string) []Change {
+
+	keys := make([]string, 0, len(to))
+	for key := range to {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := []Change{}
+	for _, key := range keys {
+		if from[key] != to[key] {
+			changes = append(changes, Change{Section: section, Key: key, From: from[key], To: to[key]})
+		}
+	}
+	return changes
+}
+
+// isYAML check if a path has a YAML extension
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// BackupFilename return the file name of a device backup, from its name and
+// serial number, with the given extension (eg. json or yaml)
+func BackupFilename(backup Backup, ext string) string {
+	name := strings.Trim(hostnameInvalid.ReplaceAllString(strings.ToLower(backup.Device.Name), "-"), "-")
+	serial := strings.Trim(hostnameInvalid.ReplaceAllString(strings.ToLower(backup.Device.SerialNumber), "-"), "-")
+	switch {
+	case name == "" && serial == "":
+		name = strings.Trim(hostnameInvalid.ReplaceAllString(strings.TrimPrefix(backup.Device.UUID, "urn:uuid:"), "-"), "-")
+	case name == "":
+		name = serial
+	case serial != "":
+		name += "-" + serial
+	}
+	return name + "." + strings.TrimPrefix(ext, ".")
+}
+
+// WriteBackup write a backup as JSON, or as YAML if path ends with .yaml or .yml
+func WriteBackup(backup Backup, path string) error {
+
+	b, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if isYAML(path) {
+		// JSON is valid YAML, the document is decoded keeping the keys order
+		doc := yaml.MapSlice{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		b, err = yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// ReadBackup read a backup written by WriteBackup
+func ReadBackup(path string) (Backup, error) {
+
+	backup := Backup{}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return backup, err
+	}
+
+	if isYAML(path) {
+		var doc interface{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return backup, err
+		}
+		b, err = json.Marshal(jsonValue(doc))
+		if err != nil {
+			return backup, err
+		}
+	}
+
+	if err := json.Unmarshal(b, &backup); err != nil {
+		return backup, err
+	}
+	if backup.Version == 0 {
+		return backup, errors.New("Not a device backup, version missing")
+	}
+
+	return backup, nil
+}
+
+// jsonValue convert the YAML maps to JSON objects
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,104 @@
+package onvif
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupRestore(t *testing.T) {
+
+	camera1, dev1, client1 := connectCamera(t, simulator.Config{Imaging: true})
+	defer camera1.Stop()
+	camera2, dev2, client2 := connectCamera(t, simulator.Config{Imaging: true})
+	defer camera2.Stop()
+	other, otherDev, otherClient := connectCamera(t, simulator.Config{Imaging: true, Model: "other"})
+	defer other.Stop()
+
+	ctx := context.Background()
+
+	// configure the first camera
+	encoders, err := GetVideoEncoders(ctx, client1)
+	assert.NoError(t, err)
+	assert.Len(t, encoders, 2)
+	encoder := encoders[0]
+	encoder.Resolution = VideoResolution{Width: 1280, Height: 720}
+	encoder.RateControl.BitrateLimit = 2048
+	assert.NoError(t, SetVideoEncoder(ctx, client1, encoder, true))
+	assert.NoError(t, SetNTPServers(ctx, client1, []string{"ntp.example.com"}, false))
+	imaging, err := NewImaging(ctx, client1, "")
+	assert.NoError(t, err)
+	brightness := 80.0
+	assert.NoError(t, imaging.SetSettings(ctx, ImagingSettings{Brightness: &brightness}, true))
+
+	backup, err := CreateBackup(ctx, client1, dev1)
+	if err != nil {
+		t.Fatalf("CreateBackup failed: %s", err)
+	}
+	assert.Equal(t, "camd-simulator", backup.Device.Model)
+	assert.Equal(t, 80.0, *backup.Imaging["VideoSource_1"].Brightness)
+	assert.Equal(t, []string{"ntp.example.com"}, backup.NTP.Servers)
+
+	dir, err := ioutil.TempDir("", "camd-backup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{"json", "yaml"} {
+		path := dir + "/" + BackupFilename(backup, ext)
+		assert.NoError(t, WriteBackup(backup, path))
+		read, err := ReadBackup(path)
+		assert.NoError(t, err)
+		assert.Equal(t, backup, read, ext)
+	}
+
+	// restore to a replacement camera of the same model
+	changes, err := RestoreBackup(ctx, client2, dev2, backup, RestoreOptions{DryRun: true})
+	assert.NoError(t, err)
+	sections := map[string]bool{}
+	for _, change := range changes {
+		sections[change.Section] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"videoEncoders/Profile_1_VideoEncoder": true,
+		"imaging/VideoSource_1":                true,
+		"ntp":                                  true,
+		"network":                              true,
+	}, sections)
+	assert.NotEqual(t, 1280, camera2.Config().Profiles[0].Width)
+
+	applied, err := RestoreBackup(ctx, client2, dev2, backup, RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, changes, applied)
+	assert.Equal(t, 1280, camera2.Config().Profiles[0].Width)
+	assert.Equal(t, camera1.Config().Hostname, camera2.Config().Hostname)
+
+	changes, err = RestoreBackup(ctx, client2, dev2, backup, RestoreOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// the profile bindings are restored, or reported if not supported
+	rebound := backup
+	rebound.Profiles = append([]BackupProfile{}, backup.Profiles...)
+	rebound.Profiles[1].VideoEncoder = "Profile_1_VideoEncoder"
+	rebound.Profiles[1].VideoSource = "VideoSource_2"
+	changes, err = RestoreBackup(ctx, client2, dev2, rebound, RestoreOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Section: "profiles/Profile_2", Key: "videoEncoder", From: "Profile_2_VideoEncoder", To: "Profile_1_VideoEncoder"},
+		{Section: "profiles/Profile_2", Key: "videoSource", From: "VideoSource_1", To: "VideoSource_2", Unsupported: true},
+	}, changes)
+	assert.Contains(t, changes[1].String(), "not restored")
+	// the simulated profiles are fixed
+	_, err = RestoreBackup(ctx, client2, dev2, rebound, RestoreOptions{})
+	assert.Error(t, err)
+
+	// another model requires force
+	_, err = RestoreBackup(ctx, otherClient, otherDev, backup, RestoreOptions{DryRun: true})
+	assert.Error(t, err)
+	_, err = RestoreBackup(ctx, otherClient, otherDev, backup, RestoreOptions{DryRun: true, Force: true})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,146 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/muka/camd/device"
+)
+
+var channelTokenInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ChildUUID return the stable UUID of the channel of a device bound to a
+// video source, eg. urn:uuid:<parent>_VideoSource_2
+func ChildUUID(parent string, source string) string {
+	return parent + "_" + channelTokenInvalid.ReplaceAllString(source, "-")
+}
+
+// VideoSources return the video source tokens of the device
+func VideoSources(ctx context.Context, client *Client) ([]string, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetVideoSourcesResponse{}
+	err = client.Call(ctx, xaddr, GetVideoSources{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []string{}
+	for _, source := range res.Body.GetVideoSourcesResponse.VideoSources {
+		if token := strings.TrimSpace(source.Token); token != "" {
+			sources = append(sources, token)
+		}
+	}
+
+	return sources, nil
+}
+
+// resolveVideoSources fill the device video sources, from the profiles if
+// GetVideoSources is not supported
+func resolveVideoSources(ctx context.Context, client *Client, dev *device.Device) {
+
+	sources, err := VideoSources(ctx, client)
+	if err == nil {
+		dev.VideoSources = sources
+		return
+	}
+
+	log.Printf("GetVideoSources failed for %s: %s", dev.Name, err)
+	dev.VideoSources = nil
+	for _, profile := range dev.Profiles {
+		if profile.VideoSource != "" && !containsString(dev.VideoSources, profile.VideoSource) {
+			dev.VideoSources = append(dev.VideoSources, profile.VideoSource)
+		}
+	}
+}
+
+// Channels return a child device per video source of an NVR or multi-input
+// encoder, with the profiles bound to the source and the stream of the one
+// selected by profile. A device with a single video source has no channels.
+func Channels(dev device.Device, profile string) []device.Device {
+
+	channels := []device.Device{}
+	for _, source := range dev.VideoSources {
+
+		profiles := []device.MediaProfile{}
+		for _, p := range dev.Profiles {
+			if p.VideoSource == source {
+				profiles = append(profiles, p)
+			}
+		}
+		// a source without profiles has no stream
+		if len(profiles) == 0 {
+			continue
+		}
+
+		child := dev
+		child.UUID = ChildUUID(dev.UUID, source)
+		child.Name = fmt.Sprintf("%s (%s)", dev.Name, source)
+		child.Parent = dev.UUID
+		child.VideoSource = source
+		child.VideoSources = nil
+		child.Container = false
+		child.Profiles = profiles
+		child.MediaURI = ""
+		child.SnapshotURI = ""
+		if primary, ok := primaryProfile(profiles, profile); ok {
+			child.MediaURI = primary.RTSPURI
+			child.SnapshotURI = primary.SnapshotURI
+		}
+		// the recordings and I/O belong to the parent
+		child.Recordings = nil
+		child.RelayOutputs = nil
+		child.DigitalInputs = nil
+
+		channels = append(channels, child)
+	}
+
+	if len(channels) < 2 {
+		return nil
+	}
+	return channels
+}
+
+// markContainer flag a device expanded into channels as a container, clearing
+// its MediaURI as each channel provides its own stream
+func markContainer(dev *device.Device, profile string) {
+	dev.Container = len(Channels(*dev, profile)) > 0
+	if dev.Container {
+		dev.MediaURI = ""
+	}
+}
+
+// channelEvents return the events notifying the channels of a device, added,
+// updated or removed from the previous ones
+func channelEvents(prev []device.Device, channels []device.Device) []device.OnChangeEvent {
+
+	known := map[string]bool{}
+	for _, channel := range prev {
+		known[channel.UUID] = true
+	}
+
+	events := []device.OnChangeEvent{}
+	for _, channel := range channels {
+		event := device.DeviceAdded
+		if known[channel.UUID] {
+			event = device.DeviceUpdated
+			delete(known, channel.UUID)
+		}
+		events = append(events, device.OnChanged(channel, event))
+	}
+
+	for _, channel := range prev {
+		if known[channel.UUID] {
+			events = append(events, device.OnChanged(channel, device.DeviceRemoved))
+		}
+	}
+
+	return events
+}
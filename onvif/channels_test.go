@@ -0,0 +1,85 @@
+package onvif
+
+import (
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannels(t *testing.T) {
+
+	camera, dev := resolveCamera(t, simulator.Config{
+		Name: "NVR",
+		Profiles: []simulator.Profile{
+			{Token: "Ch1_Main", Name: "Ch1Main", Width: 1920, Height: 1080, VideoSource: "VideoSource_1"},
+			{Token: "Ch1_Sub", Name: "Ch1Sub", Width: 640, Height: 360, VideoSource: "VideoSource_1"},
+			{Token: "Ch2_Main", Name: "Ch2Main", Width: 1280, Height: 720, VideoSource: "VideoSource_2"},
+		},
+	}, NewAuthenticator(nil))
+	defer camera.Stop()
+
+	assert.Equal(t, []string{"VideoSource_1", "VideoSource_2"}, dev.VideoSources)
+	assert.Len(t, dev.Profiles, 3)
+	// the parent does not duplicate the stream of a channel
+	assert.True(t, dev.Container)
+	assert.Empty(t, dev.MediaURI)
+
+	channels := Channels(dev, ProfileLowest)
+	assert.Len(t, channels, 2)
+	assert.Equal(t, dev.UUID+"_VideoSource_2", channels[1].UUID)
+	assert.Equal(t, dev.UUID, channels[1].Parent)
+	assert.Equal(t, "VideoSource_2", channels[1].VideoSource)
+	assert.False(t, channels[1].Container)
+	assert.Len(t, channels[0].Profiles, 2)
+	assert.Equal(t, "Ch1_Sub", channels[0].Profiles[1].Token)
+	assert.Equal(t, channels[0].Profiles[1].RTSPURI, channels[0].MediaURI)
+	assert.Equal(t, channels[1].Profiles[0].RTSPURI, channels[1].MediaURI)
+
+	// a single channel device is not expanded
+	single := dev
+	single.VideoSources = []string{"VideoSource_1"}
+	assert.Nil(t, Channels(single, ""))
+
+	events := channelEvents(nil, channels)
+	assert.Len(t, events, 2)
+	assert.Equal(t, device.DeviceAdded, events[0].Event)
+
+	events = channelEvents(channels, channels[:1])
+	assert.Len(t, events, 2)
+	assert.Equal(t, device.DeviceUpdated, events[0].Event)
+	assert.Equal(t, device.DeviceRemoved, events[1].Event)
+	assert.Equal(t, channels[1].UUID, events[1].Device.UUID)
+
+	assert.Equal(t, "urn:uuid:1_Channel-2", ChildUUID("urn:uuid:1", "Channel 2"))
+
+}
+
+func TestChannelsOffline(t *testing.T) {
+
+	profiles := []simulator.Profile{
+		{Token: "Ch1", Width: 1920, Height: 1080, VideoSource: "VideoSource_1", Offline: true},
+		{Token: "Ch2", Width: 1920, Height: 1080, VideoSource: "VideoSource_2"},
+		{Token: "Ch3", Width: 1920, Height: 1080, VideoSource: "VideoSource_3"},
+	}
+
+	// an offline channel does not hide the others
+	tests := []struct {
+		name   string
+		config simulator.Config
+	}{
+		{"media", simulator.Config{Profiles: profiles}},
+		{"media2", simulator.Config{Profiles: profiles, Media2: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nvr, dev := resolveCamera(t, test.config, NewAuthenticator(nil))
+			defer nvr.Stop()
+
+			assert.Len(t, dev.Profiles, 2)
+			assert.Len(t, Channels(dev, ""), 2)
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+// ErrNotAuthorized the device rejected the credentials
+var ErrNotAuthorized = errors.New("Not authorized")
+
+const requestTimeout = 10 * time.Second
+
+// NewClient init a SOAP client for the device service at xaddr
+func NewClient(xaddr string, credential Credential) *Client {
+	return &Client{
+		xaddr:      xaddr,
+		credential: credential,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Client perform SOAP calls against an ONVIF device, authenticating with
+// WS-Security UsernameToken and, when challenged, HTTP Digest
+type Client struct {
+	xaddr       string
+	credential  Credential
+	httpClient  *http.Client
+	mut         sync.Mutex
+	digest      *digestChallenge
+	services    map[string]device.Service
+	info        *GetDeviceInformationResponse
+	clockOffset time.Duration
+}
+
+// XAddr return the device service address
+func (c *Client) XAddr() string {
+	return c.xaddr
+}
+
+// Credential return the credential used by the client
+func (c *Client) Credential() Credential {
+	return c.credential
+}
+
+// Call send an operation to the service at xaddr and unmarshal the response envelope
+func (c *Client) Call(ctx context.Context, xaddr string, operation interface{}, response interface{}) error {
+	return c.CallAction(ctx, xaddr, "", operation, response)
+}
+
+// CallAction send an operation with the WS-Addressing Action and To headers,
+// as required by the WS-BaseNotification subscription managers
+func (c *Client) CallAction(ctx context.Context, xaddr string, action string, operation interface{}, response interface{}) error {
+
+	body, err := c.marshal(operation, xaddr, action)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	challenge := c.digest
+	c.mut.Unlock()
+
+	res, err := c.post(ctx, xaddr, action, body, challenge)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized && c.credential.Username != "" {
+		challenge = parseDigestChallenge(res.Header.Get("WWW-Authenticate"))
+		res.Body.Close()
+		if challenge == nil {
+			return ErrNotAuthorized
+		}
+		c.mut.Lock()
+		c.digest = challenge
+		c.mut.Unlock()
+		res, err = c.post(ctx, xaddr, action, body, challenge)
+		if err != nil {
+			return err
+		}
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return ErrNotAuthorized
+	}
+
+	if fault := parseFault(b); fault != nil {
+		return fault
+	}
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("Request failed: %s", res.Status)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return xml.Unmarshal(b, response)
+}
+
+func (c *Client) marshal(operation interface{}, xaddr string, action string) ([]byte, error) {
+
+	env := requestEnvelope{}
+	env.Body.Operation = operation
+
+	if action != "" {
+		env.Header = &requestHeader{Action: action, To: xaddr}
+	}
+
+	if c.credential.Username != "" {
+		sec, err := newSecurity(c.credential.Username, c.credential.Password, time.Now().Add(c.ClockOffset()))
+		if err != nil {
+			return nil, err
+		}
+		if env.Header == nil {
+			env.Header = &requestHeader{}
+		}
+		env.Header.Security = sec
+	}
+
+	b, err := xml.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (c *Client) post(ctx context.Context, xaddr string, action string, body []byte, challenge *digestChallenge) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, xaddr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	contentType := "application/soap+xml; charset=utf-8"
+	if action != "" {
+		contentType += fmt.Sprintf(`; action="%s"`, action)
+	}
+	req.Header.Set("content-type", contentType)
+
+	if challenge != nil {
+		auth, err := challenge.authorize(http.MethodPost, req.URL.RequestURI(), c.credential.Username, c.credential.Password)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// Fetch download a resource served over plain HTTP by the device, such as a
+// snapshot, authenticating with HTTP Digest or Basic when challenged
+func (c *Client) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+
+	res, err := c.get(ctx, uri, nil, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized && c.credential.Username != "" {
+		header := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+
+		challenge := parseDigestChallenge(header)
+		basic := challenge == nil && strings.HasPrefix(strings.ToLower(strings.TrimSpace(header)), "basic")
+		if challenge == nil && !basic {
+			return nil, "", ErrNotAuthorized
+		}
+
+		res, err = c.get(ctx, uri, challenge, basic)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, "", ErrNotAuthorized
+	}
+
+	if res.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("Request failed: %s", res.Status)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, res.Header.Get("content-type"), nil
+}
+
+func (c *Client) get(ctx context.Context, uri string, challenge *digestChallenge, basic bool) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge != nil {
+		auth, err := challenge.authorize(http.MethodGet, req.URL.RequestURI(), c.credential.Username, c.credential.Password)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+	}
+
+	if basic {
+		req.SetBasicAuth(c.credential.Username, c.credential.Password)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// serviceNames maps the service namespaces to the names used by Endpoint
+var serviceNames = map[string]string{
+	"http://www.onvif.org/ver10/device/wsdl":    "device",
+	"http://www.onvif.org/ver10/media/wsdl":     "media",
+	"http://www.onvif.org/ver20/media/wsdl":     "media2",
+	"http://www.onvif.org/ver10/events/wsdl":    "events",
+	"http://www.onvif.org/ver20/ptz/wsdl":       "ptz",
+	"http://www.onvif.org/ver20/imaging/wsdl":   "imaging",
+	"http://www.onvif.org/ver10/deviceIO/wsdl":  "deviceio",
+	"http://www.onvif.org/ver20/analytics/wsdl": "analytics",
+	"http://www.onvif.org/ver10/recording/wsdl": "recording",
+	"http://www.onvif.org/ver10/search/wsdl":    "search",
+	"http://www.onvif.org/ver10/replay/wsdl":    "replay",
+}
+
+// Endpoint return the address of a service (eg. media, media2, ptz), as
+// advertised by GetServices or, for older devices, GetCapabilities
+func (c *Client) Endpoint(ctx context.Context, service string) (string, error) {
+
+	service = strings.ToLower(service)
+	if service == "device" {
+		return c.xaddr, nil
+	}
+
+	services, err := c.Services(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	xaddr := services[service].XAddr
+	if xaddr == "" {
+		return "", fmt.Errorf("Service %s not available", service)
+	}
+
+	return xaddr, nil
+}
+
+// HasService return true if the device advertises a service
+func (c *Client) HasService(ctx context.Context, service string) bool {
+	_, err := c.Endpoint(ctx, service)
+	return err == nil
+}
+
+// Services return the service map of the device, querying it on first use
+func (c *Client) Services(ctx context.Context) (map[string]device.Service, error) {
+
+	c.mut.Lock()
+	services := c.services
+	c.mut.Unlock()
+	if services != nil {
+		return services, nil
+	}
+
+	services, err := c.getServices(ctx)
+	if err != nil {
+		if IsNotAuthorized(err) {
+			return nil, err
+		}
+		services, err = c.getCapabilities(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.SetServices(services)
+	return services, nil
+}
+
+// SetTLSConfig set the TLS configuration of the HTTPS requests
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	c.httpClient = &http.Client{Timeout: requestTimeout, Transport: transport}
+}
+
+// SetServices set a previously resolved service map, avoiding to query it again
+func (c *Client) SetServices(services map[string]device.Service) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.services = services
+}
+
+func (c *Client) getServices(ctx context.Context) (map[string]device.Service, error) {
+
+	res := GetServicesResponse{}
+	err := c.Call(ctx, c.xaddr, GetServices{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	services := map[string]device.Service{}
+	for _, service := range res.Body.GetServicesResponse.Service {
+		if name, ok := serviceNames[strings.TrimSpace(service.Namespace)]; ok {
+			services[name] = device.Service{
+				XAddr:   strings.TrimSpace(service.XAddr),
+				Version: fmt.Sprintf("%d.%d", service.Version.Major, service.Version.Minor),
+			}
+		}
+	}
+
+	return services, nil
+}
+
+func (c *Client) getCapabilities(ctx context.Context) (map[string]device.Service, error) {
+
+	res := GetCapabilitiesResponse{}
+	err := c.Call(ctx, c.xaddr, GetCapabilities{Category: "All"}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := res.Body.GetCapabilitiesResponse.Capabilities
+	xaddrs := map[string]string{
+		"device":    capabilities.Device.XAddr,
+		"analytics": capabilities.Analytics.XAddr,
+		"events":    capabilities.Events.XAddr,
+		"imaging":   capabilities.Imaging.XAddr,
+		"media":     capabilities.Media.XAddr,
+		"ptz":       capabilities.PTZ.XAddr,
+		"deviceio":  capabilities.Extension.DeviceIO.XAddr,
+		"recording": capabilities.Extension.Recording.XAddr,
+		"search":    capabilities.Extension.Search.XAddr,
+		"replay":    capabilities.Extension.Replay.XAddr,
+	}
+
+	// GetCapabilities does not report the service versions
+	services := map[string]device.Service{}
+	for name, xaddr := range xaddrs {
+		if xaddr = strings.TrimSpace(xaddr); xaddr != "" {
+			services[name] = device.Service{XAddr: xaddr}
+		}
+	}
+
+	return services, nil
+}
+
+// IsNotAuthorized return true if the error is an authentication failure
+func IsNotAuthorized(err error) bool {
+	if err == ErrNotAuthorized {
+		return true
+	}
+	if fault, ok := err.(*Fault); ok {
+		return fault.Subcode == "NotAuthorized" || fault.Subcode == "FailedAuthentication"
+	}
+	return false
+}
+
+// Connect return a client for the device, trying the credentials provided by
+// the authenticator until one is accepted
+func Connect(ctx context.Context, dev device.Device, auth *Authenticator) (*Client, error) {
+
+	if _, err := url.Parse(dev.Address); err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if trust := auth.Trust(); trust != nil {
+		tlsConfig = trust.TLSConfig(dev)
+	}
+	newClient := func(credential Credential) *Client {
+		client := NewClient(dev.Address, credential)
+		if tlsConfig != nil {
+			client.SetTLSConfig(tlsConfig)
+		}
+		return client
+	}
+
+	// a drifted clock makes the device reject the WS-Security timestamps
+	offset, err := getClockOffset(ctx, newClient(Credential{}))
+	if _, ok := IsPinMismatch(err); ok {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("GetSystemDateAndTime failed for %s: %s", dev.Address, err)
+	}
+
+	var lastErr error
+	for _, credential := range auth.Candidates(dev) {
+
+		client := newClient(credential)
+		client.SetClockOffset(offset)
+		if len(dev.Services) > 0 {
+			client.SetServices(dev.Services)
+		}
+
+		info := &GetDeviceInformationResponse{}
+		err := client.Call(ctx, client.xaddr, GetDeviceInformation{}, info)
+		if err == nil {
+			client.info = info
+			auth.Remember(dev.UUID, credential)
+			return client, nil
+		}
+
+		if !IsNotAuthorized(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	auth.Forget(dev.UUID)
+	return nil, fmt.Errorf("Authentication failed for %s: %s", dev.Address, lastErr)
+}
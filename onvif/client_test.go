@@ -0,0 +1,59 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectCredentials(t *testing.T) {
+
+	for _, mode := range []string{simulator.AuthWSSecurity, simulator.AuthDigest} {
+		t.Run(mode, func(t *testing.T) {
+
+			camera, dev := startCamera(t, simulator.Config{
+				Username: "admin",
+				Password: "secret",
+				Auth:     mode,
+			})
+			defer camera.Stop()
+
+			auth := NewAuthenticator([]Credential{
+				{Username: "admin", Password: "wrong"},
+				{Username: "admin", Password: "secret", Hardware: "camd-simulator"},
+				{Username: "admin", Password: "other", Address: "10.0.0.0/8"},
+			})
+
+			client, err := Connect(context.Background(), dev, auth)
+			if err != nil {
+				t.Fatalf("Connect failed: %s", err)
+			}
+			assert.Equal(t, "secret", client.Credential().Password)
+
+			uri, err := getStreamURI(context.Background(), client, "", protocolRTSP)
+			if err != nil {
+				t.Fatalf("getStreamURI failed: %s", err)
+			}
+			assert.Equal(t, "rtsp://127.0.0.1:554/Profile_1", uri.URI)
+
+			// the working credential is tried first
+			assert.Equal(t, "secret", auth.Candidates(dev)[0].Password)
+		})
+	}
+}
+
+func TestConnectNotAuthorized(t *testing.T) {
+
+	camera, dev := startCamera(t, simulator.Config{
+		Username: "admin",
+		Password: "secret",
+	})
+	defer camera.Stop()
+
+	_, err := Connect(context.Background(), dev, NewAuthenticator([]Credential{
+		{Username: "admin", Password: "wrong"},
+	}))
+	assert.Error(t, err)
+}
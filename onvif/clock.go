@@ -0,0 +1,81 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+const defaultClockSkewWarning = 5 * time.Second
+
+// ClockOffset return the difference between the device clock and the local one,
+// added to the WS-Security timestamps
+func (c *Client) ClockOffset() time.Duration {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.clockOffset
+}
+
+// SetClockOffset set the difference between the device clock and the local one
+func (c *Client) SetClockOffset(offset time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.clockOffset = offset
+}
+
+// getClockOffset measure the device clock offset with GetSystemDateAndTime,
+// which devices answer without authentication
+func getClockOffset(ctx context.Context, client *Client) (time.Duration, error) {
+
+	res := GetSystemDateAndTimeResponse{}
+
+	sent := time.Now()
+	err := client.Call(ctx, client.xaddr, GetSystemDateAndTime{}, &res)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	utc := res.Body.GetSystemDateAndTimeResponse.SystemDateAndTime.UTCDateTime
+	if utc == nil || utc.Date.Year == 0 {
+		return 0, errors.New("Device did not report its UTC time")
+	}
+
+	deviceTime := time.Date(utc.Date.Year, time.Month(utc.Date.Month), utc.Date.Day,
+		utc.Time.Hour, utc.Time.Minute, utc.Time.Second, 0, time.UTC)
+
+	// compare with the local time when the device is assumed to have answered
+	local := sent.Add(received.Sub(sent) / 2)
+	offset := deviceTime.Sub(local)
+
+	// the device time has a resolution of one second
+	if offset > -time.Second && offset < time.Second {
+		return 0, nil
+	}
+
+	return offset.Round(time.Second), nil
+}
+
+// resolveClock store the measured clock skew on the device, warning if it is
+// above onvif.clock_skew_warning
+func resolveClock(client *Client, dev *device.Device) {
+
+	dev.ClockSkew = client.ClockOffset()
+
+	threshold := viper.GetViper().GetDuration("onvif.clock_skew_warning")
+	if threshold <= 0 {
+		threshold = defaultClockSkewWarning
+	}
+
+	skew := dev.ClockSkew
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > threshold {
+		log.Printf("Warning: clock of device %s (%s) is off by %s", dev.Name, dev.Address, dev.ClockSkew)
+	}
+}
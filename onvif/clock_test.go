@@ -0,0 +1,35 @@
+package onvif
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkew(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"behind", -time.Hour},
+		{"ahead", 90 * time.Minute},
+		{"synced", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := NewAuthenticator([]Credential{{Username: "admin", Password: "secret"}})
+			camera, dev := resolveCamera(t, simulator.Config{
+				Username:    "admin",
+				Password:    "secret",
+				ClockOffset: test.offset,
+			}, auth)
+			defer camera.Stop()
+
+			assert.InDelta(t, test.offset.Seconds(), dev.ClockSkew.Seconds(), 2)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package onvif
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const consumerPath = "/onvif/events/"
+
+// NewConsumer init an endpoint receiving the WS-BaseNotification messages
+// sent by the devices. The endpoint listens on listen (eg. :8780) and is
+// advertised as baseURL, or with the local address routing to each device
+// if empty.
+func NewConsumer(listen string, baseURL string) *Consumer {
+	return &Consumer{
+		listen:   listen,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		handlers: map[string]func(device.Notification){},
+	}
+}
+
+// Consumer receive the notifications of the devices subscribed in EventsNotify mode
+type Consumer struct {
+	listen   string
+	baseURL  string
+	mut      sync.Mutex
+	handlers map[string]func(device.Notification)
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start listen for notifications
+func (c *Consumer) Start() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	listener, err := net.Listen("tcp", c.listen)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(consumerPath, c)
+
+	c.listener = listener
+	c.server = &http.Server{Handler: mux}
+
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Notification consumer failed: %s", err)
+		}
+	}(c.server)
+
+	return nil
+}
+
+// Stop close the endpoint
+func (c *Consumer) Stop() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := c.server.Shutdown(ctx)
+	c.server = nil
+	c.listener = nil
+	return err
+}
+
+// Register route the notifications of a device to handle, returning the
+// consumer address to subscribe with
+func (c *Consumer) Register(uuid string, xaddr string, handle func(device.Notification)) (string, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.listener == nil {
+		return "", fmt.Errorf("Notification consumer not started")
+	}
+
+	baseURL := c.baseURL
+	if baseURL == "" {
+		host, err := routeTo(xaddr)
+		if err != nil {
+			return "", err
+		}
+		port := c.listener.Addr().(*net.TCPAddr).Port
+		baseURL = "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	id := url.PathEscape(strings.TrimPrefix(uuid, "urn:uuid:"))
+	c.handlers[id] = handle
+
+	return baseURL + consumerPath + id, nil
+}
+
+// Unregister stop routing the notifications of a device
+func (c *Consumer) Unregister(uuid string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	delete(c.handlers, url.PathEscape(strings.TrimPrefix(uuid, "urn:uuid:")))
+}
+
+func (c *Consumer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.EscapedPath(), consumerPath)
+
+	c.mut.Lock()
+	handle, ok := c.handlers[id]
+	c.mut.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notify := Notify{}
+	if err := xml.Unmarshal(body, &notify); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, notification := range parseNotifications(notify.Body.Notify.NotificationMessage) {
+		handle(notification)
+	}
+
+	// Notify is a one-way operation
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// routeTo return the local address used to reach the host of xaddr
+func routeTo(xaddr string) (string, error) {
+
+	u, err := url.Parse(xaddr)
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	// no packet is sent, the socket only resolves the route
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
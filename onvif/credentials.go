@@ -0,0 +1,159 @@
+package onvif
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+// Credential a username and password, optionally restricted to devices
+// matching a UUID, an address (IP or CIDR) or a hardware model.
+// A credential without selectors applies to all devices.
+type Credential struct {
+	Username string
+	Password string
+	UUID     string
+	Address  string
+	Hardware string
+}
+
+// specificity rank a credential, more specific selectors first
+func (c Credential) specificity() int {
+	switch {
+	case c.UUID != "":
+		return 0
+	case c.Address != "":
+		return 1
+	case c.Hardware != "":
+		return 2
+	}
+	return 3
+}
+
+// Matches return true if the credential applies to the device
+func (c Credential) Matches(dev device.Device) bool {
+
+	if c.UUID != "" && strings.TrimPrefix(c.UUID, "urn:uuid:") != strings.TrimPrefix(dev.UUID, "urn:uuid:") {
+		return false
+	}
+
+	if c.Address != "" && !matchAddress(c.Address, dev.Address) {
+		return false
+	}
+
+	if c.Hardware != "" && !strings.EqualFold(c.Hardware, dev.Hardware) {
+		return false
+	}
+
+	return true
+}
+
+// matchAddress return true if the host of xaddr is the IP or in the CIDR selector
+func matchAddress(selector string, xaddr string) bool {
+
+	host := xaddr
+	if u, err := url.Parse(xaddr); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return strings.EqualFold(selector, host)
+	}
+
+	if _, network, err := net.ParseCIDR(selector); err == nil {
+		return network.Contains(ip)
+	}
+
+	return ip.Equal(net.ParseIP(selector))
+}
+
+// LoadCredentials read the credentials from the onvif.credentials configuration
+func LoadCredentials() ([]Credential, error) {
+	credentials := []Credential{}
+	err := viper.GetViper().UnmarshalKey("onvif.credentials", &credentials)
+	return credentials, err
+}
+
+// NewAuthenticator init an Authenticator trying the credentials in order
+func NewAuthenticator(credentials []Credential) *Authenticator {
+	return &Authenticator{
+		credentials: credentials,
+		remembered:  map[string]Credential{},
+	}
+}
+
+// Authenticator select the credentials to try for a device, remembering the
+// one that worked
+type Authenticator struct {
+	credentials []Credential
+	mut         sync.Mutex
+	remembered  map[string]Credential
+	trust       *Trust
+}
+
+// SetTrust set the verification of the HTTPS endpoints, the system CAs
+// being used if nil
+func (a *Authenticator) SetTrust(trust *Trust) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	a.trust = trust
+}
+
+// Trust return the verification of the HTTPS endpoints, nil if not set
+func (a *Authenticator) Trust() *Trust {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return a.trust
+}
+
+// Candidates return the credentials to try for a device: the remembered one
+// first, then the matching ones from the most specific selector to the global
+// ones, in configuration order. Without any, an anonymous access is tried.
+func (a *Authenticator) Candidates(dev device.Device) []Credential {
+
+	candidates := []Credential{}
+
+	a.mut.Lock()
+	remembered, ok := a.remembered[dev.UUID]
+	a.mut.Unlock()
+	if ok {
+		candidates = append(candidates, remembered)
+	}
+
+	for rank := 0; rank <= 3; rank++ {
+		for _, c := range a.credentials {
+			if c.specificity() != rank || !c.Matches(dev) {
+				continue
+			}
+			if ok && c == remembered {
+				continue
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = append(candidates, Credential{})
+	}
+
+	return candidates
+}
+
+// Remember store the credential that worked for a device
+func (a *Authenticator) Remember(uuid string, c Credential) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	a.remembered[uuid] = c
+}
+
+// Forget drop the credential stored for a device
+func (a *Authenticator) Forget(uuid string) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	delete(a.remembered, uuid)
+}
@@ -0,0 +1,41 @@
+package onvif
+
+import (
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidates(t *testing.T) {
+
+	auth := NewAuthenticator([]Credential{
+		{Username: "global"},
+		{Username: "model", Hardware: "IPC-HFW2431"},
+		{Username: "subnet", Address: "192.168.1.0/24"},
+		{Username: "other-subnet", Address: "10.0.0.0/8"},
+		{Username: "host", Address: "192.168.1.64"},
+		{Username: "uuid", UUID: "4d454930-0000-1000-8000-bcbac2a1b2c3"},
+	})
+
+	dev := device.Device{
+		UUID:     "urn:uuid:4d454930-0000-1000-8000-bcbac2a1b2c3",
+		Address:  "http://192.168.1.64/onvif/device_service",
+		Hardware: "IPC-HFW2431",
+	}
+
+	usernames := func() []string {
+		list := []string{}
+		for _, c := range auth.Candidates(dev) {
+			list = append(list, c.Username)
+		}
+		return list
+	}
+
+	assert.Equal(t, []string{"uuid", "subnet", "host", "model", "global"}, usernames())
+
+	auth.Remember(dev.UUID, Credential{Username: "model", Hardware: "IPC-HFW2431"})
+	assert.Equal(t, []string{"model", "uuid", "subnet", "host", "global"}, usernames())
+
+	assert.Equal(t, []Credential{{}}, NewAuthenticator(nil).Candidates(dev))
+}
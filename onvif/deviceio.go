@@ -0,0 +1,161 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	// RelayActive and RelayInactive are the relay logical states
+	RelayActive   = "active"
+	RelayInactive = "inactive"
+)
+
+// relayEndpoint return the DeviceIO service address, or the device service
+// address for the devices exposing the relays there only
+func relayEndpoint(ctx context.Context, client *Client) (string, bool) {
+	if client.HasService(ctx, "deviceio") {
+		xaddr, err := client.Endpoint(ctx, "deviceio")
+		if err == nil {
+			return xaddr, true
+		}
+	}
+	return client.xaddr, false
+}
+
+// RelayOutputs return the relay outputs of the device
+func RelayOutputs(ctx context.Context, client *Client) ([]device.RelayOutput, error) {
+
+	xaddr, deviceIO := relayEndpoint(ctx, client)
+
+	var req interface{} = GetDeviceRelayOutputs{}
+	if deviceIO {
+		req = GetRelayOutputs{}
+	}
+
+	res := GetRelayOutputsResponse{}
+	err := client.Call(ctx, xaddr, req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	relays := []device.RelayOutput{}
+	for _, relay := range res.Body.GetRelayOutputsResponse.RelayOutputs {
+		delay, _ := parseXSDDuration(relay.Properties.DelayTime)
+		relays = append(relays, device.RelayOutput{
+			Token:     strings.TrimSpace(relay.Token),
+			Mode:      strings.TrimSpace(relay.Properties.Mode),
+			DelayTime: delay,
+			IdleState: strings.TrimSpace(relay.Properties.IdleState),
+		})
+	}
+
+	return relays, nil
+}
+
+// SetRelay activate or deactivate a relay. A Monostable relay goes
+// back to inactive after its delay time.
+func SetRelay(ctx context.Context, client *Client, token string, active bool) error {
+
+	if token == "" {
+		return errors.New("Missing relay output token")
+	}
+
+	state := RelayInactive
+	if active {
+		state = RelayActive
+	}
+
+	xaddr, deviceIO := relayEndpoint(ctx, client)
+	if deviceIO {
+		return client.Call(ctx, xaddr, SetRelayOutputState{RelayOutputToken: token, LogicalState: state}, nil)
+	}
+	return client.Call(ctx, xaddr, SetDeviceRelayOutputState{RelayOutputToken: token, LogicalState: state}, nil)
+}
+
+// PulseRelay activate a relay for duration, then deactivate it, eg. to open
+// a door strike wired to a Bistable relay. It fails with the ctx error if ctx
+// is done before duration, the relay being deactivated anyway.
+func PulseRelay(ctx context.Context, client *Client, token string, duration time.Duration) error {
+
+	err := SetRelay(ctx, client, token, true)
+	if err != nil {
+		return err
+	}
+
+	// the pulse is cut short if ctx is done first
+	var expired error
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+		expired = ctx.Err()
+	}
+
+	// deactivate even if ctx is done, not to leave the relay active
+	deactivate, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := SetRelay(deactivate, client, token, false); err != nil {
+		return err
+	}
+	return expired
+}
+
+// DigitalInputs return the digital inputs of the device
+func DigitalInputs(ctx context.Context, client *Client) ([]device.DigitalInput, error) {
+
+	xaddr, err := client.Endpoint(ctx, "deviceio")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetDigitalInputsResponse{}
+	err = client.Call(ctx, xaddr, GetDigitalInputs{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := []device.DigitalInput{}
+	for _, input := range res.Body.GetDigitalInputsResponse.DigitalInputs {
+		inputs = append(inputs, device.DigitalInput{
+			Token:     strings.TrimSpace(input.Token),
+			IdleState: strings.TrimSpace(input.IdleState),
+		})
+	}
+
+	return inputs, nil
+}
+
+// resolveIO fill the device relay outputs and digital inputs. Without the
+// DeviceIO service, the relays are optionally listed by the device service.
+func resolveIO(ctx context.Context, client *Client, dev *device.Device) {
+
+	dev.RelayOutputs = nil
+	dev.DigitalInputs = nil
+
+	deviceIO := client.HasService(ctx, "deviceio")
+
+	relays, err := RelayOutputs(ctx, client)
+	if err != nil && deviceIO {
+		log.Printf("Relay outputs not available for %s: %s", dev.Name, err)
+	}
+	if len(relays) > 0 {
+		dev.RelayOutputs = relays
+	}
+
+	if !deviceIO {
+		return
+	}
+
+	inputs, err := DigitalInputs(ctx, client)
+	if err != nil {
+		log.Printf("Digital inputs not available for %s: %s", dev.Name, err)
+	}
+	if len(inputs) > 0 {
+		dev.DigitalInputs = inputs
+	}
+}
@@ -0,0 +1,55 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceIO(t *testing.T) {
+
+	camera, dev, client := connectCamera(t, simulator.Config{
+		DeviceIO: true,
+		RelayOutputs: []simulator.RelayOutput{
+			{Token: "Door", Mode: "Monostable", DelayTime: 5 * time.Second},
+			{Token: "Siren"},
+		},
+		DigitalInputs: []simulator.DigitalInput{{Token: "Button", IdleState: "open"}},
+	})
+	defer camera.Stop()
+
+	ctx := context.Background()
+
+	resolveIO(ctx, client, &dev)
+	assert.Equal(t, []device.RelayOutput{
+		{Token: "Door", Mode: "Monostable", DelayTime: 5 * time.Second, IdleState: "closed"},
+		{Token: "Siren", Mode: "Bistable", IdleState: "closed"},
+	}, dev.RelayOutputs)
+	assert.Equal(t, []device.DigitalInput{{Token: "Button", IdleState: "open"}}, dev.DigitalInputs)
+
+	assert.NoError(t, SetRelay(ctx, client, "Siren", true))
+	assert.True(t, camera.Relay("Siren"))
+	assert.NoError(t, PulseRelay(ctx, client, "Siren", 10*time.Millisecond))
+	assert.False(t, camera.Relay("Siren"))
+	assert.Error(t, SetRelay(ctx, client, "Missing", true))
+
+	// a pulse cut short by ctx fails, deactivating the relay
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, PulseRelay(short, client, "Siren", time.Minute))
+	assert.False(t, camera.Relay("Siren"))
+
+	// relays from the device service, without DeviceIO
+	legacy, legacyDev, legacyClient := connectCamera(t, simulator.Config{RelayOutputs: []simulator.RelayOutput{{}}})
+	defer legacy.Stop()
+
+	resolveIO(ctx, legacyClient, &legacyDev)
+	assert.Len(t, legacyDev.RelayOutputs, 1)
+	assert.Nil(t, legacyDev.DigitalInputs)
+	assert.NoError(t, SetRelay(ctx, legacyClient, "RelayOutput_1", true))
+	assert.True(t, legacy.Relay("RelayOutput_1"))
+}
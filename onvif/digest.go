@@ -0,0 +1,137 @@
+package onvif
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// digestChallenge an HTTP Digest WWW-Authenticate challenge (RFC 7616)
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	mut       sync.Mutex
+	nc        int
+}
+
+// parseDigestChallenge parse a WWW-Authenticate header, returning nil if it is not a Digest challenge
+func parseDigestChallenge(header string) *digestChallenge {
+
+	header = strings.TrimSpace(header)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Digest ") {
+		return nil
+	}
+
+	c := &digestChallenge{algorithm: "MD5"}
+	for _, param := range splitDigestParams(header[7:]) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		switch key {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "algorithm":
+			c.algorithm = strings.ToUpper(value)
+		case "qop":
+			// prefer auth over auth-int, as the body is not hashed
+			for _, qop := range strings.Split(value, ",") {
+				if strings.TrimSpace(qop) == "auth" {
+					c.qop = "auth"
+				}
+			}
+		}
+	}
+
+	if c.nonce == "" {
+		return nil
+	}
+
+	return c
+}
+
+// splitDigestParams split the comma separated parameters, honouring quoted values
+func splitDigestParams(s string) []string {
+	params := []string{}
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+// authorize return the Authorization header for a request
+func (c *digestChallenge) authorize(method, uri, username, password string) (string, error) {
+
+	var h func() hash.Hash
+	switch strings.TrimSuffix(c.algorithm, "-SESS") {
+	case "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return "", fmt.Errorf("Unsupported digest algorithm %s", c.algorithm)
+	}
+
+	digest := func(s string) string {
+		hasher := h()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	cnonceBytes := make([]byte, 8)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+
+	c.mut.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	c.mut.Unlock()
+
+	ha1 := digest(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(c.algorithm, "-SESS") {
+		ha1 = digest(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := digest(method + ":" + uri)
+
+	response := digest(ha1 + ":" + c.nonce + ":" + ha2)
+	if c.qop != "" {
+		response = digest(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		username, c.realm, c.nonce, uri, c.algorithm, response)
+	if c.opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	if c.qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+
+	return auth, nil
+}
@@ -1,11 +1,16 @@
 package discovery
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -17,36 +22,112 @@ import (
 var errWrongDiscoveryResponse = errors.New("Response is not related to discovery request")
 
 const (
-	maxDatagramSize = 8192
+	maxDatagramSize  = 8192
+	multicastAddress = "239.255.255.250:3702"
 )
 
-var cachedDevices = map[string]map[string]device.Device{}
-
 // NewDiscovery init a new discovery wrapper
-func NewDiscovery() *Discovery {
-	return &Discovery{}
+func NewDiscovery(options ...Option) *Discovery {
+	ws := &Discovery{
+		Matches:  make(chan device.OnChangeEvent),
+		interval: defaultInterval,
+		timeout:  defaultTimeout,
+		cache:    map[string]map[string]device.Device{},
+		seen:     map[string]map[string]device.Device{},
+		scanned:  map[string]time.Time{},
+	}
+	for _, option := range options {
+		option(ws)
+	}
+	return ws
 }
 
-// Discovery process wrapper
+// Discovery process wrapper. Each instance keeps its own state, so multiple
+// discoveries can run at the same time. A stopped Discovery cannot be restarted.
 type Discovery struct {
-	stop    chan bool
-	ticker  *time.Ticker
-	Matches chan device.OnChangeEvent
-	mut     sync.Mutex
+	// Matches emits the devices added, updated and removed. It is closed once
+	// the discovery is stopped
+	Matches         chan device.OnChangeEvent
+	mut             sync.Mutex
+	interval        time.Duration
+	timeout         time.Duration
+	addrs           []string
+	configuredProxy string
+	proxy           string
+	proxyID         string
+	// cache holds the devices by owner source, a single one per device, while
+	// seen holds the devices found by each source on its last scan, at scanned
+	cache   map[string]map[string]device.Device
+	seen    map[string]map[string]device.Device
+	scanned map[string]time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
 }
 
-// Stop blocks the discovery process
+// Stop cancel the discovery process and wait for it to complete
 func (ws *Discovery) Stop() {
-	if ws.stop != nil {
-		ws.stop <- true
+	ws.mut.Lock()
+	cancel := ws.cancel
+	done := ws.done
+	ws.mut.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Devices return a snapshot of the devices currently discovered
+func (ws *Discovery) Devices() []device.Device {
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	devices := []device.Device{}
+	for _, cached := range ws.cache {
+		for _, dev := range cached {
+			devices = append(devices, dev)
+		}
+	}
+	return devices
+}
+
+// ActiveProxy return the Discovery Proxy in use, either configured or
+// announced by Hello, or an empty string in ad hoc mode
+func (ws *Discovery) ActiveProxy() string {
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+	if ws.proxy != "" {
+		return ws.proxy
 	}
-	if ws.ticker != nil {
-		ws.ticker.Stop()
+	return ws.configuredProxy
+}
+
+// setProxy switch to managed mode using an announced Discovery Proxy
+func (ws *Discovery) setProxy(id string, xaddr string) {
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+	if ws.proxy != xaddr {
+		log.Printf("Using discovery proxy id=%s xaddr=%s", id, xaddr)
 	}
+	ws.proxy = xaddr
+	ws.proxyID = id
+}
+
+// resetProxy drop an announced Discovery Proxy, reverting to the configured one or ad hoc mode
+func (ws *Discovery) resetProxy() {
+	ws.mut.Lock()
+	defer ws.mut.Unlock()
+	ws.proxy = ""
+	ws.proxyID = ""
 }
 
 func (ws *Discovery) getAddrs() ([]string, error) {
 
+	if len(ws.addrs) > 0 {
+		return ws.addrs, nil
+	}
+
 	addrs := []string{}
 
 	interfaces, err := net.InterfaceAddrs()
@@ -65,43 +146,78 @@ func (ws *Discovery) getAddrs() ([]string, error) {
 	return addrs, err
 }
 
-// Start send a WS-Discovery message and wait for all matching device to respond
-func (ws *Discovery) Start() error {
-
-	ws.stop = make(chan bool)
-	ws.Matches = make(chan device.OnChangeEvent)
-	ws.ticker = time.NewTicker(5 * time.Second)
+// Start send a WS-Discovery message and wait for all matching device to respond.
+// Probes are repeated until ctx is cancelled or Stop is called.
+func (ws *Discovery) Start(ctx context.Context) error {
 
 	addrs, err := ws.getAddrs()
 	if err != nil {
 		return fmt.Errorf("Failed to get addrs: %s", err)
 	}
 
-	discover := func() {
+	ws.mut.Lock()
+	if ws.cancel != nil {
+		ws.mut.Unlock()
+		return errors.New("Discovery already started")
+	}
+	ctx, ws.cancel = context.WithCancel(ctx)
+	ws.done = make(chan struct{})
+	ws.mut.Unlock()
+
+	wg := sync.WaitGroup{}
+
+	discoverAdHoc := func() {
 		for _, addr := range addrs {
+			wg.Add(1)
 			go func(addr string) {
+				defer wg.Done()
 				// log.Printf("Discovering on addr=%s\n", addr)
-				ws.mut.Lock()
-				if _, ok := cachedDevices[addr]; !ok {
-					cachedDevices[addr] = map[string]device.Device{}
-				}
-				ws.mut.Unlock()
-				err := ws.runDiscovery(addr)
-				if err != nil {
+				err := ws.runDiscovery(ctx, addr)
+				if err != nil && ctx.Err() == nil {
 					log.Printf("discover error on addr=%s: %s", addr, err)
 				}
 			}(addr)
 		}
 	}
 
+	discover := func() {
+		proxy := ws.ActiveProxy()
+		if proxy == "" {
+			discoverAdHoc()
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ws.runManagedDiscovery(ctx, proxy)
+			if err != nil && ctx.Err() == nil {
+				// an unreachable proxy reverts the client to ad hoc mode
+				log.Printf("discover error on proxy=%s: %s", proxy, err)
+				ws.resetProxy()
+				discoverAdHoc()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ws.listenHello(ctx)
+	}()
+
 	discover()
 	go func() {
+		ticker := time.NewTicker(ws.interval)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-ws.stop:
+			case <-ctx.Done():
+				wg.Wait()
+				close(ws.Matches)
+				close(ws.done)
 				log.Println("Stopped discovery")
 				return
-			case <-ws.ticker.C:
+			case <-ticker.C:
 				discover()
 				break
 			}
@@ -112,7 +228,59 @@ func (ws *Discovery) Start() error {
 	return nil
 }
 
-func (ws *Discovery) runDiscovery(addr string) error {
+// listenHello listen for multicast Hello and Bye messages from Discovery Proxies
+func (ws *Discovery) listenHello(ctx context.Context) {
+
+	groupAddress, err := net.ResolveUDPAddr("udp4", multicastAddress)
+	if err != nil {
+		log.Printf("Failed to resolve multicast address: %s", err)
+		return
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddress)
+	if err != nil {
+		log.Printf("Failed to listen for Hello messages: %s", err)
+		return
+	}
+	conn.SetReadBuffer(maxDatagramSize)
+	defer closeOnDone(ctx, conn)()
+
+	for {
+		buffer := make([]byte, maxDatagramSize)
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		ws.handleAnnouncement(buffer[:n])
+	}
+}
+
+// handleAnnouncement switch discovery mode on Hello or Bye messages of a Discovery Proxy.
+// It returns true if the message was a proxy announcement.
+func (ws *Discovery) handleAnnouncement(buffer []byte) bool {
+
+	id, xaddr, hello, ok := parseProxyAnnouncement(buffer)
+	if !ok {
+		return false
+	}
+
+	if hello {
+		ws.setProxy(id, xaddr)
+		return true
+	}
+
+	ws.mut.Lock()
+	leaving := ws.proxyID != "" && ws.proxyID == id
+	ws.mut.Unlock()
+	if leaving {
+		log.Printf("Discovery proxy id=%s left", id)
+		ws.resetProxy()
+	}
+
+	return true
+}
+
+func (ws *Discovery) runDiscovery(ctx context.Context, addr string) error {
 
 	requestUUID, err := uuid.NewV4()
 	if err != nil {
@@ -128,7 +296,7 @@ func (ws *Discovery) runDiscovery(addr string) error {
 		return err
 	}
 
-	multicastAddress, err := net.ResolveUDPAddr("udp4", "239.255.255.250:3702")
+	multicastAddress, err := net.ResolveUDPAddr("udp4", multicastAddress)
 	if err != nil {
 		return err
 	}
@@ -138,10 +306,10 @@ func (ws *Discovery) runDiscovery(addr string) error {
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
 
 	// Set connection's timeout
-	err = conn.SetDeadline(time.Now().Add(time.Second * 2))
+	err = conn.SetDeadline(time.Now().Add(ws.timeout))
 	if err != nil {
 		return err
 	}
@@ -157,7 +325,7 @@ func (ws *Discovery) runDiscovery(addr string) error {
 	for {
 
 		buffer := make([]byte, 10*1024)
-		_, _, err = conn.ReadFromUDP(buffer)
+		n, _, err := conn.ReadFromUDP(buffer)
 
 		if err != nil {
 			if udpErr, ok := err.(net.Error); ok && udpErr.Timeout() {
@@ -167,111 +335,272 @@ func (ws *Discovery) runDiscovery(addr string) error {
 			}
 		}
 
-		dev, err := parseResponse(requestID, buffer)
+		// a Discovery Proxy answers a multicast Probe with a Hello
+		if ws.handleAnnouncement(buffer[:n]) {
+			continue
+		}
+
+		devices, err := parseResponse(requestID, buffer[:n])
 		if err != nil && err != errWrongDiscoveryResponse {
 			return err
 		}
 
-		// matches <- dev
+		for _, dev := range devices {
+			localCache[dev.UUID] = dev
+		}
+	}
+
+	ws.emit(ctx, ws.updateCache(addr, localCache))
+
+	// log.Printf("Completed discovery on %s\n", addr)
+	return nil
+}
+
+// runManagedDiscovery send a Probe to a Discovery Proxy over SOAP/HTTP
+func (ws *Discovery) runManagedDiscovery(ctx context.Context, proxy string) error {
+
+	requestUUID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	requestID := requestUUID.String()
+	request := CreateManagedProbeMessage(requestID, proxy)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, proxy, strings.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/soap+xml; charset=utf-8")
+
+	client := &http.Client{Timeout: ws.timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("Probe failed: %s", res.Status)
+	}
+
+	devices, err := parseResponse(requestID, body)
+	if err != nil && err != errWrongDiscoveryResponse {
+		return err
+	}
+
+	localCache := map[string]device.Device{}
+	for _, dev := range devices {
 		localCache[dev.UUID] = dev
-		// cachedDevices[addr][dev.UUID] = dev
 	}
 
+	ws.emit(ctx, ws.updateCache(proxy, localCache))
+
+	return nil
+}
+
+// updateCache compare the devices found on a source (interface address or
+// proxy) with the cached ones and return the changes. A device found by
+// several sources is owned by the first one, and moved to another source only
+// once removed from its owner, or if its owner is not scanned anymore.
+func (ws *Discovery) updateCache(source string, localCache map[string]device.Device) []device.OnChangeEvent {
+
+	events := []device.OnChangeEvent{}
 	removed := map[string]bool{}
 
 	ws.mut.Lock()
+	defer ws.mut.Unlock()
+
+	now := time.Now()
+	ws.seen[source] = localCache
+	ws.scanned[source] = now
 
-	for uuid := range cachedDevices[addr] {
+	if _, ok := ws.cache[source]; !ok {
+		ws.cache[source] = map[string]device.Device{}
+	}
+
+	for uuid := range ws.cache[source] {
 		removed[uuid] = true
 	}
 
 	for uuid, dev := range localCache {
-		if _, ok := cachedDevices[addr][uuid]; ok {
+		if cached, ok := ws.cache[source][uuid]; ok {
 			removed[uuid] = false
+			if !reflect.DeepEqual(cached, dev) {
+				// updated, eg. new address, scopes or metadata version
+				ws.cache[source][uuid] = dev
+				events = append(events, device.OnChanged(dev, device.DeviceUpdated))
+			}
+			continue
+		}
+		// already known from another source, eg. a camera answering on two
+		// interfaces, or switching between ad hoc and managed mode
+		if owner, cached, ok := ws.findOwner(source, uuid); ok {
+			if !ws.stale(owner, now) {
+				continue
+			}
+			delete(ws.cache[owner], uuid)
+			ws.cache[source][uuid] = dev
+			if !reflect.DeepEqual(cached, dev) {
+				events = append(events, device.OnChanged(dev, device.DeviceUpdated))
+			}
 			continue
 		}
 		// added
-		cachedDevices[addr][uuid] = dev
-		ws.Matches <- device.OnChanged(cachedDevices[addr][uuid], device.DeviceAdded)
+		ws.cache[source][uuid] = dev
+		events = append(events, device.OnChanged(dev, device.DeviceAdded))
 	}
 
 	for uuid, isRemoved := range removed {
-		if isRemoved {
-			// removed
-			ws.Matches <- device.OnChanged(cachedDevices[addr][uuid], device.DeviceRemoved)
-			delete(cachedDevices[addr], uuid)
+		if !isRemoved {
+			continue
+		}
+		cached := ws.cache[source][uuid]
+		delete(ws.cache[source], uuid)
+		// moved to another source still finding it
+		if other, dev, ok := ws.findSeen(source, uuid, now); ok {
+			ws.cache[other][uuid] = dev
+			if !reflect.DeepEqual(cached, dev) {
+				events = append(events, device.OnChanged(dev, device.DeviceUpdated))
+			}
+			continue
+		}
+		// removed
+		events = append(events, device.OnChanged(cached, device.DeviceRemoved))
+	}
+
+	return events
+}
 
+// findOwner return the other source owning a cached device
+func (ws *Discovery) findOwner(source string, uuid string) (string, device.Device, bool) {
+	for other, devices := range ws.cache {
+		if other == source {
+			continue
+		}
+		if dev, ok := devices[uuid]; ok {
+			return other, dev, true
 		}
 	}
+	return "", device.Device{}, false
+}
 
-	ws.mut.Unlock()
+// findSeen return another source which found a device on its last scan,
+// ignoring the sources not scanned anymore
+func (ws *Discovery) findSeen(source string, uuid string, now time.Time) (string, device.Device, bool) {
+	for other, devices := range ws.seen {
+		if other == source || ws.stale(other, now) {
+			continue
+		}
+		if dev, ok := devices[uuid]; ok {
+			return other, dev, true
+		}
+	}
+	return "", device.Device{}, false
+}
 
-	// log.Printf("Completed discovery on %s\n", addr)
-	return nil
+// stale return true if a source was not scanned during the last two
+// intervals, eg. the interfaces once switched to managed mode
+func (ws *Discovery) stale(source string, now time.Time) bool {
+	scanned, ok := ws.scanned[source]
+	return !ok || now.Sub(scanned) > 2*ws.interval+ws.timeout
 }
 
-func parseResponse(messageID string, buffer []byte) (device.Device, error) {
+// emit send the events on Matches, giving up if ctx is cancelled
+func (ws *Discovery) emit(ctx context.Context, events []device.OnChangeEvent) {
+	for _, ev := range events {
+		select {
+		case ws.Matches <- ev:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// closeOnDone close conn when ctx is cancelled, so blocking reads return.
+// The returned function closes conn and must be called once done with it.
+func closeOnDone(ctx context.Context, conn io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func parseResponse(messageID string, buffer []byte) ([]device.Device, error) {
 
 	response := ProbeMatchEnvelope{}
 
 	err := xml.Unmarshal(buffer, &response)
 	if err != nil {
-		return device.Device{}, err
+		return nil, err
 	}
 
-	relatesTo := strings.ReplaceAll(strings.Trim(response.Header.RelatesTo, "\n \t"), "uuid:", "")
-	if relatesTo != messageID {
+	relatesTo := trimUUID(response.Header.RelatesTo)
+	if relatesTo != trimUUID(messageID) {
 		log.Printf("Skip unrelated response [%s<>%s]\n", relatesTo, messageID)
-		return device.Device{}, nil
+		return nil, errWrongDiscoveryResponse
 	}
 
-	dev := device.Device{}
+	devices := []device.Device{}
 	for _, probeMatch := range response.Body.ProbeMatches.ProbeMatch {
 
-		addrs := strings.Split(probeMatch.XAddrs, " ")
+		addrs := strings.Fields(probeMatch.XAddrs)
 		if len(addrs) == 0 {
 			continue
 		}
 
-		dev.UUID = probeMatch.EndpointReference.Address
+		dev := device.Device{}
+		dev.UUID = strings.TrimSpace(probeMatch.EndpointReference.Address)
 		dev.Address = addrs[0]
-		dev.Types = []string{}
+		dev.XAddrs = addrs
+		dev.MetadataVersion = strings.TrimSpace(probeMatch.MetadataVersion)
 
-		scopes := strings.Split(probeMatch.Scopes, " ")
-		for _, scope := range scopes {
+		parseScopes(&dev, probeMatch.Scopes)
 
-			scope = strings.Replace(scope, "onvif://www.onvif.org/", "", 1)
-			if len(scope) == 0 {
-				continue
-			}
+		devices = append(devices, dev)
+	}
 
-			pts := strings.Split(scope, "/")
-			switch pts[0] {
-			case "name":
-				{
-					dev.Name = pts[1]
-				}
-			case "hardware":
-				{
-					dev.Hardware = pts[1]
-				}
-			case "type":
-				{
-					dev.Types = append(dev.Types, pts[1])
-				}
-			case "location":
-				{
-					if len(pts) > 2 {
-						if pts[1] == "country" {
-							dev.Country = pts[2]
-						}
-					}
-				}
-			}
+	return devices, nil
+}
 
-		}
+// parseProxyAnnouncement parse a Hello or Bye message sent by a Discovery Proxy,
+// returning its endpoint reference, its first XAddr and if it is an Hello
+func parseProxyAnnouncement(buffer []byte) (string, string, bool, bool) {
 
+	message := ProbeMatchEnvelope{}
+	if err := xml.Unmarshal(buffer, &message); err != nil {
+		return "", "", false, false
 	}
 
-	return dev, nil
+	switch strings.TrimSpace(message.Header.Action.Text) {
+	case ActionHello:
+		hello := message.Body.Hello
+		addrs := strings.Fields(hello.XAddrs)
+		if !hello.isDiscoveryProxy() || len(addrs) == 0 {
+			return "", "", false, false
+		}
+		return strings.TrimSpace(hello.EndpointReference.Address), addrs[0], true, true
+	case ActionBye:
+		bye := message.Body.Bye
+		return strings.TrimSpace(bye.EndpointReference.Address), "", false, true
+	}
+
+	return "", "", false, false
+}
+
+// trimUUID strip spaces and the uuid: prefix from a message ID
+func trimUUID(id string) string {
+	return strings.TrimPrefix(strings.TrimSpace(id), "uuid:")
 }
@@ -1,9 +1,12 @@
 package discovery
 
 import (
+	"context"
 	"io/ioutil"
 	"testing"
+	"time"
 
+	"github.com/muka/camd/device"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,8 +18,152 @@ func TestParseResponse(t *testing.T) {
 	}
 
 	messageID := "uuid:0a6dc791-2be6-4991-9af1-454778a1917a"
-	device, err := parseResponse(messageID, xml)
+	devices, err := parseResponse(messageID, xml)
+	if err != nil {
+		t.Fatalf("Failed to parse response: %s", err)
+	}
+
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "http://prn-example/PRN42/b42-1668-a", devices[0].Address)
+
+}
+
+func TestParseResponseScopes(t *testing.T) {
+
+	xml, err := ioutil.ReadFile("./probe_match_onvif_example.xml")
+	if err != nil {
+		t.Fatalf("Cannot read xml: %s", err)
+	}
+
+	messageID := "0a6dc791-2be6-4991-9af1-454778a1917a"
+	devices, err := parseResponse(messageID, xml)
+	if err != nil {
+		t.Fatalf("Failed to parse response: %s", err)
+	}
+
+	assert.Len(t, devices, 1)
+	dev := devices[0]
+
+	assert.Equal(t, "http://192.168.1.64/onvif/device_service", dev.Address)
+	assert.Equal(t, "My Camera", dev.Name)
+	assert.Equal(t, "IPC-HFW/2431", dev.Hardware)
+	assert.Equal(t, "italy", dev.Country)
+	assert.Equal(t, "Trento", dev.City)
+	assert.Equal(t, "Building 1/Floor 2", dev.Location)
+	assert.Equal(t, "bc:ba:c2:a1:b2:c3", dev.MAC)
+	assert.Equal(t, []string{"video_encoder", "Network_Video_Transmitter"}, dev.Types)
+	assert.Equal(t, []string{"S", "T", "G"}, dev.OnvifProfiles)
+	assert.Equal(t, "unique_identifier", dev.Scopes["extension"])
+	assert.Contains(t, dev.Scopes, "ldap:///ou=engineering,o=examplecom,c=us")
+}
+
+func TestUpdateCacheDeviceUpdated(t *testing.T) {
+
+	ws := NewDiscovery()
+
+	source := "192.168.1.2"
+	dev := device.Device{
+		UUID:            "urn:uuid:4d454930-0000-1000-8000-bcbac2a1b2c3",
+		Address:         "http://192.168.1.64/onvif/device_service",
+		MetadataVersion: "1",
+	}
+
+	events := ws.updateCache(source, map[string]device.Device{dev.UUID: dev})
+	assert.Len(t, events, 1)
+	assert.Equal(t, device.DeviceAdded, events[0].Event)
+
+	// unchanged
+	events = ws.updateCache(source, map[string]device.Device{dev.UUID: dev})
+	assert.Len(t, events, 0)
+
+	dev.Address = "http://192.168.1.65/onvif/device_service"
+	dev.MetadataVersion = "2"
+	events = ws.updateCache(source, map[string]device.Device{dev.UUID: dev})
+	assert.Len(t, events, 1)
+	assert.Equal(t, device.DeviceUpdated, events[0].Event)
+	assert.Equal(t, dev.Address, events[0].Device.Address)
+
+	assert.Len(t, ws.Devices(), 1)
 
-	assert.Equal(t, "http://prn-example/PRN42/b42-1668-a", device.Address)
+	events = ws.updateCache(source, map[string]device.Device{})
+	assert.Len(t, events, 1)
+	assert.Equal(t, device.DeviceRemoved, events[0].Event)
+	assert.Len(t, ws.Devices(), 0)
+}
+
+func TestUpdateCacheSources(t *testing.T) {
+
+	ws := NewDiscovery()
+
+	dev := device.Device{
+		UUID:    "urn:uuid:4d454930-0000-1000-8000-bcbac2a1b2c3",
+		Address: "http://192.168.1.64/onvif/device_service",
+	}
+	found := func(dev device.Device) map[string]device.Device {
+		return map[string]device.Device{dev.UUID: dev}
+	}
+
+	// a camera answering on two interfaces is owned by the first one
+	events := ws.updateCache("192.168.1.2", found(dev))
+	assert.Len(t, events, 1)
+	assert.Equal(t, device.DeviceAdded, events[0].Event)
+	other := dev
+	other.Address = "http://10.0.0.64/onvif/device_service"
+	for i := 0; i < 2; i++ {
+		assert.Len(t, ws.updateCache("10.0.0.2", found(other)), 0)
+		assert.Len(t, ws.updateCache("192.168.1.2", found(dev)), 0)
+	}
+
+	// and moved to the other one once removed
+	events = ws.updateCache("192.168.1.2", map[string]device.Device{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, device.DeviceUpdated, events[0].Event)
+		assert.Equal(t, other.Address, events[0].Device.Address)
+	}
+	assert.Len(t, ws.updateCache("10.0.0.2", found(other)), 0)
+	assert.Len(t, ws.Devices(), 1)
+
+	// switched to managed mode, the interfaces are not scanned anymore
+	ws.scanned["10.0.0.2"] = time.Now().Add(-time.Hour)
+	managed := other
+	managed.MetadataVersion = "2"
+	events = ws.updateCache("http://proxy/discovery", found(managed))
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, device.DeviceUpdated, events[0].Event)
+		assert.Equal(t, "2", events[0].Device.MetadataVersion)
+	}
+	assert.Len(t, ws.Devices(), 1)
+
+	events = ws.updateCache("http://proxy/discovery", map[string]device.Device{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, device.DeviceRemoved, events[0].Event)
+	}
+	assert.Len(t, ws.Devices(), 0)
+}
+
+func TestStopDiscovery(t *testing.T) {
+
+	ws := NewDiscovery(WithAddrs("127.0.0.1"), WithInterval(10*time.Millisecond))
+
+	err := ws.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to start discovery: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ws.Stop()
+		// a second Stop must not block
+		ws.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
 
+	_, ok := <-ws.Matches
+	assert.False(t, ok)
 }
@@ -0,0 +1,45 @@
+package discovery
+
+import "time"
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+// Option configure a Discovery instance
+type Option func(*Discovery)
+
+// WithProxy set the SOAP/HTTP endpoint of a Discovery Proxy. Probes are then
+// sent to the proxy (managed mode) instead of multicast (ad hoc mode)
+func WithProxy(proxy string) Option {
+	return func(ws *Discovery) {
+		ws.configuredProxy = proxy
+	}
+}
+
+// WithInterval set the delay between two probes
+func WithInterval(interval time.Duration) Option {
+	return func(ws *Discovery) {
+		if interval > 0 {
+			ws.interval = interval
+		}
+	}
+}
+
+// WithTimeout set how long to wait for probe matches
+func WithTimeout(timeout time.Duration) Option {
+	return func(ws *Discovery) {
+		if timeout > 0 {
+			ws.timeout = timeout
+		}
+	}
+}
+
+// WithAddrs set the local IPv4 addresses to probe from, instead of all the
+// non-loopback interface addresses
+func WithAddrs(addrs ...string) Option {
+	return func(ws *Discovery) {
+		ws.addrs = addrs
+	}
+}
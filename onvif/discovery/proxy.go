@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+// NewProxy init a minimal Discovery Proxy stand-in, identified by the id endpoint reference
+func NewProxy(id string) *Proxy {
+	return &Proxy{
+		ID:      id,
+		matches: map[string]ProbeMatch{},
+	}
+}
+
+// Proxy a minimal Discovery Proxy answering managed Probes over SOAP/HTTP
+// with the target services registered on it. It is meant for local testing.
+type Proxy struct {
+	ID      string
+	mut     sync.Mutex
+	matches map[string]ProbeMatch
+}
+
+// Add register a target service on the proxy
+func (p *Proxy) Add(match ProbeMatch) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.matches[strings.TrimSpace(match.EndpointReference.Address)] = match
+}
+
+// Remove unregister a target service by its endpoint reference address
+func (p *Proxy) Remove(address string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	delete(p.matches, strings.TrimSpace(address))
+}
+
+// ServeHTTP answer a Probe with the registered target services
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	probe := ProbeMatchEnvelope{}
+	if err := xml.Unmarshal(body, &probe); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(probe.Header.Action.Text) != ActionProbe {
+		http.Error(w, "Unsupported action", http.StatusBadRequest)
+		return
+	}
+
+	messageID, err := uuid.NewV4()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mut.Lock()
+	matches := []ProbeMatch{}
+	for _, match := range p.matches {
+		matches = append(matches, match)
+	}
+	p.mut.Unlock()
+
+	w.Header().Set("content-type", "application/soap+xml; charset=utf-8")
+	w.Write([]byte(CreateProbeMatchesMessage(messageID.String(), probe.Header.MessageID, matches)))
+}
+
+// Hello return the Hello message announcing the proxy at xaddr
+func (p *Proxy) Hello(xaddr string) (string, error) {
+	messageID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	match := ProbeMatch{
+		Types:             "d:" + discoveryProxyType,
+		XAddrs:            xaddr,
+		EndpointReference: EndpointReference{Address: p.ID},
+	}
+	return CreateHelloMessage(messageID.String(), "", match), nil
+}
+
+// Announce multicast an Hello message announcing the proxy at xaddr
+func (p *Proxy) Announce(xaddr string) error {
+
+	hello, err := p.Hello(xaddr)
+	if err != nil {
+		return err
+	}
+
+	groupAddress, err := net.ResolveUDPAddr("udp4", multicastAddress)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(hello))
+	return err
+}
@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagedDiscovery(t *testing.T) {
+
+	proxy := NewProxy("urn:uuid:a7e6e2b0-7b4e-4d0a-9f54-2b3c9a4c1f01")
+
+	match := ProbeMatch{
+		Types:  "dn:NetworkVideoTransmitter",
+		Scopes: "onvif://www.onvif.org/name/Proxied%20Camera",
+		XAddrs: "http://192.168.1.100/onvif/device_service",
+		EndpointReference: EndpointReference{
+			Address: "urn:uuid:b1c2d3e4-0000-1000-8000-001122334455",
+		},
+	}
+	proxy.Add(match)
+
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	ws := NewDiscovery()
+	ws.Matches = make(chan device.OnChangeEvent, 10)
+
+	err := ws.runManagedDiscovery(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Managed discovery failed: %s", err)
+	}
+
+	ev := <-ws.Matches
+	assert.Equal(t, device.DeviceAdded, ev.Event)
+	assert.Equal(t, "Proxied Camera", ev.Device.Name)
+	assert.Equal(t, "http://192.168.1.100/onvif/device_service", ev.Device.Address)
+
+	proxy.Remove(match.EndpointReference.Address)
+
+	err = ws.runManagedDiscovery(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Managed discovery failed: %s", err)
+	}
+
+	ev = <-ws.Matches
+	assert.Equal(t, device.DeviceRemoved, ev.Event)
+}
+
+func TestProxyHello(t *testing.T) {
+
+	proxy := NewProxy("urn:uuid:a7e6e2b0-7b4e-4d0a-9f54-2b3c9a4c1f01")
+
+	hello, err := proxy.Hello("http://192.168.1.2:5357/proxy")
+	if err != nil {
+		t.Fatalf("Failed to create Hello: %s", err)
+	}
+
+	ws := NewDiscovery()
+	assert.True(t, ws.handleAnnouncement([]byte(hello)))
+	assert.Equal(t, "http://192.168.1.2:5357/proxy", ws.ActiveProxy())
+
+	bye := CreateByeMessage("c6f1a8a2-1d1e-4d6b-8d1f-6a7b8c9d0e1f", ProbeMatch{
+		EndpointReference: EndpointReference{Address: proxy.ID},
+	})
+	assert.True(t, ws.handleAnnouncement([]byte(bye)))
+	assert.Equal(t, "", ws.ActiveProxy())
+}
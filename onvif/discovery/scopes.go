@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/muka/camd/device"
+)
+
+const onvifScopePrefix = "onvif://www.onvif.org/"
+
+// onvifProfileAliases maps Profile scope values to the ONVIF profile letter
+var onvifProfileAliases = map[string]string{
+	"streaming": "S",
+}
+
+// parseScopes fill the device fields with the values from a WS-Discovery
+// scopes list. Unknown scopes are kept in the Device.Scopes map.
+func parseScopes(dev *device.Device, scopes string) {
+
+	if dev.Types == nil {
+		dev.Types = []string{}
+	}
+	if dev.OnvifProfiles == nil {
+		dev.OnvifProfiles = []string{}
+	}
+	if dev.Scopes == nil {
+		dev.Scopes = map[string]string{}
+	}
+
+	for _, scope := range strings.Fields(scopes) {
+
+		if !strings.HasPrefix(scope, onvifScopePrefix) {
+			dev.Scopes[scope] = ""
+			continue
+		}
+
+		pts := strings.Split(strings.TrimPrefix(scope, onvifScopePrefix), "/")
+		for i := range pts {
+			pts[i] = decodeScopeValue(pts[i])
+		}
+
+		if len(pts) < 2 {
+			dev.Scopes[pts[0]] = ""
+			continue
+		}
+
+		value := strings.Join(pts[1:], "/")
+
+		switch strings.ToLower(pts[0]) {
+		case "name":
+			dev.Name = value
+		case "hardware":
+			dev.Hardware = value
+		case "type":
+			dev.Types = append(dev.Types, value)
+		case "mac":
+			dev.MAC = value
+		case "profile":
+			profile := value
+			if alias, ok := onvifProfileAliases[strings.ToLower(profile)]; ok {
+				profile = alias
+			}
+			dev.OnvifProfiles = appendUnique(dev.OnvifProfiles, profile)
+		case "location":
+			if len(pts) > 2 {
+				switch strings.ToLower(pts[1]) {
+				case "country":
+					dev.Country = strings.Join(pts[2:], "/")
+					continue
+				case "city":
+					dev.City = strings.Join(pts[2:], "/")
+					continue
+				}
+			}
+			if dev.Location == "" {
+				dev.Location = value
+			} else {
+				dev.Location += ", " + value
+			}
+		default:
+			dev.Scopes[strings.Join(pts[:len(pts)-1], "/")] = pts[len(pts)-1]
+		}
+	}
+}
+
+// decodeScopeValue percent-decode a scope segment, returning it as is if invalid
+func decodeScopeValue(value string) string {
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
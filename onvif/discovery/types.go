@@ -1,10 +1,91 @@
 package discovery
 
-import "encoding/xml"
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+const (
+	// ActionProbe WS-Discovery Probe action
+	ActionProbe = "http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe"
+	// ActionProbeMatches WS-Discovery ProbeMatches action
+	ActionProbeMatches = "http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches"
+	// ActionHello WS-Discovery Hello action
+	ActionHello = "http://schemas.xmlsoap.org/ws/2005/04/discovery/Hello"
+	// ActionBye WS-Discovery Bye action
+	ActionBye = "http://schemas.xmlsoap.org/ws/2005/04/discovery/Bye"
+
+	// anonymousTo is the To header for replies to the sender
+	anonymousTo = "http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous"
+	// discoveryTo is the To header for ad hoc (multicast) messages
+	discoveryTo = "urn:schemas-xmlsoap-org:ws:2005:04:discovery"
+	// discoveryProxyType is the type announced by a Discovery Proxy
+	discoveryProxyType = "DiscoveryProxy"
+)
 
 //CreateProbeMessage return a string with the XML payload
 func CreateProbeMessage(uuid string) string {
-	return `<?xml version="1.0" encoding="UTF-8"?><Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing"><Header><a:Action mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action><a:MessageID>uuid:` + uuid + `</a:MessageID><a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo><a:To mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To></Header><Body><Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery"><d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dp0="http://www.onvif.org/ver10/network/wsdl">dp0:NetworkVideoTransmitter</d:Types></Probe></Body></Envelope>`
+	return createProbeMessage(uuid, discoveryTo)
+}
+
+//CreateManagedProbeMessage return a Probe XML payload addressed to a Discovery Proxy
+func CreateManagedProbeMessage(uuid string, proxy string) string {
+	return createProbeMessage(uuid, proxy)
+}
+
+func createProbeMessage(uuid string, to string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing"><Header><a:Action mustUnderstand="1">` + ActionProbe + `</a:Action><a:MessageID>uuid:` + uuid + `</a:MessageID><a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo><a:To mustUnderstand="1">` + xmlEscape(to) + `</a:To></Header><Body><Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery"><d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dp0="http://www.onvif.org/ver10/network/wsdl">dp0:NetworkVideoTransmitter</d:Types></Probe></Body></Envelope>`
+}
+
+//CreateProbeMatchesMessage return a ProbeMatches XML payload replying to a Probe
+func CreateProbeMatchesMessage(messageID string, relatesTo string, matches []ProbeMatch) string {
+	body := ""
+	for _, match := range matches {
+		body += `<d:ProbeMatch>` + match.innerXML() + `</d:ProbeMatch>`
+	}
+	return createMessage(ActionProbeMatches, messageID, relatesTo, anonymousTo, `<d:ProbeMatches>`+body+`</d:ProbeMatches>`)
+}
+
+//CreateHelloMessage return a Hello XML payload announcing a target service or a Discovery Proxy
+func CreateHelloMessage(messageID string, relatesTo string, match ProbeMatch) string {
+	return createMessage(ActionHello, messageID, relatesTo, discoveryTo, `<d:Hello>`+match.innerXML()+`</d:Hello>`)
+}
+
+//CreateByeMessage return a Bye XML payload announcing a target service is leaving
+func CreateByeMessage(messageID string, match ProbeMatch) string {
+	return createMessage(ActionBye, messageID, "", discoveryTo, `<d:Bye>`+match.innerXML()+`</d:Bye>`)
+}
+
+func createMessage(action, messageID, relatesTo, to, body string) string {
+	header := `<a:Action mustUnderstand="1">` + action + `</a:Action><a:MessageID>uuid:` + trimUUID(messageID) + `</a:MessageID>`
+	if relatesTo != "" {
+		header += `<a:RelatesTo>uuid:` + trimUUID(relatesTo) + `</a:RelatesTo>`
+	}
+	header += `<a:To mustUnderstand="1">` + xmlEscape(to) + `</a:To>`
+	return `<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl"><s:Header>` + header + `</s:Header><s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+func xmlEscape(value string) string {
+	buf := bytes.Buffer{}
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+//EndpointReference a WS-Addressing endpoint reference
+type EndpointReference struct {
+	Text    string `xml:",chardata"`
+	Address string `xml:"Address"`
+}
+
+//ProbeMatch a WS-Discovery target service description, as found in ProbeMatch and Hello messages
+type ProbeMatch struct {
+	Text              string            `xml:",chardata"`
+	EndpointReference EndpointReference `xml:"EndpointReference"`
+	Types             string            `xml:"Types"`
+	Scopes            string            `xml:"Scopes"`
+	XAddrs            string            `xml:"XAddrs"`
+	MetadataVersion   string            `xml:"MetadataVersion"`
 }
 
 //ProbeMatchEnvelope a struct to unmarshal a probe response
@@ -37,18 +118,38 @@ type ProbeMatchEnvelope struct {
 	Body struct {
 		Text         string `xml:",chardata"`
 		ProbeMatches struct {
-			Text       string `xml:",chardata"`
-			ProbeMatch []struct {
-				Text              string `xml:",chardata"`
-				EndpointReference struct {
-					Text    string `xml:",chardata"`
-					Address string `xml:"Address"`
-				} `xml:"EndpointReference"`
-				Types           string `xml:"Types"`
-				Scopes          string `xml:"Scopes"`
-				XAddrs          string `xml:"XAddrs"`
-				MetadataVersion string `xml:"MetadataVersion"`
-			} `xml:"ProbeMatch"`
+			Text       string       `xml:",chardata"`
+			ProbeMatch []ProbeMatch `xml:"ProbeMatch"`
 		} `xml:"ProbeMatches"`
+		Probe ProbeMatch `xml:"Probe"`
+		Hello ProbeMatch `xml:"Hello"`
+		Bye   ProbeMatch `xml:"Bye"`
 	} `xml:"Body"`
 }
+
+func (m ProbeMatch) innerXML() string {
+	s := `<a:EndpointReference><a:Address>` + xmlEscape(m.EndpointReference.Address) + `</a:Address></a:EndpointReference>`
+	if m.Types != "" {
+		s += `<d:Types>` + xmlEscape(m.Types) + `</d:Types>`
+	}
+	if m.Scopes != "" {
+		s += `<d:Scopes>` + xmlEscape(m.Scopes) + `</d:Scopes>`
+	}
+	if m.XAddrs != "" {
+		s += `<d:XAddrs>` + xmlEscape(m.XAddrs) + `</d:XAddrs>`
+	}
+	if m.MetadataVersion != "" {
+		s += `<d:MetadataVersion>` + xmlEscape(m.MetadataVersion) + `</d:MetadataVersion>`
+	}
+	return s
+}
+
+//isDiscoveryProxy return true if the types list a Discovery Proxy
+func (m ProbeMatch) isDiscoveryProxy() bool {
+	for _, t := range strings.Fields(m.Types) {
+		if t == discoveryProxyType || strings.HasSuffix(t, ":"+discoveryProxyType) {
+			return true
+		}
+	}
+	return false
+}
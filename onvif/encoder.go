@@ -0,0 +1,475 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+// EncoderOptions the allowed settings of a video encoder for an encoding
+type EncoderOptions struct {
+	Encoding    string            `json:"encoding"`
+	Resolutions []VideoResolution `json:"resolutions"`
+	FrameRate   IntRange          `json:"frameRate"`
+	Quality     IntRange          `json:"quality"`
+	// Bitrate is nil if not reported by the device
+	Bitrate *IntRange `json:"bitrate,omitempty"`
+	// GovLength and H264Profiles are set for H264 only
+	GovLength    *IntRange `json:"govLength,omitempty"`
+	H264Profiles []string  `json:"h264Profiles,omitempty"`
+}
+
+// GetVideoEncoderOptions return the allowed settings of a video encoder by
+// encoding, as used by profile if not empty
+func GetVideoEncoderOptions(ctx context.Context, client *Client, token string, profile string) ([]EncoderOptions, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetVideoEncoderConfigurationOptionsResponse{}
+	err = client.Call(ctx, xaddr, GetVideoEncoderConfigurationOptions{
+		ConfigurationToken: token,
+		ProfileToken:       profile,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	options := res.Body.GetVideoEncoderConfigurationOptionsResponse.Options
+
+	var jpegBitrate, mpeg4Bitrate, h264Bitrate *IntRange
+	if ext := options.Extension; ext != nil {
+		if ext.JPEG != nil {
+			jpegBitrate = ext.JPEG.BitrateRange
+		}
+		if ext.MPEG4 != nil {
+			mpeg4Bitrate = ext.MPEG4.BitrateRange
+		}
+		if ext.H264 != nil {
+			h264Bitrate = ext.H264.BitrateRange
+		}
+	}
+
+	list := []EncoderOptions{}
+	add := func(encoding string, codec *CodecOptions, bitrate *IntRange) {
+		if codec == nil {
+			return
+		}
+		list = append(list, EncoderOptions{
+			Encoding:     encoding,
+			Resolutions:  codec.ResolutionsAvailable,
+			FrameRate:    codec.FrameRateRange,
+			Quality:      options.QualityRange,
+			Bitrate:      bitrate,
+			GovLength:    codec.GovLengthRange,
+			H264Profiles: codec.H264ProfilesSupported,
+		})
+	}
+	add("JPEG", options.JPEG, jpegBitrate)
+	add("MPEG4", options.MPEG4, mpeg4Bitrate)
+	add("H264", options.H264, h264Bitrate)
+
+	return list, nil
+}
+
+// EncoderPolicy the video encoder settings enforced by onvif.encoders on the
+// devices matching Model (a glob pattern, eg. DS-2CD*) and Selector (as
+// LookupAll), any device if both are empty. The matching policies are merged
+// in order, so the specific ones should follow the general ones. Zero values
+// leave a setting unchanged.
+type EncoderPolicy struct {
+	Model    string
+	Selector string
+	// Profile selects the configured profile as onvif.profile (a token, a
+	// name, highest or lowest), or all of them with all
+	Profile  string
+	Encoding string
+	// Resolution is WIDTHxHEIGHT, eg. 1920x1080
+	Resolution string
+	FrameRate  int
+	// Bitrate is in kbps
+	Bitrate   int
+	GovLength int
+	Quality   float64
+}
+
+// LoadEncoderPolicies read the policies from the onvif.encoders configuration
+func LoadEncoderPolicies() ([]EncoderPolicy, error) {
+
+	policies := []EncoderPolicy{}
+	err := viper.GetViper().UnmarshalKey("onvif.encoders", &policies)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("Encoder policy %d: %s", i+1, err)
+		}
+		policies[i].Encoding = strings.ToUpper(policy.Encoding)
+	}
+
+	return policies, nil
+}
+
+// Validate check the policy settings
+func (p EncoderPolicy) Validate() error {
+	if p.Resolution != "" {
+		if _, err := parseResolution(p.Resolution); err != nil {
+			return err
+		}
+	}
+	if p.FrameRate < 0 || p.Bitrate < 0 || p.GovLength < 0 || p.Quality < 0 {
+		return errors.New("Negative setting")
+	}
+	return nil
+}
+
+// parseResolution parse a WIDTHxHEIGHT resolution
+func parseResolution(value string) (VideoResolution, error) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(value)), "x", 2)
+	if len(parts) == 2 {
+		width, err1 := strconv.Atoi(parts[0])
+		height, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && width > 0 && height > 0 {
+			return VideoResolution{Width: width, Height: height}, nil
+		}
+	}
+	return VideoResolution{}, fmt.Errorf("Invalid resolution %s, expected WIDTHxHEIGHT", value)
+}
+
+func (r VideoResolution) String() string {
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// Matches return true if the policy applies to the device
+func (p EncoderPolicy) Matches(dev device.Device) bool {
+
+	if p.Model != "" {
+		model := dev.Model
+		if model == "" {
+			model = dev.Hardware
+		}
+		if ok, _ := path.Match(strings.ToLower(p.Model), strings.ToLower(model)); !ok {
+			return false
+		}
+	}
+
+	return p.Selector == "" || matchSelector(dev, p.Selector)
+}
+
+// merge return p with the settings of other overriding its own
+func (p EncoderPolicy) merge(other EncoderPolicy) EncoderPolicy {
+	if other.Encoding != "" {
+		p.Encoding = other.Encoding
+	}
+	if other.Resolution != "" {
+		p.Resolution = other.Resolution
+	}
+	if other.FrameRate > 0 {
+		p.FrameRate = other.FrameRate
+	}
+	if other.Bitrate > 0 {
+		p.Bitrate = other.Bitrate
+	}
+	if other.GovLength > 0 {
+		p.GovLength = other.GovLength
+	}
+	if other.Quality > 0 {
+		p.Quality = other.Quality
+	}
+	return p
+}
+
+// EncoderReport the outcome of the encoder policies on a profile video encoder
+type EncoderReport struct {
+	Profile string   `json:"profile"`
+	Encoder string   `json:"encoder"`
+	Changes []Change `json:"changes,omitempty"`
+	// Violations lists the settings the encoder cannot satisfy, left unchanged
+	Violations []string `json:"violations,omitempty"`
+}
+
+// policyProfiles return the profiles selected by a policy, none if the
+// selector does not match any
+func policyProfiles(profiles []device.MediaProfile, selector string) []device.MediaProfile {
+	if strings.EqualFold(selector, "all") {
+		return profiles
+	}
+	if selector == "" {
+		selector = viper.GetViper().GetString("onvif.profile")
+	}
+	if profile, ok := findProfile(profiles, selector); ok {
+		return []device.MediaProfile{profile}
+	}
+	return nil
+}
+
+// ApplyEncoderPolicies enforce the policies matching the device on its video
+// encoders, returning a report by encoder. The satisfiable settings are
+// applied, or only reported if dryRun, the others reported as violations.
+func ApplyEncoderPolicies(ctx context.Context, client *Client, dev device.Device, policies []EncoderPolicy, dryRun bool) ([]EncoderReport, error) {
+
+	profiles, err := getProfiles(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge the policies by encoder, in order
+	targets := map[string]EncoderPolicy{}
+	tokens := []string{}
+	profileOf := map[string]string{}
+	// the profiles not found are reported, rather than falling back to another one
+	reports := []EncoderReport{}
+	for _, policy := range policies {
+		if !policy.Matches(dev) {
+			continue
+		}
+		selected := policyProfiles(profiles, policy.Profile)
+		if len(selected) == 0 {
+			reports = append(reports, EncoderReport{
+				Profile:    policy.Profile,
+				Violations: []string{fmt.Sprintf("profile %s not found", policy.Profile)},
+			})
+			continue
+		}
+		for _, profile := range selected {
+			if profile.Video == nil {
+				continue
+			}
+			token := profile.Video.Token
+			if _, ok := targets[token]; !ok {
+				tokens = append(tokens, token)
+				profileOf[token] = profile.Token
+			}
+			targets[token] = targets[token].merge(policy)
+		}
+	}
+	if len(tokens) == 0 {
+		return reports, nil
+	}
+
+	encoders, err := GetVideoEncoders(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+
+		report := EncoderReport{Profile: profileOf[token], Encoder: token}
+
+		current, ok := findVideoEncoder(encoders, VideoEncoderConfiguration{Token: token})
+		if !ok {
+			report.Violations = []string{"encoder configuration not found"}
+			reports = append(reports, report)
+			continue
+		}
+
+		options, err := GetVideoEncoderOptions(ctx, client, token, profileOf[token])
+		if err != nil {
+			return reports, err
+		}
+
+		config, violations := planEncoder(current, options, targets[token])
+		report.Violations = violations
+		report.Changes = diffValues("videoEncoders/"+token, flattenJSON(current), flattenJSON(config))
+
+		if len(report.Changes) > 0 && !dryRun {
+			if err := SetVideoEncoder(ctx, client, config, true); err != nil {
+				return reports, fmt.Errorf("Failed to configure %s: %s", token, err)
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func findEncoderOptions(options []EncoderOptions, encoding string) (EncoderOptions, bool) {
+	for _, o := range options {
+		if strings.EqualFold(o.Encoding, encoding) {
+			return o, true
+		}
+	}
+	return EncoderOptions{}, false
+}
+
+func inIntRange(value int, r IntRange) bool {
+	return value >= r.Min && value <= r.Max
+}
+
+func hasResolution(resolutions []VideoResolution, resolution VideoResolution) bool {
+	for _, r := range resolutions {
+		if r == resolution {
+			return true
+		}
+	}
+	return false
+}
+
+// planEncoder return the configuration satisfying the policy as allowed by
+// the options, and the policy settings not satisfiable
+func planEncoder(current VideoEncoderConfiguration, options []EncoderOptions, policy EncoderPolicy) (VideoEncoderConfiguration, []string) {
+
+	config := current
+	if current.RateControl != nil {
+		rateControl := *current.RateControl
+		config.RateControl = &rateControl
+	}
+	if current.H264 != nil {
+		h264 := *current.H264
+		config.H264 = &h264
+	}
+
+	violations := []string{}
+
+	opts, ok := findEncoderOptions(options, config.Encoding)
+	if policy.Encoding != "" && !strings.EqualFold(policy.Encoding, config.Encoding) {
+		if o, found := findEncoderOptions(options, policy.Encoding); found {
+			opts, ok = o, true
+			config.Encoding = o.Encoding
+			config.H264 = nil
+			if o.Encoding == "H264" {
+				config.H264 = &H264Configuration{}
+				if len(o.H264Profiles) > 0 {
+					config.H264.H264Profile = o.H264Profiles[0]
+				}
+				if config.RateControl != nil {
+					config.H264.GovLength = config.RateControl.FrameRateLimit
+				}
+				if o.GovLength != nil && !inIntRange(config.H264.GovLength, *o.GovLength) {
+					config.H264.GovLength = o.GovLength.Min
+				}
+			}
+		} else {
+			violations = append(violations, fmt.Sprintf("encoding %s not supported", policy.Encoding))
+		}
+	}
+	if !ok {
+		return current, append(violations, fmt.Sprintf("no options for encoding %s", config.Encoding))
+	}
+
+	if policy.Resolution != "" {
+		resolution, _ := parseResolution(policy.Resolution)
+		if hasResolution(opts.Resolutions, resolution) {
+			config.Resolution = resolution
+		} else {
+			available := []string{}
+			for _, r := range opts.Resolutions {
+				available = append(available, r.String())
+			}
+			violations = append(violations, fmt.Sprintf("resolution %s not available (%s)", resolution, strings.Join(available, ", ")))
+		}
+	}
+
+	if (policy.FrameRate > 0 || policy.Bitrate > 0) && config.RateControl == nil {
+		config.RateControl = &VideoRateControl{EncodingInterval: 1, FrameRateLimit: opts.FrameRate.Max}
+		if opts.Bitrate != nil {
+			config.RateControl.BitrateLimit = opts.Bitrate.Max
+		}
+	}
+
+	if policy.FrameRate > 0 {
+		if inIntRange(policy.FrameRate, opts.FrameRate) {
+			config.RateControl.FrameRateLimit = policy.FrameRate
+		} else {
+			violations = append(violations, fmt.Sprintf("frame rate %d out of range %d-%d", policy.FrameRate, opts.FrameRate.Min, opts.FrameRate.Max))
+		}
+	}
+
+	if policy.Bitrate > 0 {
+		if opts.Bitrate == nil || inIntRange(policy.Bitrate, *opts.Bitrate) {
+			config.RateControl.BitrateLimit = policy.Bitrate
+		} else {
+			violations = append(violations, fmt.Sprintf("bitrate %d out of range %d-%d", policy.Bitrate, opts.Bitrate.Min, opts.Bitrate.Max))
+		}
+	}
+
+	if policy.GovLength > 0 {
+		switch {
+		case config.H264 == nil:
+			violations = append(violations, fmt.Sprintf("GOV length not supported by %s", config.Encoding))
+		case opts.GovLength != nil && !inIntRange(policy.GovLength, *opts.GovLength):
+			violations = append(violations, fmt.Sprintf("GOV length %d out of range %d-%d", policy.GovLength, opts.GovLength.Min, opts.GovLength.Max))
+		default:
+			config.H264.GovLength = policy.GovLength
+		}
+	}
+
+	if policy.Quality > 0 {
+		if policy.Quality >= float64(opts.Quality.Min) && policy.Quality <= float64(opts.Quality.Max) {
+			config.Quality = policy.Quality
+		} else {
+			violations = append(violations, fmt.Sprintf("quality %g out of range %d-%d", policy.Quality, opts.Quality.Min, opts.Quality.Max))
+		}
+	}
+
+	// a new encoding may not support the current settings
+	if len(opts.Resolutions) > 0 && !hasResolution(opts.Resolutions, config.Resolution) {
+		return current, append(violations, fmt.Sprintf("resolution %s not available for %s", config.Resolution, config.Encoding))
+	}
+	if config.RateControl != nil && !inIntRange(config.RateControl.FrameRateLimit, opts.FrameRate) {
+		return current, append(violations, fmt.Sprintf("frame rate %d not available for %s", config.RateControl.FrameRateLimit, config.Encoding))
+	}
+
+	return config, violations
+}
+
+// enforceEncoderPolicies apply the matching encoder policies to a resolved
+// device, updating its profiles and PolicyViolations
+func enforceEncoderPolicies(ctx context.Context, dev *device.Device, auth *Authenticator, policies []EncoderPolicy, profile string) {
+
+	dev.PolicyViolations = nil
+
+	matching := false
+	for _, policy := range policies {
+		matching = matching || policy.Matches(*dev)
+	}
+	if !matching {
+		return
+	}
+
+	client, err := Connect(ctx, *dev, auth)
+	var reports []EncoderReport
+	if err == nil {
+		reports, err = ApplyEncoderPolicies(ctx, client, *dev, policies, false)
+	}
+	if err != nil {
+		log.Printf("Encoder policy failed for %s: %s\n", dev.Name, err)
+		dev.PolicyViolations = []string{err.Error()}
+		return
+	}
+
+	changed := false
+	for _, report := range reports {
+		changed = changed || len(report.Changes) > 0
+		for _, violation := range report.Violations {
+			if report.Encoder != "" {
+				violation = report.Encoder + ": " + violation
+			}
+			dev.PolicyViolations = append(dev.PolicyViolations, violation)
+		}
+	}
+
+	if changed {
+		log.Printf("Applied encoder policy to %s\n", dev.Name)
+		// the profiles reflect the new settings
+		if err := resolveMedia(ctx, client, dev, profile); err != nil {
+			log.Printf("resolveMedia error for %s: %s\n", dev.Name, err)
+		}
+	}
+
+	if len(dev.PolicyViolations) > 0 {
+		log.Printf("Encoder policy not satisfied by %s: %s\n", dev.Name, strings.Join(dev.PolicyViolations, "; "))
+	}
+}
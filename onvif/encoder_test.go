@@ -0,0 +1,67 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderPolicies(t *testing.T) {
+
+	camera, dev, client := connectCamera(t, simulator.Config{})
+	defer camera.Stop()
+
+	ctx := context.Background()
+
+	options, err := GetVideoEncoderOptions(ctx, client, "Profile_1_VideoEncoder", "Profile_1")
+	assert.NoError(t, err)
+	h264, ok := findEncoderOptions(options, "H264")
+	assert.True(t, ok)
+	assert.Contains(t, h264.Resolutions, VideoResolution{Width: 1280, Height: 720})
+	assert.Equal(t, &IntRange{Min: 64, Max: 8192}, h264.Bitrate)
+
+	policies := []EncoderPolicy{
+		{Model: "camd-*", Profile: "all", FrameRate: 15, GovLength: 30},
+		{Selector: dev.UUID, Profile: "MainStream", Resolution: "1280x720", Bitrate: 99999},
+		{Model: "other", Profile: "all", FrameRate: 5},
+	}
+
+	reports, err := ApplyEncoderPolicies(ctx, client, dev, policies, true)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "Profile_1_VideoEncoder", reports[0].Encoder)
+	assert.Len(t, reports[0].Violations, 1)
+	assert.Contains(t, reports[0].Violations[0], "bitrate 99999")
+	assert.NotEmpty(t, reports[0].Changes)
+	assert.Empty(t, reports[1].Violations)
+	assert.Equal(t, 1920, camera.Config().Profiles[0].Width)
+
+	enforceEncoderPolicies(ctx, &dev, NewAuthenticator(nil), policies, "")
+	assert.Len(t, dev.PolicyViolations, 1)
+	profiles := camera.Config().Profiles
+	assert.Equal(t, 1280, profiles[0].Width)
+	assert.Equal(t, 15, profiles[0].FrameRate)
+	assert.Equal(t, 30, profiles[0].GovLength)
+	assert.Equal(t, 4096, profiles[0].Bitrate)
+	assert.Equal(t, 15, profiles[1].FrameRate)
+	assert.Equal(t, 1280, dev.Profiles[0].Video.Width)
+
+	// an unknown profile selects nothing, rather than the first profile
+	reports, err = ApplyEncoderPolicies(ctx, client, dev, []EncoderPolicy{{Profile: "Missing", Resolution: "640x360"}}, true)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 1) {
+		assert.Empty(t, reports[0].Encoder)
+		assert.Empty(t, reports[0].Changes)
+		assert.Equal(t, []string{"profile Missing not found"}, reports[0].Violations)
+	}
+
+	// GOV length is H264 only
+	encoders, err := GetVideoEncoders(ctx, client)
+	assert.NoError(t, err)
+	config, violations := planEncoder(encoders[1], options, EncoderPolicy{Encoding: "JPEG", GovLength: 10})
+	assert.Equal(t, "JPEG", config.Encoding)
+	assert.Nil(t, config.H264)
+	assert.Equal(t, []string{"GOV length not supported by JPEG"}, violations)
+}
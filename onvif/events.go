@@ -0,0 +1,426 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EventsPullPoint subscribe to the device events with a PullPoint, polled by camd
+	EventsPullPoint = "pullpoint"
+	// EventsNotify subscribe to the device events with WS-BaseNotification,
+	// the device sending them to a local Consumer endpoint
+	EventsNotify = "notify"
+
+	subscriptionTime = time.Minute
+	pullTimeout      = 5 * time.Second
+	messageLimit     = 100
+	resubscribeDelay = 5 * time.Second
+
+	defaultConsumerListen = ":8780"
+
+	// topics notifying a device reboot or factory reset
+	topicLastReboot = "Monitoring/OperatingTime/LastReboot"
+	topicLastReset  = "Monitoring/OperatingTime/LastReset"
+
+	actionCreatePullPoint = "http://www.onvif.org/ver10/events/wsdl/EventPortType/CreatePullPointSubscriptionRequest"
+	actionSubscribe       = "http://docs.oasis-open.org/wsn/bw-2/NotificationProducer/SubscribeRequest"
+	actionPullMessages    = "http://www.onvif.org/ver10/events/wsdl/PullPointSubscription/PullMessagesRequest"
+	actionRenew           = "http://docs.oasis-open.org/wsn/bw-2/SubscriptionManager/RenewRequest"
+	actionUnsubscribe     = "http://docs.oasis-open.org/wsn/bw-2/SubscriptionManager/UnsubscribeRequest"
+)
+
+// xsdDuration format a duration as xs:duration, eg. PT60S
+func xsdDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int(d.Seconds()))
+}
+
+var xsdDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseXSDDuration parse an xs:duration without years and months, eg. PT1H30M
+func parseXSDDuration(value string) (time.Duration, error) {
+
+	m := xsdDurationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("Invalid duration %s", value)
+	}
+
+	d := time.Duration(0)
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if n, err := strconv.Atoi(m[i+1]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+	if s, err := strconv.ParseFloat(m[4], 64); err == nil {
+		d += time.Duration(s * float64(time.Second))
+	}
+
+	return d, nil
+}
+
+// topicName strip the namespace prefixes from a topic expression, eg.
+// tns1:RuleEngine/tnsaxis:Motion become RuleEngine/Motion
+func topicName(topic string) string {
+	segments := strings.Split(strings.TrimSpace(topic), "/")
+	for i, segment := range segments {
+		segments[i] = localName(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func simpleItems(items []SimpleItem) map[string]string {
+	if len(items) == 0 {
+		return nil
+	}
+	values := map[string]string{}
+	for _, item := range items {
+		values[item.Name] = item.Value
+	}
+	return values
+}
+
+// parseNotifications convert the notification messages to device notifications
+func parseNotifications(messages []NotificationMessage) []device.Notification {
+
+	notifications := []device.Notification{}
+	for _, message := range messages {
+
+		msg := message.Message.Message
+		notification := device.Notification{
+			Topic:     topicName(message.Topic.Value),
+			Operation: msg.PropertyOperation,
+			Source:    simpleItems(msg.Source.SimpleItem),
+			Key:       simpleItems(msg.Key.SimpleItem),
+			Data:      simpleItems(msg.Data.SimpleItem),
+		}
+
+		utc, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(msg.UtcTime))
+		if err != nil {
+			utc = time.Now().UTC()
+		}
+		notification.Time = utc
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications
+}
+
+// subscription an events subscription, managed at address
+type subscription struct {
+	client  *Client
+	address string
+	// renewAt is halfway to the subscription termination
+	renewAt time.Time
+}
+
+// setTermination schedule the renewal, relying on the device CurrentTime as
+// its clock may be skewed
+func (s *subscription) setTermination(current, termination string) {
+
+	lifetime := subscriptionTime
+
+	end, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(termination))
+	if err == nil {
+		now, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(current))
+		if err != nil {
+			now = time.Now().Add(s.client.ClockOffset())
+		}
+		lifetime = end.Sub(now)
+	}
+
+	s.renewAt = time.Now().Add(lifetime / 2)
+}
+
+// createPullPoint subscribe to the device events with a PullPoint
+func createPullPoint(ctx context.Context, client *Client) (*subscription, error) {
+
+	xaddr, err := client.Endpoint(ctx, "events")
+	if err != nil {
+		return nil, err
+	}
+
+	res := CreatePullPointSubscriptionResponse{}
+	err = client.CallAction(ctx, xaddr, actionCreatePullPoint, CreatePullPointSubscription{
+		InitialTerminationTime: xsdDuration(subscriptionTime),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	response := res.Body.CreatePullPointSubscriptionResponse
+	sub := &subscription{
+		client:  client,
+		address: strings.TrimSpace(response.SubscriptionReference.Address),
+	}
+	if sub.address == "" {
+		return nil, fmt.Errorf("Missing subscription reference")
+	}
+	sub.setTermination(response.CurrentTime, response.TerminationTime)
+
+	return sub, nil
+}
+
+// subscribe to the device events with WS-BaseNotification, the device
+// sending them to the consumer address
+func subscribe(ctx context.Context, client *Client, consumer string) (*subscription, error) {
+
+	xaddr, err := client.Endpoint(ctx, "events")
+	if err != nil {
+		return nil, err
+	}
+
+	req := Subscribe{InitialTerminationTime: xsdDuration(subscriptionTime)}
+	req.ConsumerReference.Address = consumer
+
+	res := SubscribeResponse{}
+	err = client.CallAction(ctx, xaddr, actionSubscribe, req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	response := res.Body.SubscribeResponse
+	sub := &subscription{
+		client:  client,
+		address: strings.TrimSpace(response.SubscriptionReference.Address),
+	}
+	if sub.address == "" {
+		return nil, fmt.Errorf("Missing subscription reference")
+	}
+	sub.setTermination(response.CurrentTime, response.TerminationTime)
+
+	return sub, nil
+}
+
+// pull wait for the pending notifications of a PullPoint
+func (s *subscription) pull(ctx context.Context) ([]device.Notification, error) {
+
+	res := PullMessagesResponse{}
+	err := s.client.CallAction(ctx, s.address, actionPullMessages, PullMessages{
+		Timeout:      xsdDuration(pullTimeout),
+		MessageLimit: messageLimit,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNotifications(res.Body.PullMessagesResponse.NotificationMessage), nil
+}
+
+// renew extend the subscription
+func (s *subscription) renew(ctx context.Context) error {
+
+	res := RenewResponse{}
+	err := s.client.CallAction(ctx, s.address, actionRenew, Renew{
+		TerminationTime: xsdDuration(subscriptionTime),
+	}, &res)
+	if err != nil {
+		return err
+	}
+
+	s.setTermination(res.Body.RenewResponse.CurrentTime, res.Body.RenewResponse.TerminationTime)
+	return nil
+}
+
+// unsubscribe terminate the subscription, ignoring errors as the device may be gone
+func (s *subscription) unsubscribe() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s.client.CallAction(ctx, s.address, actionUnsubscribe, Unsubscribe{}, nil)
+}
+
+// WatchEvents subscribe to the device events until ctx is cancelled, calling
+// handle for each notification. The subscription is renewed before it
+// expires and created again when it fails, eg. as the device rebooted.
+func WatchEvents(ctx context.Context, dev device.Device, auth *Authenticator, mode string, consumer *Consumer, handle func(device.Notification)) {
+	watchEventsLoop(ctx, dev, auth, mode, consumer, handle, nil)
+}
+
+// watchEventsLoop subscribe as WatchEvents, calling resubscribed when a
+// subscription is created again after a failure, as the device may have rebooted
+func watchEventsLoop(ctx context.Context, dev device.Device, auth *Authenticator, mode string, consumer *Consumer, handle func(device.Notification), resubscribed func()) {
+	failed := false
+	for {
+		err := watchEvents(ctx, dev, auth, mode, consumer, handle, func() {
+			if failed && resubscribed != nil {
+				resubscribed()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Events subscription failed for %s: %s", dev.Name, err)
+		failed = true
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+func watchEvents(ctx context.Context, dev device.Device, auth *Authenticator, mode string, consumer *Consumer, handle func(device.Notification), subscribed func()) error {
+
+	client, err := Connect(ctx, dev, auth)
+	if err != nil {
+		return err
+	}
+
+	var sub *subscription
+	if mode == EventsNotify {
+		if consumer == nil {
+			return fmt.Errorf("Missing notification consumer")
+		}
+		address, err := consumer.Register(dev.UUID, dev.Address, handle)
+		if err != nil {
+			return err
+		}
+		defer consumer.Unregister(dev.UUID)
+
+		sub, err = subscribe(ctx, client, address)
+		if err != nil {
+			return err
+		}
+	} else {
+		sub, err = createPullPoint(ctx, client)
+		if err != nil {
+			return err
+		}
+	}
+	defer sub.unsubscribe()
+	subscribed()
+
+	for {
+
+		if time.Now().After(sub.renewAt) {
+			err := sub.renew(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if mode == EventsNotify {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(sub.renewAt)):
+			}
+			continue
+		}
+
+		notifications, err := sub.pull(ctx)
+		if err != nil {
+			return err
+		}
+		for _, notification := range notifications {
+			handle(notification)
+		}
+	}
+}
+
+// newEventsWatcher init the subscriptions of the discovered devices, as
+// configured by onvif.events.mode (pullpoint, notify or empty to disable).
+// The notify mode listens on onvif.events.consumer, advertised as
+// onvif.events.consumer_url if set. rebooted is called with the UUID of a
+// device notifying a reboot or losing its subscription.
+func newEventsWatcher(auth *Authenticator, emitter chan device.OnChangeEvent, rebooted func(uuid string)) *eventsWatcher {
+	return &eventsWatcher{
+		mode:          strings.ToLower(viper.GetViper().GetString("onvif.events.mode")),
+		auth:          auth,
+		emitter:       emitter,
+		rebooted:      rebooted,
+		subscriptions: map[string]context.CancelFunc{},
+	}
+}
+
+// eventsWatcher forward the events of the discovered devices to the emitter
+type eventsWatcher struct {
+	mode          string
+	auth          *Authenticator
+	emitter       chan device.OnChangeEvent
+	rebooted      func(uuid string)
+	consumer      *Consumer
+	mut           sync.Mutex
+	subscriptions map[string]context.CancelFunc
+}
+
+func (w *eventsWatcher) start() error {
+
+	if w.mode != EventsNotify {
+		return nil
+	}
+
+	listen := viper.GetViper().GetString("onvif.events.consumer")
+	if listen == "" {
+		listen = defaultConsumerListen
+	}
+
+	w.consumer = NewConsumer(listen, viper.GetViper().GetString("onvif.events.consumer_url"))
+	return w.consumer.Start()
+}
+
+func (w *eventsWatcher) stop() {
+	w.mut.Lock()
+	for uuid, cancel := range w.subscriptions {
+		cancel()
+		delete(w.subscriptions, uuid)
+	}
+	w.mut.Unlock()
+
+	if w.consumer != nil {
+		w.consumer.Stop()
+	}
+}
+
+// watch subscribe to the events of a device, replacing a previous subscription
+func (w *eventsWatcher) watch(ctx context.Context, dev device.Device) {
+
+	if w.mode == "" || !dev.Capabilities.Events {
+		return
+	}
+
+	w.unwatch(dev.UUID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.mut.Lock()
+	w.subscriptions[dev.UUID] = cancel
+	w.mut.Unlock()
+
+	rebooted := func() {
+		if w.rebooted != nil {
+			w.rebooted(dev.UUID)
+		}
+	}
+
+	go watchEventsLoop(ctx, dev, w.auth, w.mode, w.consumer, func(notification device.Notification) {
+		log.Printf("Event from ONVIF device name=%s topic=%s\n", dev.Name, notification.Topic)
+		// the initial state of the property is sent on subscribe
+		if (notification.Topic == topicLastReboot || notification.Topic == topicLastReset) && notification.Operation == "Changed" {
+			rebooted()
+		}
+		select {
+		case w.emitter <- device.OnChangeEvent{Device: dev, Event: device.DeviceEvent, Notification: &notification}:
+		case <-ctx.Done():
+		}
+	}, rebooted)
+}
+
+// unwatch cancel the subscription of a device
+func (w *eventsWatcher) unwatch(uuid string) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if cancel, ok := w.subscriptions[uuid]; ok {
+		cancel()
+		delete(w.subscriptions, uuid)
+	}
+}
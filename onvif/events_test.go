@@ -0,0 +1,56 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchEvents(t *testing.T) {
+
+	consumer := NewConsumer("127.0.0.1:0", "")
+	if err := consumer.Start(); err != nil {
+		t.Fatalf("Consumer failed: %s", err)
+	}
+	defer consumer.Stop()
+
+	for _, mode := range []string{EventsPullPoint, EventsNotify} {
+		t.Run(mode, func(t *testing.T) {
+
+			camera, dev := startCamera(t, simulator.Config{Username: "admin", Password: "secret"})
+			defer camera.Stop()
+			auth := NewAuthenticator([]Credential{{Username: "admin", Password: "secret"}})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			received := make(chan device.Notification, 10)
+			go WatchEvents(ctx, dev, auth, mode, consumer, func(notification device.Notification) {
+				received <- notification
+			})
+
+			var notification device.Notification
+			timeout := time.After(5 * time.Second)
+		wait:
+			for {
+				camera.Publish("RuleEngine/CellMotionDetector/Motion",
+					map[string]string{"VideoSourceConfigurationToken": "VideoSourceConfig_1"},
+					map[string]string{"IsMotion": "true"})
+				select {
+				case notification = <-received:
+					break wait
+				case <-time.After(200 * time.Millisecond):
+				case <-timeout:
+					t.Fatal("No event received")
+				}
+			}
+
+			assert.Equal(t, "RuleEngine/CellMotionDetector/Motion", notification.Topic)
+			assert.Equal(t, "true", notification.Data["IsMotion"])
+			assert.Equal(t, "VideoSourceConfig_1", notification.Source["VideoSourceConfigurationToken"])
+		})
+	}
+}
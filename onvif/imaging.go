@@ -0,0 +1,249 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+// ImagingSettingKeys lists the keys accepted by UpdateImagingSettings
+var ImagingSettingKeys = []string{
+	"brightness", "saturation", "contrast", "sharpness", "ircut",
+	"exposure.mode", "exposure.time", "exposure.gain", "exposure.iris",
+	"focus.mode", "focus.speed", "focus.near", "focus.far",
+	"wdr.mode", "wdr.level",
+}
+
+// FocusStatus the focus position and move status of a video source
+type FocusStatus struct {
+	Position float64 `json:"position"`
+	// MoveStatus is one of IDLE, MOVING or UNKNOWN
+	MoveStatus string `json:"moveStatus"`
+	Error      string `json:"error,omitempty"`
+}
+
+// listProfiles return the media profiles, without the stream URIs
+func listProfiles(ctx context.Context, client *Client) ([]device.MediaProfile, error) {
+	if client.HasService(ctx, "media2") {
+		profiles, err := media2GetProfiles(ctx, client)
+		if err == nil {
+			return profiles, nil
+		}
+	}
+	return getProfiles(ctx, client)
+}
+
+// NewImaging init an Imaging controller for a video source. If source is
+// empty, the video source of the profile selected by onvif.profile is used.
+func NewImaging(ctx context.Context, client *Client, source string) (*Imaging, error) {
+
+	xaddr, err := client.Endpoint(ctx, "imaging")
+	if err != nil {
+		return nil, err
+	}
+
+	if source == "" {
+		profiles, err := listProfiles(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		primary, ok := primaryProfile(profiles, viper.GetViper().GetString("onvif.profile"))
+		if !ok || primary.VideoSource == "" {
+			return nil, errors.New("No video source available")
+		}
+		source = primary.VideoSource
+	}
+
+	return &Imaging{
+		client: client,
+		xaddr:  xaddr,
+		source: source,
+	}, nil
+}
+
+// Imaging read and adjust the image settings of a video source
+type Imaging struct {
+	client *Client
+	xaddr  string
+	source string
+}
+
+// Source return the video source token
+func (i *Imaging) Source() string {
+	return i.source
+}
+
+// Settings return the current image settings
+func (i *Imaging) Settings(ctx context.Context) (ImagingSettings, error) {
+
+	res := GetImagingSettingsResponse{}
+	err := i.client.Call(ctx, i.xaddr, GetImagingSettings{VideoSourceToken: i.source}, &res)
+	if err != nil {
+		return ImagingSettings{}, err
+	}
+
+	return res.Body.GetImagingSettingsResponse.ImagingSettings, nil
+}
+
+// SetSettings change the image settings, leaving the nil ones unchanged. If
+// persist is true, the settings survive a reboot.
+func (i *Imaging) SetSettings(ctx context.Context, settings ImagingSettings, persist bool) error {
+	return i.client.Call(ctx, i.xaddr, SetImagingSettings{
+		VideoSourceToken: i.source,
+		ImagingSettings:  settings,
+		ForcePersistence: persist,
+	}, nil)
+}
+
+// Options return the allowed image settings
+func (i *Imaging) Options(ctx context.Context) (ImagingOptions, error) {
+
+	res := ImagingGetOptionsResponse{}
+	err := i.client.Call(ctx, i.xaddr, ImagingGetOptions{VideoSourceToken: i.source}, &res)
+	if err != nil {
+		return ImagingOptions{}, err
+	}
+
+	return res.Body.GetOptionsResponse.ImagingOptions, nil
+}
+
+// Focus move the focus, as absolute, relative or continuous as set in move
+func (i *Imaging) Focus(ctx context.Context, move FocusMove) error {
+	return i.client.Call(ctx, i.xaddr, ImagingMove{
+		VideoSourceToken: i.source,
+		Focus:            move,
+	}, nil)
+}
+
+// StopFocus stop a focus move
+func (i *Imaging) StopFocus(ctx context.Context) error {
+	return i.client.Call(ctx, i.xaddr, ImagingStop{VideoSourceToken: i.source}, nil)
+}
+
+// FocusStatus return the focus position and move status
+func (i *Imaging) FocusStatus(ctx context.Context) (FocusStatus, error) {
+
+	res := ImagingGetStatusResponse{}
+	err := i.client.Call(ctx, i.xaddr, ImagingGetStatus{VideoSourceToken: i.source}, &res)
+	if err != nil {
+		return FocusStatus{}, err
+	}
+
+	status := res.Body.GetStatusResponse.Status.FocusStatus20
+	return FocusStatus{
+		Position:   status.Position,
+		MoveStatus: strings.TrimSpace(status.MoveStatus),
+		Error:      strings.TrimSpace(status.Error),
+	}, nil
+}
+
+// UpdateImagingSettings apply changes (eg. brightness=60, exposure.mode=MANUAL,
+// see ImagingSettingKeys) to the current settings, returning only the changed
+// groups, as SetImagingSettings leaves the missing ones unchanged.
+func UpdateImagingSettings(current ImagingSettings, changes map[string]string) (ImagingSettings, error) {
+
+	update := ImagingSettings{}
+
+	// apply in a stable order, for consistent errors
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+
+		value := strings.TrimSpace(changes[key])
+		number := func() (*float64, error) {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s value %s", key, value)
+			}
+			return &f, nil
+		}
+
+		var err error
+		group := strings.SplitN(strings.ToLower(key), ".", 2)[0]
+		switch group {
+		case "exposure":
+			if update.Exposure == nil {
+				update.Exposure = &Exposure{}
+				if current.Exposure != nil {
+					*update.Exposure = *current.Exposure
+				}
+			}
+		case "focus":
+			if update.Focus == nil {
+				update.Focus = &FocusConfiguration{}
+				if current.Focus != nil {
+					*update.Focus = *current.Focus
+				}
+			}
+		case "wdr":
+			if update.WideDynamicRange == nil {
+				update.WideDynamicRange = &WideDynamicRange{}
+				if current.WideDynamicRange != nil {
+					*update.WideDynamicRange = *current.WideDynamicRange
+				}
+			}
+		}
+
+		switch strings.ToLower(key) {
+		case "brightness":
+			update.Brightness, err = number()
+		case "saturation":
+			update.ColorSaturation, err = number()
+		case "contrast":
+			update.Contrast, err = number()
+		case "sharpness":
+			update.Sharpness, err = number()
+		case "ircut":
+			mode := strings.ToUpper(value)
+			update.IrCutFilter = &mode
+		case "exposure.mode":
+			update.Exposure.Mode = strings.ToUpper(value)
+		case "exposure.time":
+			update.Exposure.ExposureTime, err = number()
+		case "exposure.gain":
+			update.Exposure.Gain, err = number()
+		case "exposure.iris":
+			update.Exposure.Iris, err = number()
+		case "focus.mode":
+			update.Focus.AutoFocusMode = strings.ToUpper(value)
+		case "focus.speed":
+			update.Focus.DefaultSpeed, err = number()
+		case "focus.near":
+			update.Focus.NearLimit, err = number()
+		case "focus.far":
+			update.Focus.FarLimit, err = number()
+		case "wdr.mode":
+			update.WideDynamicRange.Mode = strings.ToUpper(value)
+		case "wdr.level":
+			update.WideDynamicRange.Level, err = number()
+		default:
+			return ImagingSettings{}, fmt.Errorf("Unknown setting %s, expected one of %s", key, strings.Join(ImagingSettingKeys, ", "))
+		}
+		if err != nil {
+			return ImagingSettings{}, err
+		}
+	}
+
+	// the modes are required by the schema
+	if update.Exposure != nil && update.Exposure.Mode == "" {
+		return ImagingSettings{}, errors.New("Exposure not supported, set exposure.mode")
+	}
+	if update.Focus != nil && update.Focus.AutoFocusMode == "" {
+		return ImagingSettings{}, errors.New("Focus not supported, set focus.mode")
+	}
+	if update.WideDynamicRange != nil && update.WideDynamicRange.Mode == "" {
+		return ImagingSettings{}, errors.New("WDR not supported, set wdr.mode")
+	}
+
+	return update, nil
+}
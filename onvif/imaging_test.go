@@ -0,0 +1,69 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImaging(t *testing.T) {
+
+	camera, _, client := connectCamera(t, simulator.Config{Imaging: true})
+	defer camera.Stop()
+
+	ctx := context.Background()
+
+	imaging, err := NewImaging(ctx, client, "")
+	if err != nil {
+		t.Fatalf("NewImaging failed: %s", err)
+	}
+	assert.Equal(t, "VideoSource_1", imaging.Source())
+
+	settings, err := imaging.Settings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 50.0, *settings.Brightness)
+	assert.Equal(t, "AUTO", *settings.IrCutFilter)
+
+	options, err := imaging.Options(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ON", "OFF", "AUTO"}, options.IrCutFilterModes)
+	assert.Equal(t, 100.0, options.Brightness.Max)
+
+	update, err := UpdateImagingSettings(settings, map[string]string{
+		"brightness":    "70",
+		"ircut":         "off",
+		"exposure.mode": "manual",
+		"exposure.time": "2000",
+		"focus.mode":    "MANUAL",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, update.Contrast)
+	assert.Nil(t, update.WideDynamicRange)
+
+	err = imaging.SetSettings(ctx, update, false)
+	assert.NoError(t, err)
+
+	settings, err = imaging.Settings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 70.0, *settings.Brightness)
+	assert.Equal(t, 50.0, *settings.Contrast)
+	assert.Equal(t, "OFF", *settings.IrCutFilter)
+	assert.Equal(t, "MANUAL", settings.Exposure.Mode)
+	assert.Equal(t, 2000.0, *settings.Exposure.ExposureTime)
+
+	update, err = UpdateImagingSettings(settings, map[string]string{"brightness": "150"})
+	assert.NoError(t, err)
+	assert.Error(t, imaging.SetSettings(ctx, update, false))
+
+	_, err = UpdateImagingSettings(settings, map[string]string{"hue": "10"})
+	assert.Error(t, err)
+
+	err = imaging.Focus(ctx, FocusMove{Absolute: &AbsoluteFocus{Position: 0.4}})
+	assert.NoError(t, err)
+	status, err := imaging.FocusStatus(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, status.Position)
+	assert.Equal(t, "IDLE", status.MoveStatus)
+}
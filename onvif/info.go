@@ -0,0 +1,127 @@
+package onvif
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/muka/camd/device"
+)
+
+// DeviceInformation return the manufacturer, model, firmware and serial
+// number of the device, as returned when connecting
+func (c *Client) DeviceInformation(ctx context.Context) (*GetDeviceInformationResponse, error) {
+
+	c.mut.Lock()
+	info := c.info
+	c.mut.Unlock()
+	if info != nil {
+		return info, nil
+	}
+
+	info = &GetDeviceInformationResponse{}
+	err := c.Call(ctx, c.xaddr, GetDeviceInformation{}, info)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mut.Lock()
+	c.info = info
+	c.mut.Unlock()
+
+	return info, nil
+}
+
+func getHostname(ctx context.Context, client *Client) (string, error) {
+
+	res := GetHostnameResponse{}
+	err := client.Call(ctx, client.xaddr, GetHostname{}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.GetHostnameResponse.HostnameInformation.Name), nil
+}
+
+func getNetworkInterfaces(ctx context.Context, client *Client) ([]NetworkInterface, error) {
+
+	res := GetNetworkInterfacesResponse{}
+	err := client.Call(ctx, client.xaddr, GetNetworkInterfaces{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body.GetNetworkInterfacesResponse.NetworkInterfaces, nil
+}
+
+// primaryMAC return the hardware address of the interface serving xaddr, or
+// of the first enabled one
+func primaryMAC(interfaces []NetworkInterface, xaddr string) string {
+
+	host := ""
+	if u, err := url.Parse(xaddr); err == nil {
+		host = u.Hostname()
+	}
+
+	mac := ""
+	for _, iface := range interfaces {
+		if iface.Info.HwAddress == "" {
+			continue
+		}
+		for _, addr := range iface.Addresses() {
+			if ip := net.ParseIP(strings.TrimSpace(addr)); ip != nil && ip.String() == host {
+				return normalizeMAC(iface.Info.HwAddress)
+			}
+		}
+		if mac == "" && iface.Enabled {
+			mac = normalizeMAC(iface.Info.HwAddress)
+		}
+	}
+
+	return mac
+}
+
+// normalizeMAC format a hardware address as lower case, colon separated
+func normalizeMAC(mac string) string {
+	mac = strings.TrimSpace(mac)
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return hw.String()
+	}
+	return strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+}
+
+// resolveInfo fill the device identification from GetDeviceInformation,
+// GetHostname and GetNetworkInterfaces. Only the first is required, as
+// some devices restrict the network configuration to administrators.
+func resolveInfo(ctx context.Context, client *Client, dev *device.Device) error {
+
+	info, err := client.DeviceInformation(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := info.Body.GetDeviceInformationResponse
+	dev.Manufacturer = strings.TrimSpace(res.Manufacturer)
+	dev.Model = strings.TrimSpace(res.Model)
+	dev.FirmwareVersion = strings.TrimSpace(res.FirmwareVersion)
+	dev.SerialNumber = strings.TrimSpace(res.SerialNumber)
+	dev.HardwareID = strings.TrimSpace(res.HardwareID)
+
+	hostname, err := getHostname(ctx, client)
+	if err != nil {
+		log.Printf("GetHostname failed for %s: %s", dev.Address, err)
+	} else {
+		dev.Hostname = hostname
+	}
+
+	interfaces, err := getNetworkInterfaces(ctx, client)
+	if err != nil {
+		log.Printf("GetNetworkInterfaces failed for %s: %s", dev.Address, err)
+	} else if mac := primaryMAC(interfaces, dev.Address); mac != "" {
+		dev.MAC = mac
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/discovery"
+	"github.com/spf13/viper"
+)
+
+const defaultLookupTimeout = 5 * time.Second
+
+// Lookup find a device by UUID, name or address and connect to it with the
+// configured credentials. A device service URL (eg.
+// http://192.168.1.10/onvif/device_service) is used as-is, skipping discovery.
+// The devices stored in onvif.store by the registry of the discover command
+// are tried first, falling back to a discovery.
+func Lookup(ctx context.Context, selector string) (device.Device, *Client, error) {
+
+	credentials, err := LoadCredentials()
+	if err != nil {
+		return device.Device{}, nil, fmt.Errorf("invalid credentials: %s", err)
+	}
+	auth := NewAuthenticator(credentials)
+	trust, err := LoadTrust()
+	if err != nil {
+		return device.Device{}, nil, fmt.Errorf("invalid TLS settings: %s", err)
+	}
+	auth.SetTrust(trust)
+
+	// prefer the device stored by the registry, falling back to a discovery if
+	// it is not reachable at the stored address anymore
+	for _, dev := range storedDevices() {
+		if !matchSelector(dev, selector) {
+			continue
+		}
+		client, err := Connect(ctx, dev, auth)
+		if err == nil {
+			return dev, client, nil
+		}
+		log.Printf("Stored device %s not reachable: %s", selector, err)
+		break
+	}
+
+	dev, err := lookupDevice(ctx, selector)
+	if err != nil {
+		return dev, nil, err
+	}
+
+	client, err := Connect(ctx, dev, auth)
+	if err != nil {
+		return dev, nil, err
+	}
+
+	return dev, client, nil
+}
+
+// lookupDevice run a discovery until a device matches the selector or the
+// onvif.lookup_timeout expires
+func lookupDevice(ctx context.Context, selector string) (device.Device, error) {
+
+	if u, err := url.Parse(selector); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return device.Device{UUID: selector, Address: selector}, nil
+	}
+
+	timeout := viper.GetViper().GetDuration("onvif.lookup_timeout")
+	if timeout <= 0 {
+		timeout = defaultLookupTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	wsDiscovery := discovery.NewDiscovery(
+		discovery.WithProxy(viper.GetViper().GetString("onvif.discovery_proxy")),
+	)
+
+	err := wsDiscovery.Start(ctx)
+	if err != nil {
+		return device.Device{}, fmt.Errorf("listen failed: %s", err)
+	}
+	defer wsDiscovery.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return device.Device{}, fmt.Errorf("Device %s not found", selector)
+		case ev, ok := <-wsDiscovery.Matches:
+			if !ok {
+				return device.Device{}, fmt.Errorf("Device %s not found", selector)
+			}
+			if ev.Event != device.DeviceRemoved && matchSelector(ev.Device, selector) {
+				return ev.Device, nil
+			}
+		}
+	}
+}
+
+// LookupAll return the devices matching a selector: a UUID, name or address
+// as Lookup, a glob pattern on them (eg. "Parking*") or "all". The devices
+// in the onvif.store of the registry are merged with the ones answering a discovery during
+// onvif.lookup_timeout.
+func LookupAll(ctx context.Context, selector string) ([]device.Device, error) {
+
+	if u, err := url.Parse(selector); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return []device.Device{{UUID: selector, Address: selector}}, nil
+	}
+
+	if selector == "all" {
+		selector = "*"
+	}
+
+	devices := map[string]device.Device{}
+
+	for _, dev := range storedDevices() {
+		if matchSelector(dev, selector) {
+			devices[dev.UUID] = dev
+		}
+	}
+
+	timeout := viper.GetViper().GetDuration("onvif.lookup_timeout")
+	if timeout <= 0 {
+		timeout = defaultLookupTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	wsDiscovery := discovery.NewDiscovery(
+		discovery.WithProxy(viper.GetViper().GetString("onvif.discovery_proxy")),
+	)
+
+	err := wsDiscovery.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listen failed: %s", err)
+	}
+	defer wsDiscovery.Stop()
+
+	// discovered devices replace the stored ones, as they may have moved
+collect:
+	for {
+		select {
+		case <-ctx.Done():
+			break collect
+		case ev, ok := <-wsDiscovery.Matches:
+			if !ok {
+				break collect
+			}
+			if !matchSelector(ev.Device, selector) {
+				continue
+			}
+			if ev.Event == device.DeviceRemoved {
+				delete(devices, ev.Device.UUID)
+				continue
+			}
+			devices[ev.Device.UUID] = ev.Device
+		}
+	}
+
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("No device matching %s", selector)
+	}
+
+	list := []device.Device{}
+	for _, dev := range devices {
+		list = append(list, dev)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].UUID < list[j].UUID
+	})
+
+	return list, nil
+}
+
+// matchSelector return true if the device UUID, name or address host matches,
+// the selector being a glob pattern if it contains any of *?[
+func matchSelector(dev device.Device, selector string) bool {
+
+	if strings.ContainsAny(selector, "*?[") {
+		return matchPattern(dev, selector)
+	}
+
+	if strings.TrimPrefix(dev.UUID, "urn:uuid:") == strings.TrimPrefix(selector, "urn:uuid:") {
+		return true
+	}
+
+	if strings.EqualFold(dev.Name, selector) {
+		return true
+	}
+
+	if u, err := url.Parse(dev.Address); err == nil && u.Host != "" {
+		return u.Hostname() == selector || u.Host == selector
+	}
+
+	return false
+}
+
+// matchPattern return true if the device UUID, name or address host match a
+// glob pattern, ignoring case
+func matchPattern(dev device.Device, pattern string) bool {
+
+	candidates := []string{strings.TrimPrefix(dev.UUID, "urn:uuid:"), dev.Name}
+	if u, err := url.Parse(dev.Address); err == nil && u.Host != "" {
+		candidates = append(candidates, u.Hostname())
+	}
+
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, "urn:uuid:"))
+	for _, candidate := range candidates {
+		if ok, _ := path.Match(pattern, strings.ToLower(candidate)); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,271 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	// LogSystem is the device system log
+	LogSystem = "System"
+	// LogAccess is the device access log
+	LogAccess = "Access"
+
+	defaultConcurrency = 4
+)
+
+// networkHost return the NTP server description of an IP address or DNS name
+func networkHost(server string) NetworkHost {
+	ip := net.ParseIP(server)
+	switch {
+	case ip == nil:
+		return NetworkHost{Type: "DNS", DNSname: server}
+	case ip.To4() != nil:
+		return NetworkHost{Type: "IPv4", IPv4Address: server}
+	default:
+		return NetworkHost{Type: "IPv6", IPv6Address: server}
+	}
+}
+
+// SetNTPServers set the device NTP servers, by IP address or DNS name. If
+// fromDHCP is true, the servers provided by DHCP are used instead.
+func SetNTPServers(ctx context.Context, client *Client, servers []string, fromDHCP bool) error {
+
+	if len(servers) == 0 && !fromDHCP {
+		return errors.New("Missing NTP servers")
+	}
+
+	req := SetNTP{FromDHCP: fromDHCP}
+	if !fromDHCP {
+		for _, server := range servers {
+			req.NTPManual = append(req.NTPManual, networkHost(strings.TrimSpace(server)))
+		}
+	}
+
+	return client.Call(ctx, client.xaddr, req, nil)
+}
+
+// getNTP return the NTP servers, manually set or provided by DHCP if fromDHCP
+func getNTP(ctx context.Context, client *Client) (servers []string, fromDHCP bool, err error) {
+
+	res := GetNTPResponse{}
+	err = client.Call(ctx, client.xaddr, GetNTP{}, &res)
+	if err != nil {
+		return nil, false, err
+	}
+
+	info := res.Body.GetNTPResponse.NTPInformation
+	hosts := info.NTPManual
+	if info.FromDHCP {
+		hosts = info.NTPFromDHCP
+	}
+
+	servers = []string{}
+	for _, host := range hosts {
+		if address := strings.TrimSpace(host.Address()); address != "" {
+			servers = append(servers, address)
+		}
+	}
+
+	return servers, info.FromDHCP, nil
+}
+
+// SyncTime set the device clock to the local UTC time, or switch it to NTP
+// if ntp is true, keeping the daylight savings and time zone of the device.
+// The client clock offset is reset once the clock is set.
+func SyncTime(ctx context.Context, client *Client, ntp bool) error {
+
+	res := GetSystemDateAndTimeResponse{}
+	err := client.Call(ctx, client.xaddr, GetSystemDateAndTime{}, &res)
+	if err != nil {
+		return err
+	}
+	current := res.Body.GetSystemDateAndTimeResponse.SystemDateAndTime
+
+	req := SetSystemDateAndTime{DateTimeType: "NTP", DaylightSavings: current.DaylightSavings}
+	if current.TimeZone.TZ != "" {
+		req.TimeZone = &SetTimeZone{TZ: current.TimeZone.TZ}
+	}
+	if !ntp {
+		now := time.Now().UTC()
+		utc := &SetDateTime{}
+		utc.Time.Hour, utc.Time.Minute, utc.Time.Second = now.Clock()
+		utc.Date.Year = now.Year()
+		utc.Date.Month = int(now.Month())
+		utc.Date.Day = now.Day()
+
+		req.DateTimeType = "Manual"
+		req.UTCDateTime = utc
+	}
+
+	err = client.Call(ctx, client.xaddr, req, nil)
+	if err != nil {
+		return err
+	}
+
+	if !ntp {
+		client.SetClockOffset(0)
+	}
+	return nil
+}
+
+// SetDeviceHostname set the device hostname
+func SetDeviceHostname(ctx context.Context, client *Client, hostname string) error {
+	if hostname == "" {
+		return errors.New("Missing hostname")
+	}
+	return client.Call(ctx, client.xaddr, SetHostname{Name: hostname}, nil)
+}
+
+var hostnameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ExpandHostname return a hostname from a template, replacing {name},
+// {serial}, {model} and {mac} with the device values, as a valid hostname
+// (eg. cam-{serial} become cam-ab12cd34)
+func ExpandHostname(ctx context.Context, client *Client, dev device.Device, template string) (string, error) {
+
+	if !strings.Contains(template, "{") {
+		return template, nil
+	}
+
+	values := map[string]string{"name": dev.Name, "mac": dev.MAC}
+
+	if strings.Contains(template, "{serial}") || strings.Contains(template, "{model}") {
+		info, err := client.DeviceInformation(ctx)
+		if err != nil {
+			return "", err
+		}
+		values["serial"] = strings.TrimSpace(info.Body.GetDeviceInformationResponse.SerialNumber)
+		values["model"] = strings.TrimSpace(info.Body.GetDeviceInformationResponse.Model)
+	}
+
+	if strings.Contains(template, "{mac}") && values["mac"] == "" {
+		interfaces, err := getNetworkInterfaces(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		values["mac"] = primaryMAC(interfaces, client.xaddr)
+	}
+
+	hostname := template
+	for key, value := range values {
+		value = strings.ReplaceAll(value, ":", "")
+		hostname = strings.ReplaceAll(hostname, "{"+key+"}", value)
+	}
+
+	hostname = strings.Trim(hostnameInvalid.ReplaceAllString(strings.ToLower(hostname), "-"), "-")
+	if len(hostname) > 63 {
+		hostname = strings.TrimRight(hostname[:63], "-")
+	}
+	if hostname == "" {
+		return "", fmt.Errorf("Empty hostname from %s", template)
+	}
+
+	return hostname, nil
+}
+
+// Reboot restart the device, returning its message (eg. the expected downtime)
+func Reboot(ctx context.Context, client *Client) (string, error) {
+
+	res := SystemRebootResponse{}
+	err := client.Call(ctx, client.xaddr, SystemReboot{}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.SystemRebootResponse.Message), nil
+}
+
+// SystemLog return the device log, LogSystem or LogAccess
+func SystemLog(ctx context.Context, client *Client, logType string) (string, error) {
+
+	if logType == "" {
+		logType = LogSystem
+	}
+
+	res := GetSystemLogResponse{}
+	err := client.Call(ctx, client.xaddr, GetSystemLog{LogType: logType}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	systemLog := res.Body.GetSystemLogResponse.SystemLog
+	if systemLog.String == "" && systemLog.Binary != nil {
+		return "", errors.New("Binary system log not supported")
+	}
+
+	return systemLog.String, nil
+}
+
+// Result the outcome of an operation on a device
+type Result struct {
+	Device  device.Device
+	Message string
+	Err     error
+}
+
+// RunOnDevices run an operation on devices looked up with LookupAll,
+// connecting at most concurrency devices at a time, each within timeout if not
+// zero. The results are in the devices order.
+func RunOnDevices(ctx context.Context, devices []device.Device, concurrency int, timeout time.Duration, op func(ctx context.Context, dev device.Device, client *Client) (string, error)) ([]Result, error) {
+
+	credentials, err := LoadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	auth := NewAuthenticator(credentials)
+	trust, err := LoadTrust()
+	if err != nil {
+		return nil, err
+	}
+	auth.SetTrust(trust)
+
+	return forEachDevice(ctx, devices, auth, concurrency, timeout, op), nil
+}
+
+func forEachDevice(ctx context.Context, devices []device.Device, auth *Authenticator, concurrency int, timeout time.Duration, op func(ctx context.Context, dev device.Device, client *Client) (string, error)) []Result {
+
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	results := make([]Result, len(devices))
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i, dev := range devices {
+		wg.Add(1)
+		go func(i int, dev device.Device) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			ctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			result := Result{Device: dev}
+			client, err := Connect(ctx, dev, auth)
+			if err == nil {
+				result.Message, err = op(ctx, dev, client)
+			}
+			result.Err = err
+			results[i] = result
+		}(i, dev)
+	}
+
+	wg.Wait()
+	return results
+}
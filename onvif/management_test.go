@@ -0,0 +1,64 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachDevice(t *testing.T) {
+
+	camera1, dev1 := startCamera(t, simulator.Config{ClockOffset: time.Hour, SerialNumber: "SN0001", DaylightSavings: true, TimeZone: "CET-1CEST,M3.5.0,M10.5.0/3"})
+	defer camera1.Stop()
+	camera2, dev2 := startCamera(t, simulator.Config{ClockOffset: -time.Hour, SerialNumber: "SN0002"})
+	defer camera2.Stop()
+	dev1.Name = "Parking North"
+	dev2.Name = "Lobby"
+
+	assert.True(t, matchSelector(dev1, "parking*"))
+	assert.False(t, matchSelector(dev2, "parking*"))
+
+	// a device not responding fails alone
+	offline := device.Device{UUID: "urn:uuid:offline", Name: "Offline", Address: "http://127.0.0.1:1/onvif/device_service"}
+
+	devices := []device.Device{dev1, offline, dev2}
+	results := forEachDevice(context.Background(), devices, NewAuthenticator(nil), 2, 5*time.Second, func(ctx context.Context, dev device.Device, client *Client) (string, error) {
+		hostname, err := ExpandHostname(ctx, client, dev, "Cam-{serial}")
+		if err != nil {
+			return "", err
+		}
+		if err := SetDeviceHostname(ctx, client, hostname); err != nil {
+			return "", err
+		}
+		if err := SyncTime(ctx, client, false); err != nil {
+			return "", err
+		}
+		if err := SetNTPServers(ctx, client, []string{"pool.ntp.org", "10.0.0.1"}, false); err != nil {
+			return "", err
+		}
+		return SystemLog(ctx, client, LogSystem)
+	})
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, dev1.UUID, results[0].Device.UUID)
+	assert.NoError(t, results[0].Err)
+	assert.Contains(t, results[0].Message, "hostname cam-sn0001")
+	assert.Error(t, results[1].Err)
+	assert.NoError(t, results[2].Err)
+	assert.Contains(t, results[2].Message, "hostname cam-sn0002")
+
+	assert.InDelta(t, 0, camera1.Config().ClockOffset.Seconds(), 2)
+	assert.InDelta(t, 0, camera2.Config().ClockOffset.Seconds(), 2)
+	// the local time settings survive a sync
+	assert.True(t, camera1.Config().DaylightSavings)
+	assert.Equal(t, "CET-1CEST,M3.5.0,M10.5.0/3", camera1.Config().TimeZone)
+	assert.False(t, camera2.Config().DaylightSavings)
+	assert.Empty(t, camera2.Config().TimeZone)
+	servers, fromDHCP := camera1.NTP()
+	assert.Equal(t, []string{"pool.ntp.org", "10.0.0.1"}, servers)
+	assert.False(t, fromDHCP)
+}
@@ -0,0 +1,344 @@
+package onvif
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	// ProfileHighest select the profile with the highest resolution
+	ProfileHighest = "highest"
+	// ProfileLowest select the profile with the lowest resolution
+	ProfileLowest = "lowest"
+
+	protocolRTSP = "RTSP"
+	protocolHTTP = "HTTP"
+)
+
+// getProfiles return the media profiles of the device
+func getProfiles(ctx context.Context, client *Client) ([]device.MediaProfile, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetProfilesResponse{}
+	err = client.Call(ctx, xaddr, GetProfiles{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := []device.MediaProfile{}
+	for _, p := range res.Body.GetProfilesResponse.Profiles {
+
+		profile := device.MediaProfile{
+			Token: p.Token,
+			Name:  strings.TrimSpace(p.Name),
+		}
+
+		if p.VideoSourceConfiguration != nil {
+			profile.VideoSource = p.VideoSourceConfiguration.SourceToken
+		}
+
+		if vec := p.VideoEncoderConfiguration; vec != nil {
+			profile.Video = &device.VideoEncoder{
+				Token:     vec.Token,
+				Codec:     vec.Encoding,
+				Width:     vec.Resolution.Width,
+				Height:    vec.Resolution.Height,
+				FrameRate: vec.RateControl.FrameRateLimit,
+				Bitrate:   vec.RateControl.BitrateLimit,
+			}
+		}
+
+		if aec := p.AudioEncoderConfiguration; aec != nil {
+			profile.Audio = &device.AudioEncoder{
+				Token:      aec.Token,
+				Codec:      aec.Encoding,
+				Bitrate:    aec.Bitrate,
+				SampleRate: aec.SampleRate,
+			}
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// mediaURI a stream URI and its validity
+type mediaURI struct {
+	URI string
+	// Timeout is the URI lifetime, zero if it does not expire
+	Timeout             time.Duration
+	InvalidAfterReboot  bool
+	InvalidAfterConnect bool
+}
+
+// getStreamURI return the stream URI of a profile for a transport protocol
+func getStreamURI(ctx context.Context, client *Client, token string, protocol string) (mediaURI, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return mediaURI{}, err
+	}
+
+	req := GetStreamUri{ProfileToken: token}
+	req.StreamSetup.Stream = "RTP-Unicast"
+	req.StreamSetup.Transport.Protocol = protocol
+
+	getStremUriResponse := GetStremUriResponse{}
+	err = client.Call(ctx, xaddr, req, &getStremUriResponse)
+	if err != nil {
+		return mediaURI{}, err
+	}
+
+	uri := mediaURI{
+		URI:                 strings.TrimSpace(getStremUriResponse.GetURI()),
+		InvalidAfterReboot:  getStremUriResponse.GetInvalidAfterReboot(),
+		InvalidAfterConnect: getStremUriResponse.GetInvalidAfterConnect(),
+	}
+
+	if timeout := getStremUriResponse.GetTimeout(); strings.TrimSpace(timeout) != "" {
+		uri.Timeout, err = parseXSDDuration(timeout)
+		if err != nil {
+			log.Printf("Ignoring stream URI timeout for profile=%s: %s", token, err)
+		}
+	}
+
+	return uri, nil
+}
+
+// setValidity track the expiration of a profile stream URI
+func setValidity(profile *device.MediaProfile, uri mediaURI, now time.Time) {
+	if uri.Timeout > 0 {
+		expires := now.Add(uri.Timeout).UnixNano()
+		if profile.URIExpires == 0 || expires < profile.URIExpires {
+			profile.URIExpires = expires
+		}
+	}
+	if uri.InvalidAfterReboot {
+		profile.InvalidAfterReboot = true
+	}
+	if uri.InvalidAfterConnect {
+		profile.InvalidAfterConnect = true
+	}
+}
+
+// getSnapshotURI return the JPEG snapshot URI of a profile
+func getSnapshotURI(ctx context.Context, client *Client, token string) (string, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return "", err
+	}
+
+	res := GetSnapshotUriResponse{}
+	err = client.Call(ctx, xaddr, GetSnapshotUri{ProfileToken: token}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.GetSnapshotUriResponse.MediaUri.URI), nil
+}
+
+// GetVideoEncoders return the video encoder configurations
+func GetVideoEncoders(ctx context.Context, client *Client) ([]VideoEncoderConfiguration, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetVideoEncoderConfigurationsResponse{}
+	err = client.Call(ctx, xaddr, GetVideoEncoderConfigurations{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body.GetVideoEncoderConfigurationsResponse.Configurations, nil
+}
+
+// SetVideoEncoder change a video encoder configuration, surviving a reboot if
+// persist is true
+func SetVideoEncoder(ctx context.Context, client *Client, config VideoEncoderConfiguration, persist bool) error {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return err
+	}
+
+	return client.Call(ctx, xaddr, SetVideoEncoderConfiguration{
+		Configuration:    config,
+		ForcePersistence: persist,
+	}, nil)
+}
+
+// getAudioEncoderConfigurations return the audio encoder configurations
+func getAudioEncoderConfigurations(ctx context.Context, client *Client) ([]AudioEncoderConfiguration, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetAudioEncoderConfigurationsResponse{}
+	err = client.Call(ctx, xaddr, GetAudioEncoderConfigurations{}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body.GetAudioEncoderConfigurationsResponse.Configurations, nil
+}
+
+// setAudioEncoderConfiguration change an audio encoder configuration,
+// surviving a reboot if persist is true
+func setAudioEncoderConfiguration(ctx context.Context, client *Client, config AudioEncoderConfiguration, persist bool) error {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return err
+	}
+
+	return client.Call(ctx, xaddr, SetAudioEncoderConfiguration{
+		Configuration:    config,
+		ForcePersistence: persist,
+	}, nil)
+}
+
+// bindEncoder bind a video or audio encoder configuration to a profile,
+// replacing the previous one
+func bindEncoder(ctx context.Context, client *Client, profile string, config string, audio bool) error {
+
+	xaddr, err := client.Endpoint(ctx, "media")
+	if err != nil {
+		return err
+	}
+
+	if audio {
+		return client.Call(ctx, xaddr, AddAudioEncoderConfiguration{ProfileToken: profile, ConfigurationToken: config}, nil)
+	}
+	return client.Call(ctx, xaddr, AddVideoEncoderConfiguration{ProfileToken: profile, ConfigurationToken: config}, nil)
+}
+
+// resolveProfiles return the media profiles with their stream URIs, using
+// Media2 when available and falling back to Media1
+func resolveProfiles(ctx context.Context, client *Client) ([]device.MediaProfile, error) {
+
+	if client.HasService(ctx, "media2") {
+		profiles, err := resolveMedia2Profiles(ctx, client)
+		if err == nil {
+			return profiles, nil
+		}
+		if IsNotAuthorized(err) {
+			return nil, err
+		}
+		log.Printf("Media2 failed, falling back to Media1: %s", err)
+	}
+
+	profiles, err := getProfiles(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	resolved := []device.MediaProfile{}
+	var failed error
+	for i, profile := range profiles {
+
+		// skip the profiles without stream, eg. an offline NVR channel
+		rtsp, err := getStreamURI(ctx, client, profile.Token, protocolRTSP)
+		if err != nil {
+			if IsNotAuthorized(err) {
+				return nil, err
+			}
+			log.Printf("Stream not available for profile=%s: %s", profile.Token, err)
+			failed = err
+			continue
+		}
+		profiles[i].RTSPURI = rtsp.URI
+		setValidity(&profiles[i], rtsp, now)
+
+		// RTSP over HTTP is optional
+		http, err := getStreamURI(ctx, client, profile.Token, protocolHTTP)
+		if err != nil {
+			log.Printf("HTTP stream not available for profile=%s: %s", profile.Token, err)
+		} else {
+			profiles[i].HTTPURI = http.URI
+			setValidity(&profiles[i], http, now)
+		}
+
+		profiles[i].SnapshotURI, err = getSnapshotURI(ctx, client, profile.Token)
+		if err != nil {
+			log.Printf("Snapshot not available for profile=%s: %s", profile.Token, err)
+		}
+
+		resolved = append(resolved, profiles[i])
+	}
+
+	if len(resolved) == 0 && failed != nil {
+		return nil, failed
+	}
+
+	return resolved, nil
+}
+
+// primaryProfile select the profile providing the MediaURI. The selector is a
+// profile token or name, highest or lowest by resolution, the first profile if
+// empty or not found
+func primaryProfile(profiles []device.MediaProfile, selector string) (device.MediaProfile, bool) {
+
+	if len(profiles) == 0 {
+		return device.MediaProfile{}, false
+	}
+
+	if p, ok := findProfile(profiles, selector); ok {
+		return p, true
+	}
+
+	log.Printf("Profile %s not found, using %s", selector, profiles[0].Token)
+	return profiles[0], true
+}
+
+// findProfile return the profile matching a selector as primaryProfile, false
+// if not found
+func findProfile(profiles []device.MediaProfile, selector string) (device.MediaProfile, bool) {
+
+	if len(profiles) == 0 {
+		return device.MediaProfile{}, false
+	}
+
+	pixels := func(p device.MediaProfile) int {
+		if p.Video == nil {
+			return 0
+		}
+		return p.Video.Width * p.Video.Height
+	}
+
+	sel := strings.ToLower(selector)
+	switch sel {
+	case "":
+		return profiles[0], true
+	case ProfileHighest, ProfileLowest:
+		selected := profiles[0]
+		for _, p := range profiles[1:] {
+			if (sel == ProfileHighest) == (pixels(p) > pixels(selected)) && pixels(p) != pixels(selected) {
+				selected = p
+			}
+		}
+		return selected, true
+	}
+
+	for _, p := range profiles {
+		if p.Token == selector || strings.EqualFold(p.Name, selector) {
+			return p, true
+		}
+	}
+
+	return device.MediaProfile{}, false
+}
@@ -0,0 +1,150 @@
+package onvif
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	media2ProtocolRTSP         = "RTSP"
+	media2ProtocolRtspOverHTTP = "RtspOverHttp"
+	media2ProtocolRTSPS        = "RTSPS"
+)
+
+// media2GetProfiles return the media profiles from the Media2 service
+func media2GetProfiles(ctx context.Context, client *Client) ([]device.MediaProfile, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media2")
+	if err != nil {
+		return nil, err
+	}
+
+	res := Media2GetProfilesResponse{}
+	err = client.Call(ctx, xaddr, Media2GetProfiles{Type: []string{"All"}}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := []device.MediaProfile{}
+	for _, p := range res.Body.GetProfilesResponse.Profiles {
+
+		profile := device.MediaProfile{
+			Token:  p.Token,
+			Name:   strings.TrimSpace(p.Name),
+			Media2: true,
+		}
+
+		if vsc := p.Configurations.VideoSource; vsc != nil {
+			profile.VideoSource = vsc.SourceToken
+		}
+
+		if vec := p.Configurations.VideoEncoder; vec != nil {
+			profile.Video = &device.VideoEncoder{
+				Token:     vec.Token,
+				Codec:     vec.Encoding,
+				Width:     vec.Resolution.Width,
+				Height:    vec.Resolution.Height,
+				FrameRate: vec.RateControl.FrameRateLimit,
+				Bitrate:   vec.RateControl.BitrateLimit,
+			}
+		}
+
+		if aec := p.Configurations.AudioEncoder; aec != nil {
+			profile.Audio = &device.AudioEncoder{
+				Token:      aec.Token,
+				Codec:      aec.Encoding,
+				Bitrate:    aec.Bitrate,
+				SampleRate: aec.SampleRate,
+			}
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// media2GetStreamURI return the stream URI of a profile from the Media2 service
+func media2GetStreamURI(ctx context.Context, client *Client, token string, protocol string) (string, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media2")
+	if err != nil {
+		return "", err
+	}
+
+	res := Media2GetStreamUriResponse{}
+	err = client.Call(ctx, xaddr, Media2GetStreamUri{Protocol: protocol, ProfileToken: token}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.GetStreamUriResponse.URI), nil
+}
+
+// media2GetSnapshotURI return the JPEG snapshot URI of a profile from the Media2 service
+func media2GetSnapshotURI(ctx context.Context, client *Client, token string) (string, error) {
+
+	xaddr, err := client.Endpoint(ctx, "media2")
+	if err != nil {
+		return "", err
+	}
+
+	res := Media2GetSnapshotUriResponse{}
+	err = client.Call(ctx, xaddr, Media2GetSnapshotUri{ProfileToken: token}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.GetSnapshotUriResponse.URI), nil
+}
+
+// resolveMedia2Profiles return the Media2 profiles with their RTSP, RTSP over HTTP and RTSPS stream URIs
+func resolveMedia2Profiles(ctx context.Context, client *Client) ([]device.MediaProfile, error) {
+
+	profiles, err := media2GetProfiles(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []device.MediaProfile{}
+	var failed error
+	for i, profile := range profiles {
+
+		// skip the profiles without stream, eg. an offline NVR channel
+		profiles[i].RTSPURI, err = media2GetStreamURI(ctx, client, profile.Token, media2ProtocolRTSP)
+		if err != nil {
+			if IsNotAuthorized(err) {
+				return nil, err
+			}
+			log.Printf("Stream not available for profile=%s: %s", profile.Token, err)
+			failed = err
+			continue
+		}
+
+		// RTSP over HTTP and RTSPS are optional
+		profiles[i].HTTPURI, err = media2GetStreamURI(ctx, client, profile.Token, media2ProtocolRtspOverHTTP)
+		if err != nil {
+			log.Printf("RtspOverHttp stream not available for profile=%s: %s", profile.Token, err)
+		}
+		profiles[i].RTSPSURI, err = media2GetStreamURI(ctx, client, profile.Token, media2ProtocolRTSPS)
+		if err != nil {
+			log.Printf("RTSPS stream not available for profile=%s: %s", profile.Token, err)
+		}
+
+		profiles[i].SnapshotURI, err = media2GetSnapshotURI(ctx, client, profile.Token)
+		if err != nil {
+			log.Printf("Snapshot not available for profile=%s: %s", profile.Token, err)
+		}
+
+		resolved = append(resolved, profiles[i])
+	}
+
+	if len(resolved) == 0 && failed != nil {
+		return nil, failed
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,29 @@
+package onvif
+
+import (
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveMedia2(t *testing.T) {
+
+	camera, dev := resolveCamera(t, simulator.Config{
+		Media2: true,
+		Profiles: []simulator.Profile{
+			{Token: "Main", Name: "Main", Encoding: "H265", Width: 3840, Height: 2160, FrameRate: 20, Bitrate: 8192},
+		},
+	}, NewAuthenticator(nil))
+	defer camera.Stop()
+
+	assert.Len(t, dev.Profiles, 1)
+	profile := dev.Profiles[0]
+	assert.True(t, profile.Media2)
+	assert.Equal(t, "H265", profile.Video.Codec)
+	assert.Equal(t, 3840, profile.Video.Width)
+	assert.Equal(t, "rtsp://127.0.0.1:554/Main", profile.RTSPURI)
+	assert.Equal(t, "http://127.0.0.1:80/rtsp-over-http/Main", profile.HTTPURI)
+	assert.Equal(t, "rtsps://127.0.0.1:322/Main", profile.RTSPSURI)
+	assert.Equal(t, profile.RTSPURI, dev.MediaURI)
+}
@@ -0,0 +1,53 @@
+package onvif
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMediaURI(t *testing.T) {
+
+	camera, dev := resolveCamera(t, simulator.Config{}, NewAuthenticator(nil))
+	defer camera.Stop()
+
+	assert.Equal(t, "rtsp://127.0.0.1:554/Profile_1", dev.MediaURI)
+	assert.Len(t, dev.Profiles, 2)
+
+	config := camera.Config()
+	assert.Equal(t, config.Manufacturer, dev.Manufacturer)
+	assert.Equal(t, config.FirmwareVersion, dev.FirmwareVersion)
+	assert.Equal(t, config.SerialNumber, dev.SerialNumber)
+	assert.Equal(t, config.Hostname, dev.Hostname)
+	assert.Equal(t, config.MAC, dev.MAC)
+
+	sub := dev.Profiles[1]
+	assert.Equal(t, "Profile_2", sub.Token)
+	assert.Equal(t, "SubStream", sub.Name)
+	assert.Equal(t, "H264", sub.Video.Codec)
+	assert.Equal(t, 640, sub.Video.Width)
+	assert.Equal(t, 360, sub.Video.Height)
+	assert.Equal(t, 15.0, sub.Video.FrameRate)
+	assert.Equal(t, 512, sub.Video.Bitrate)
+	assert.Equal(t, "rtsp://127.0.0.1:554/Profile_2", sub.RTSPURI)
+	assert.Equal(t, "http://127.0.0.1:80/rtsp-over-http/Profile_2", sub.HTTPURI)
+	assert.Equal(t, strings.TrimSuffix(camera.XAddr(), "device_service")+"snapshot/Profile_2.jpg", sub.SnapshotURI)
+	assert.Equal(t, dev.Profiles[0].SnapshotURI, dev.SnapshotURI)
+
+	err := resolveDevice(context.Background(), &dev, NewAuthenticator(nil), ProfileLowest)
+	if err != nil {
+		t.Fatalf("resolveDevice failed: %s", err)
+	}
+	assert.Equal(t, "rtsp://127.0.0.1:554/Profile_2", dev.MediaURI)
+
+	// selectors are case insensitive
+	primary, _ := primaryProfile(dev.Profiles, "Highest")
+	assert.Equal(t, "Profile_1", primary.Token)
+	primary, _ = primaryProfile(dev.Profiles, "LOWEST")
+	assert.Equal(t, "Profile_2", primary.Token)
+	primary, _ = primaryProfile(dev.Profiles, "substream")
+	assert.Equal(t, "Profile_2", primary.Token)
+}
@@ -1,88 +1,346 @@
 package onvif
 
 import (
-	"encoding/xml"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/url"
 	"time"
 
 	"github.com/muka/camd/device"
 	"github.com/muka/camd/onvif/discovery"
-	goonvif "github.com/use-go/onvif"
-	"github.com/use-go/onvif/media"
+	"github.com/spf13/viper"
 )
 
-// Discover devices on the network
-func Discover(emitter chan device.OnChangeEvent) error {
+// Discover devices on the network, until ctx is cancelled
+func Discover(ctx context.Context, emitter chan device.OnChangeEvent) error {
 
-	wsDiscovery := discovery.NewDiscovery()
+	wsDiscovery := discovery.NewDiscovery(
+		discovery.WithProxy(viper.GetViper().GetString("onvif.discovery_proxy")),
+	)
 
-	err := wsDiscovery.Start()
+	credentials, err := LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("invalid credentials: %s", err)
+	}
+	auth := NewAuthenticator(credentials)
+	trust, err := LoadTrust()
+	if err != nil {
+		return fmt.Errorf("invalid TLS settings: %s", err)
+	}
+	// alert of the certificates not matching their pin, eg. a device replaced
+	trust.OnCertificateChanged = func(dev device.Device, mismatch *PinMismatch) {
+		log.Printf("Certificate changed for %s: %s\n", dev.Name, mismatch)
+		notification := certificateAlert(dev, mismatch)
+		go func() {
+			select {
+			case emitter <- device.OnChangeEvent{Device: dev, Event: device.DeviceEvent, Notification: &notification}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+	auth.SetTrust(trust)
+	profile := viper.GetViper().GetString("onvif.profile")
+	policies, err := LoadEncoderPolicies()
+	if err != nil {
+		return fmt.Errorf("invalid encoder policies: %s", err)
+	}
+	cache := LoadSnapshotCache()
+
+	refresher := newMediaRefresher(auth, profile)
+	defer refresher.stop()
+
+	events := newEventsWatcher(auth, emitter, func(uuid string) {
+		refresher.rebooted(ctx, uuid)
+	})
+	err = events.start()
+	if err != nil {
+		return fmt.Errorf("events consumer failed: %s", err)
+	}
+	defer events.stop()
+
+	err = wsDiscovery.Start(ctx)
 	if err != nil {
 		return fmt.Errorf("listen failed: %s", err)
 	}
+	defer wsDiscovery.Stop()
 
+	retry := newResolveRetry()
+	defer retry.stop()
+
+	resolver := newResolver(resolveConcurrency(), func(ctx context.Context, dev *device.Device) error {
+		err := resolveDevice(ctx, dev, auth, profile)
+		if err == nil && len(policies) > 0 {
+			enforceEncoderPolicies(ctx, dev, auth, policies, profile)
+		}
+		return err
+	})
+	defer resolver.stop()
+
+	// devices holds the resolution state of the discovered devices, eg. the
+	// pending ones retried, while the registry receiving the events holds the
+	// devices published
 	devices := map[string]*device.Device{}
+	// channels holds the child devices of the NVRs, by parent UUID
+	channels := map[string][]device.Device{}
+
+	// updateChannels return the events of the channels of a device, nil
+	// channels if removed
+	updateChannels := func(dev device.Device, removed bool) []device.OnChangeEvent {
+		var children []device.Device
+		if !removed {
+			children = Channels(dev, profile)
+		}
+		events := channelEvents(channels[dev.UUID], children)
+		if len(children) > 0 {
+			channels[dev.UUID] = children
+		} else {
+			delete(channels, dev.UUID)
+		}
+		return events
+	}
+
+	// emit send the events, returning false if ctx is done
+	emit := func(events ...device.OnChangeEvent) bool {
+		for _, ev := range events {
+			select {
+			case emitter <- ev:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
 
 	for {
+		var ev device.OnChangeEvent
+		var err error
+		// done is true for the outcome of a resolution started below
+		done := false
 		select {
-		case ev := <-wsDiscovery.Matches:
-
-			if ev.Device.MediaURI == "" && ev.Event == device.DeviceAdded {
-				mediaURI, err := getMediaURI(ev.Device.Address)
-				if err != nil {
-					log.Printf("getMediaURI error: %s\n", err)
-					delete(devices, ev.Device.UUID)
-					continue
-				}
-
-				ev.Device.MediaURI = mediaURI
-				ev.Device.LastUpdate = time.Now().UnixNano()
-				devices[ev.Device.UUID] = &ev.Device
+		case <-ctx.Done():
+			return nil
+		case dev := <-refresher.Refreshed:
+			prev, ok := devices[dev.UUID]
+			if !ok {
+				continue
+			}
+			changed := mediaChanged(*prev, dev)
+			prev.Profiles = dev.Profiles
+			prev.MediaURI = dev.MediaURI
+			prev.SnapshotURI = dev.SnapshotURI
+			refresher.schedule(ctx, *prev)
+			if !changed {
+				continue
+			}
+
+			prev.LastUpdate = time.Now().UnixNano()
+			log.Printf("Refreshed ONVIF device name=%s source=%s\n", prev.Name, prev.MediaURI)
+
+			if !emit(device.OnChanged(*prev, device.DeviceUpdated)) {
+				return nil
+			}
+			if !emit(updateChannels(*prev, false)...) {
+				return nil
+			}
+			continue
+		case uuid := <-retry.Due:
+			prev, ok := devices[uuid]
+			if !ok || prev.ResolveError == "" || resolver.running(uuid) {
+				continue
+			}
+			// resolve again as a new device
+			resolver.start(ctx, device.OnChanged(*prev, device.DeviceAdded))
+			continue
+		case match, ok := <-wsDiscovery.Matches:
+			if !ok {
+				return nil
+			}
+			ev = match
+		case res := <-resolver.Done:
+			if !resolver.finish(res) {
+				continue
+			}
+			ev, err, done = res.ev, res.err, true
+		}
+
+		prev, known := devices[ev.Device.UUID]
+		pending := known && prev.ResolveError != ""
+
+		resolved := done && err == nil
+		// a pending device is notified as added once resolved
+		if resolved && pending && ev.Event == device.DeviceUpdated {
+			ev.Event = device.DeviceAdded
+		}
+
+		switch {
+		case done:
+		case ev.Event == device.DeviceAdded:
+			if ev.Device.MediaURI == "" {
+				resolver.start(ctx, ev)
+				continue
+			}
+		case ev.Event == device.DeviceUpdated:
+			// re-resolve the device only if pending or if the address or metadata changed
+			if known && !pending && prev.Address == ev.Device.Address && prev.MetadataVersion == ev.Device.MetadataVersion {
+				keepResolved(&ev.Device, prev)
+				break
 			}
+			resolver.start(ctx, ev)
+			continue
+		case ev.Event == device.DeviceRemoved:
+			delete(devices, ev.Device.UUID)
+			resolver.cancel(ev.Device.UUID)
+			events.unwatch(ev.Device.UUID)
+			refresher.remove(ev.Device.UUID)
+			retry.cancel(ev.Device.UUID)
+		}
 
-			op := "Added"
-			if ev.Event == device.DeviceRemoved {
-				op = "Removed"
+		if err != nil {
+			// keep the device as pending, retrying with backoff
+			events.unwatch(ev.Device.UUID)
+			refresher.remove(ev.Device.UUID)
+			notify := setPending(&ev, prev, err)
+			delay := retry.schedule(ctx, ev.Device.UUID, ev.Device.ResolveAttempts)
+			log.Printf("resolveDevice error for %s (attempt %d, retry in %s): %s\n", ev.Device.Name, ev.Device.ResolveAttempts, delay, err)
+			if !notify {
+				dev := ev.Device
+				devices[ev.Device.UUID] = &dev
+				continue
 			}
-			log.Printf("%s ONVIF device name=%s source=%s\n", op, ev.Device.Name, ev.Device.MediaURI)
+		}
 
-			emitter <- ev
+		if resolved {
+			retry.cancel(ev.Device.UUID)
+			ev.Device.ResolveError = ""
+			ev.Device.ResolveAttempts = 0
+			if cache != nil {
+				go prefetchSnapshot(ctx, ev.Device, auth, cache)
+			}
+			events.watch(ctx, ev.Device)
+			refresher.schedule(ctx, ev.Device)
+		}
 
-			break
+		if ev.Event != device.DeviceRemoved {
+			ev.Device.LastUpdate = time.Now().UnixNano()
+			dev := ev.Device
+			devices[ev.Device.UUID] = &dev
+		}
+
+		op := "Added"
+		switch ev.Event {
+		case device.DeviceRemoved:
+			op = "Removed"
+		case device.DeviceUpdated:
+			op = "Updated"
+		case device.DevicePending:
+			op = "Pending"
+		}
+		log.Printf("%s ONVIF device name=%s source=%s\n", op, ev.Device.Name, ev.Device.MediaURI)
+
+		if !emit(ev) {
+			return nil
+		}
+
+		// the channels of a pending device are kept as they are
+		if ev.Event != device.DevicePending {
+			children := updateChannels(ev.Device, ev.Event == device.DeviceRemoved)
+			if !emit(children...) {
+				return nil
+			}
 		}
 	}
 
 }
 
-func getMediaURI(uri string) (string, error) {
+// resolveDevice connect to the device and fill its information, media
+// profiles and MediaURI
+func resolveDevice(ctx context.Context, dev *device.Device, auth *Authenticator, profile string) error {
+
+	client, err := Connect(ctx, *dev, auth)
+	if err != nil {
+		return err
+	}
+
+	resolveClock(client, dev)
 
-	uriItems, err := url.Parse(uri)
+	err = resolveInfo(ctx, client, dev)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	dev, err := goonvif.NewDevice(uriItems.Host)
+	err = resolveServices(ctx, client, dev)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	res, err := dev.CallMethod(media.GetStreamUri{})
+	err = resolveMedia(ctx, client, dev, profile)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	b, err := ioutil.ReadAll(res.Body)
+	resolveVideoSources(ctx, client, dev)
+	markContainer(dev, profile)
+	resolveIO(ctx, client, dev)
+	resolveRecordings(ctx, client, dev)
+	return nil
+}
+
+// keepResolved copy the fields resolved by resolveDevice from the previous
+// state of the device
+func keepResolved(dev *device.Device, prev *device.Device) {
+	dev.MediaURI = prev.MediaURI
+	dev.Profiles = prev.Profiles
+	dev.SnapshotURI = prev.SnapshotURI
+	dev.Manufacturer = prev.Manufacturer
+	dev.Model = prev.Model
+	dev.FirmwareVersion = prev.FirmwareVersion
+	dev.SerialNumber = prev.SerialNumber
+	dev.HardwareID = prev.HardwareID
+	dev.Hostname = prev.Hostname
+	dev.Services = prev.Services
+	dev.Capabilities = prev.Capabilities
+	dev.ClockSkew = prev.ClockSkew
+	dev.PolicyViolations = prev.PolicyViolations
+	dev.Recordings = prev.Recordings
+	dev.RelayOutputs = prev.RelayOutputs
+	dev.DigitalInputs = prev.DigitalInputs
+	dev.VideoSources = prev.VideoSources
+	dev.Container = prev.Container
+	if prev.MAC != "" {
+		dev.MAC = prev.MAC
+	}
+}
+
+// resolveMedia fill the device media profiles and MediaURI
+func resolveMedia(ctx context.Context, client *Client, dev *device.Device, profile string) error {
+
+	profiles, err := resolveProfiles(ctx, client)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	getStremUriResponse := GetStremUriResponse{}
-	if err = xml.Unmarshal(b, &getStremUriResponse); err != nil {
-		return "", err
+	dev.Profiles = profiles
+	if primary, ok := primaryProfile(profiles, profile); ok {
+		dev.MediaURI = primary.RTSPURI
+		dev.SnapshotURI = primary.SnapshotURI
 	}
+	markContainer(dev, profile)
 
-	return getStremUriResponse.GetURI(), nil
+	return nil
+}
+
+// prefetchSnapshot store the device thumbnail in the cache
+func prefetchSnapshot(ctx context.Context, dev device.Device, auth *Authenticator, cache *SnapshotCache) {
+
+	if dev.SnapshotURI == "" {
+		return
+	}
+
+	client, err := Connect(ctx, dev, auth)
+	if err == nil {
+		_, err = FetchSnapshot(ctx, client, dev, "", cache)
+	}
+	if err != nil {
+		log.Printf("Snapshot fetch failed for %s: %s\n", dev.Name, err)
+	}
 }
@@ -0,0 +1,45 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+)
+
+// startCamera start a simulated camera, returning the device to reach it
+func startCamera(t *testing.T, config simulator.Config) (*simulator.Camera, device.Device) {
+	camera := simulator.NewCamera(config)
+	err := camera.Start()
+	if err != nil {
+		t.Fatalf("Failed to start camera: %s", err)
+	}
+	dev := device.Device{
+		UUID:     camera.UUID(),
+		Address:  camera.XAddr(),
+		Hardware: camera.Config().Hardware,
+	}
+	return camera, dev
+}
+
+// connectCamera start a simulated camera and connect to it without credentials
+func connectCamera(t *testing.T, config simulator.Config) (*simulator.Camera, device.Device, *Client) {
+	camera, dev := startCamera(t, config)
+	client, err := Connect(context.Background(), dev, NewAuthenticator(nil))
+	if err != nil {
+		camera.Stop()
+		t.Fatalf("Connect failed: %s", err)
+	}
+	return camera, dev, client
+}
+
+// resolveCamera start a simulated camera and resolve it as discovered
+func resolveCamera(t *testing.T, config simulator.Config, auth *Authenticator) (*simulator.Camera, device.Device) {
+	camera, dev := startCamera(t, config)
+	if err := resolveDevice(context.Background(), &dev, auth, ""); err != nil {
+		camera.Stop()
+		t.Fatalf("resolveDevice failed: %s", err)
+	}
+	return camera, dev
+}
@@ -0,0 +1,232 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// PTZPosition a pan, tilt and zoom value, used as a position, translation or
+// speed in the generic spaces: -1 to 1 for pan and tilt, 0 to 1 for zoom
+type PTZPosition struct {
+	Pan  float64 `json:"pan"`
+	Tilt float64 `json:"tilt"`
+	Zoom float64 `json:"zoom"`
+}
+
+func (p PTZPosition) vector() PTZVector {
+	return PTZVector{
+		PanTilt: &Vector2D{X: p.Pan, Y: p.Tilt},
+		Zoom:    &Vector1D{X: p.Zoom},
+	}
+}
+
+func (p *PTZPosition) speed() *PTZVector {
+	if p == nil {
+		return nil
+	}
+	v := p.vector()
+	return &v
+}
+
+func positionOf(v *PTZVector) *PTZPosition {
+	if v == nil {
+		return nil
+	}
+	p := &PTZPosition{}
+	if v.PanTilt != nil {
+		p.Pan = v.PanTilt.X
+		p.Tilt = v.PanTilt.Y
+	}
+	if v.Zoom != nil {
+		p.Zoom = v.Zoom.X
+	}
+	return p
+}
+
+// Preset a stored PTZ position
+type Preset struct {
+	Token    string       `json:"token"`
+	Name     string       `json:"name"`
+	Position *PTZPosition `json:"position,omitempty"`
+}
+
+// PTZStatus the current position and movement of a PTZ unit
+type PTZStatus struct {
+	Position PTZPosition `json:"position"`
+	// PanTilt and Zoom are the move status, one of IDLE, MOVING or UNKNOWN
+	PanTilt string `json:"panTilt"`
+	Zoom    string `json:"zoom"`
+}
+
+// NewPTZ init a PTZ controller for a media profile. If profile is empty,
+// the profile selected by onvif.profile is used.
+func NewPTZ(ctx context.Context, client *Client, profile string) (*PTZ, error) {
+
+	xaddr, err := client.Endpoint(ctx, "ptz")
+	if err != nil {
+		return nil, err
+	}
+
+	if profile == "" {
+		profiles, err := getProfiles(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		primary, ok := primaryProfile(profiles, viper.GetViper().GetString("onvif.profile"))
+		if !ok {
+			return nil, errors.New("No media profile available")
+		}
+		profile = primary.Token
+	}
+
+	return &PTZ{
+		client:  client,
+		xaddr:   xaddr,
+		profile: profile,
+	}, nil
+}
+
+// PTZ control the pan, tilt and zoom of a media profile
+type PTZ struct {
+	client  *Client
+	xaddr   string
+	profile string
+}
+
+// Profile return the media profile token
+func (p *PTZ) Profile() string {
+	return p.profile
+}
+
+// ContinuousMove start moving at velocity, until Stop is called or the
+// timeout expires (if not zero)
+func (p *PTZ) ContinuousMove(ctx context.Context, velocity PTZPosition, timeout time.Duration) error {
+	req := ContinuousMove{
+		ProfileToken: p.profile,
+		Velocity:     velocity.vector(),
+	}
+	if timeout > 0 {
+		req.Timeout = xsdDuration(timeout)
+	}
+	return p.client.Call(ctx, p.xaddr, req, nil)
+}
+
+// AbsoluteMove move to a position, at the default speed if speed is nil
+func (p *PTZ) AbsoluteMove(ctx context.Context, position PTZPosition, speed *PTZPosition) error {
+	return p.client.Call(ctx, p.xaddr, AbsoluteMove{
+		ProfileToken: p.profile,
+		Position:     position.vector(),
+		Speed:        speed.speed(),
+	}, nil)
+}
+
+// RelativeMove move by a translation, at the default speed if speed is nil
+func (p *PTZ) RelativeMove(ctx context.Context, translation PTZPosition, speed *PTZPosition) error {
+	return p.client.Call(ctx, p.xaddr, RelativeMove{
+		ProfileToken: p.profile,
+		Translation:  translation.vector(),
+		Speed:        speed.speed(),
+	}, nil)
+}
+
+// Stop stop all the movements
+func (p *PTZ) Stop(ctx context.Context) error {
+	return p.client.Call(ctx, p.xaddr, Stop{
+		ProfileToken: p.profile,
+		PanTilt:      true,
+		Zoom:         true,
+	}, nil)
+}
+
+// Presets return the stored presets
+func (p *PTZ) Presets(ctx context.Context) ([]Preset, error) {
+
+	res := GetPresetsResponse{}
+	err := p.client.Call(ctx, p.xaddr, GetPresets{ProfileToken: p.profile}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	presets := []Preset{}
+	for _, preset := range res.Body.GetPresetsResponse.Preset {
+		presets = append(presets, Preset{
+			Token:    preset.Token,
+			Name:     strings.TrimSpace(preset.Name),
+			Position: positionOf(preset.PTZPosition),
+		})
+	}
+
+	return presets, nil
+}
+
+// FindPreset return the preset matching a token or name
+func (p *PTZ) FindPreset(ctx context.Context, preset string) (Preset, error) {
+
+	presets, err := p.Presets(ctx)
+	if err != nil {
+		return Preset{}, err
+	}
+
+	for _, candidate := range presets {
+		if candidate.Token == preset || strings.EqualFold(candidate.Name, preset) {
+			return candidate, nil
+		}
+	}
+
+	return Preset{}, errors.New("Preset " + preset + " not found")
+}
+
+// GotoPreset move to a preset, at the default speed if speed is nil
+func (p *PTZ) GotoPreset(ctx context.Context, token string, speed *PTZPosition) error {
+	return p.client.Call(ctx, p.xaddr, GotoPreset{
+		ProfileToken: p.profile,
+		PresetToken:  token,
+		Speed:        speed.speed(),
+	}, nil)
+}
+
+// SetPreset store the current position as a preset named name, replacing the
+// preset token if not empty, and return the preset token
+func (p *PTZ) SetPreset(ctx context.Context, name string, token string) (string, error) {
+
+	res := SetPresetResponse{}
+	err := p.client.Call(ctx, p.xaddr, SetPreset{
+		ProfileToken: p.profile,
+		PresetName:   name,
+		PresetToken:  token,
+	}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.SetPresetResponse.PresetToken), nil
+}
+
+// GotoHomePosition move to the home position, at the default speed if speed is nil
+func (p *PTZ) GotoHomePosition(ctx context.Context, speed *PTZPosition) error {
+	return p.client.Call(ctx, p.xaddr, GotoHomePosition{
+		ProfileToken: p.profile,
+		Speed:        speed.speed(),
+	}, nil)
+}
+
+// Status return the current position and move status
+func (p *PTZ) Status(ctx context.Context) (PTZStatus, error) {
+
+	res := PTZGetStatusResponse{}
+	err := p.client.Call(ctx, p.xaddr, PTZGetStatus{ProfileToken: p.profile}, &res)
+	if err != nil {
+		return PTZStatus{}, err
+	}
+
+	status := res.Body.GetStatusResponse.PTZStatus
+	return PTZStatus{
+		Position: *positionOf(&status.Position),
+		PanTilt:  strings.TrimSpace(status.MoveStatus.PanTilt),
+		Zoom:     strings.TrimSpace(status.MoveStatus.Zoom),
+	}, nil
+}
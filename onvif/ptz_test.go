@@ -0,0 +1,57 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPTZ(t *testing.T) {
+
+	camera, _, client := connectCamera(t, simulator.Config{PTZ: true})
+	defer camera.Stop()
+
+	ctx := context.Background()
+	ptz, err := NewPTZ(ctx, client, "")
+	if err != nil {
+		t.Fatalf("NewPTZ failed: %s", err)
+	}
+	assert.Equal(t, "Profile_1", ptz.Profile())
+
+	err = ptz.AbsoluteMove(ctx, PTZPosition{Pan: 0.5, Tilt: -0.25, Zoom: 0.5}, nil)
+	assert.NoError(t, err)
+
+	status, err := ptz.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, PTZPosition{Pan: 0.5, Tilt: -0.25, Zoom: 0.5}, status.Position)
+	assert.Equal(t, "IDLE", status.PanTilt)
+
+	token, err := ptz.SetPreset(ctx, "Door", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	err = ptz.GotoHomePosition(ctx, nil)
+	assert.NoError(t, err)
+	status, err = ptz.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, PTZPosition{}, status.Position)
+
+	preset, err := ptz.FindPreset(ctx, "door")
+	assert.NoError(t, err)
+	assert.Equal(t, token, preset.Token)
+
+	err = ptz.GotoPreset(ctx, preset.Token, nil)
+	assert.NoError(t, err)
+	status, err = ptz.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, PTZPosition{Pan: 0.5, Tilt: -0.25, Zoom: 0.5}, status.Position)
+
+	// a camera without PTZ service
+	camera2, _, client2 := connectCamera(t, simulator.Config{})
+	defer camera2.Stop()
+
+	_, err = NewPTZ(ctx, client2, "")
+	assert.Error(t, err)
+}
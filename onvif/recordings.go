@@ -0,0 +1,195 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+const (
+	// searchKeepAlive is how long the device keeps an idle search
+	searchKeepAlive = "PT10S"
+	// searchWait is how long the device may wait for results
+	searchWait = "PT5S"
+	searchPage = 100
+	// searchMaxPages bounds the results requested while the device is still
+	// searching, and searchTimeout the search done by resolveRecordings
+	searchMaxPages = 50
+	searchTimeout  = 30 * time.Second
+)
+
+// RecordingSummary the time range of all the recordings of a device
+type RecordingSummary struct {
+	From       time.Time `json:"from"`
+	Until      time.Time `json:"until"`
+	Recordings int       `json:"recordings"`
+}
+
+// parseDateTime parse an xsd:dateTime, zero if invalid
+func parseDateTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// RecordingsSummary return the time range and number of the recordings
+func RecordingsSummary(ctx context.Context, client *Client) (RecordingSummary, error) {
+
+	xaddr, err := client.Endpoint(ctx, "search")
+	if err != nil {
+		return RecordingSummary{}, err
+	}
+
+	res := GetRecordingSummaryResponse{}
+	err = client.Call(ctx, xaddr, GetRecordingSummary{}, &res)
+	if err != nil {
+		return RecordingSummary{}, err
+	}
+
+	summary := res.Body.GetRecordingSummaryResponse.Summary
+	return RecordingSummary{
+		From:       parseDateTime(summary.DataFrom),
+		Until:      parseDateTime(summary.DataUntil),
+		Recordings: summary.NumberRecordings,
+	}, nil
+}
+
+// SearchRecordings search the recordings of the device, with their replay URI
+// if the device supports the replay service. It fails if the device is still
+// searching after searchMaxPages requests.
+func SearchRecordings(ctx context.Context, client *Client) ([]device.Recording, error) {
+
+	xaddr, err := client.Endpoint(ctx, "search")
+	if err != nil {
+		return nil, err
+	}
+
+	res := FindRecordingsResponse{}
+	err = client.Call(ctx, xaddr, FindRecordings{KeepAliveTime: searchKeepAlive}, &res)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(res.Body.FindRecordingsResponse.SearchToken)
+	defer func() {
+		// end the search even if ctx is done, not to keep it on the device
+		end, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Call(end, xaddr, EndSearch{SearchToken: token}, nil); err != nil {
+			log.Printf("EndSearch failed: %s", err)
+		}
+	}()
+
+	recordings := []device.Recording{}
+	for page := 1; ; page++ {
+		results := GetRecordingSearchResultsResponse{}
+		err = client.Call(ctx, xaddr, GetRecordingSearchResults{
+			SearchToken: token,
+			MaxResults:  searchPage,
+			WaitTime:    searchWait,
+		}, &results)
+		if err != nil {
+			return nil, err
+		}
+
+		list := results.Body.GetRecordingSearchResultsResponse.ResultList
+		for _, info := range list.RecordingInformation {
+			recordings = append(recordings, parseRecording(info))
+		}
+
+		// Queued or Searching until all the results are returned
+		state := strings.TrimSpace(list.SearchState)
+		if state != "Queued" && state != "Searching" {
+			break
+		}
+		if page == searchMaxPages {
+			return nil, fmt.Errorf("Search not completed after %d requests (%s)", page, state)
+		}
+	}
+
+	if client.HasService(ctx, "replay") {
+		for i, recording := range recordings {
+			uri, err := GetReplayURI(ctx, client, recording.Token)
+			if err != nil {
+				log.Printf("Replay URI not available for recording=%s: %s", recording.Token, err)
+				continue
+			}
+			recordings[i].ReplayURI = uri
+		}
+	}
+
+	return recordings, nil
+}
+
+func parseRecording(info RecordingInformation) device.Recording {
+
+	recording := device.Recording{
+		Token:      strings.TrimSpace(info.RecordingToken),
+		SourceID:   strings.TrimSpace(info.Source.SourceID),
+		SourceName: strings.TrimSpace(info.Source.Name),
+		Content:    strings.TrimSpace(info.Content),
+		Start:      parseDateTime(info.EarliestRecording),
+		End:        parseDateTime(info.LatestRecording),
+		Status:     strings.TrimSpace(info.RecordingStatus),
+	}
+
+	for _, track := range info.Track {
+		recording.Tracks = append(recording.Tracks, device.RecordingTrack{
+			Token:       strings.TrimSpace(track.TrackToken),
+			Type:        strings.TrimSpace(track.TrackType),
+			Description: strings.TrimSpace(track.Description),
+			Start:       parseDateTime(track.DataFrom),
+			End:         parseDateTime(track.DataTo),
+		})
+	}
+
+	return recording
+}
+
+// GetReplayURI return the RTSP URI replaying a recording
+func GetReplayURI(ctx context.Context, client *Client, token string) (string, error) {
+
+	xaddr, err := client.Endpoint(ctx, "replay")
+	if err != nil {
+		return "", err
+	}
+
+	req := GetReplayUri{RecordingToken: token}
+	req.StreamSetup.Stream = "RTP-Unicast"
+	req.StreamSetup.Transport.Protocol = protocolRTSP
+
+	res := GetReplayUriResponse{}
+	err = client.Call(ctx, xaddr, req, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(res.Body.GetReplayUriResponse.Uri), nil
+}
+
+// resolveRecordings fill the device recordings, if enabled by onvif.recordings
+// and supported by the device
+func resolveRecordings(ctx context.Context, client *Client, dev *device.Device) {
+
+	dev.Recordings = nil
+	if !viper.GetViper().GetBool("onvif.recordings") || !client.HasService(ctx, "search") {
+		return
+	}
+
+	// a device never completing the search must not stall the discovery
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	recordings, err := SearchRecordings(ctx, client)
+	if err != nil {
+		log.Printf("Recordings not available for %s: %s", dev.Name, err)
+		return
+	}
+	dev.Recordings = recordings
+}
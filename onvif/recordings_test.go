@@ -0,0 +1,54 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordings(t *testing.T) {
+
+	start := time.Date(2020, 10, 1, 8, 0, 0, 0, time.UTC)
+	camera, _, client := connectCamera(t, simulator.Config{
+		Recording: true,
+		Recordings: []simulator.Recording{
+			{Token: "Recording_1", Start: start, End: start.Add(time.Hour)},
+			{Token: "Recording_2", Start: start.Add(2 * time.Hour)},
+		},
+	})
+	defer camera.Stop()
+
+	ctx := context.Background()
+
+	summary, err := RecordingsSummary(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Recordings)
+	assert.Equal(t, start, summary.From)
+
+	recordings, err := SearchRecordings(ctx, client)
+	assert.NoError(t, err)
+	assert.Len(t, recordings, 2)
+	assert.Equal(t, "Recording_1", recordings[0].Token)
+	assert.Equal(t, start.Add(time.Hour), recordings[0].End)
+	assert.Equal(t, "Stopped", recordings[0].Status)
+	assert.Equal(t, "Recording", recordings[1].Status)
+	assert.Len(t, recordings[1].Tracks, 1)
+	assert.Equal(t, "Video", recordings[1].Tracks[0].Type)
+	assert.Equal(t, "rtsp://127.0.0.1:554/replay/Recording_2", recordings[1].ReplayURI)
+
+	_, err = GetReplayURI(ctx, client, "Recording_3")
+	assert.Error(t, err)
+
+	other, _, otherClient := connectCamera(t, simulator.Config{})
+	defer other.Stop()
+	assert.False(t, otherClient.HasService(ctx, "search"))
+
+	// a search never completing fails rather than looping
+	stuck, _, stuckClient := connectCamera(t, simulator.Config{Recording: true, SearchStuck: true})
+	defer stuck.Stop()
+	_, err = SearchRecordings(ctx, stuckClient)
+	assert.Error(t, err)
+}
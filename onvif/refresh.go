@@ -0,0 +1,300 @@
+package onvif
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+const (
+	// refreshMargin is how long before they expire the stream URIs are refreshed
+	refreshMargin = 10 * time.Second
+	// refreshRetry is the delay before retrying a failed refresh
+	refreshRetry = 30 * time.Second
+	// defaultRebootPoll is how often the devices with stream URIs invalidated
+	// by a reboot are probed, to notice the reboots without events
+	defaultRebootPoll = 5 * time.Minute
+	// rebootClockJump is how far back the device clock must go to be
+	// considered reset by a reboot
+	rebootClockJump = time.Minute
+)
+
+// rebootPoll return the probing interval of the devices with stream URIs
+// invalidated by a reboot from onvif.reboot_poll, disabled if negative
+func rebootPoll() time.Duration {
+	poll := viper.GetViper().GetDuration("onvif.reboot_poll")
+	if poll == 0 {
+		return defaultRebootPoll
+	}
+	return poll
+}
+
+// refreshTime return when the stream URIs of a device must be refreshed,
+// zero if they do not expire
+func refreshTime(dev device.Device) time.Time {
+
+	expires := int64(0)
+	for _, profile := range dev.Profiles {
+		if profile.URIExpires != 0 && (expires == 0 || profile.URIExpires < expires) {
+			expires = profile.URIExpires
+		}
+	}
+	if expires == 0 {
+		return time.Time{}
+	}
+
+	// refresh at half the lifetime if it is shorter than twice the margin
+	expiry := time.Unix(0, expires)
+	lifetime := time.Until(expiry)
+	if lifetime < 2*refreshMargin {
+		return time.Now().Add(lifetime / 2)
+	}
+	return expiry.Add(-refreshMargin)
+}
+
+// invalidAfterReboot return if any stream URI of a device changes on reboot
+func invalidAfterReboot(dev device.Device) bool {
+	for _, profile := range dev.Profiles {
+		if profile.InvalidAfterReboot {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaChanged return if the stream URIs of the device changed
+func mediaChanged(prev device.Device, dev device.Device) bool {
+
+	if prev.MediaURI != dev.MediaURI || len(prev.Profiles) != len(dev.Profiles) {
+		return true
+	}
+
+	for i, profile := range dev.Profiles {
+		p := prev.Profiles[i]
+		if p.Token != profile.Token || p.RTSPURI != profile.RTSPURI || p.HTTPURI != profile.HTTPURI || p.RTSPSURI != profile.RTSPSURI {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newMediaRefresher init the refresh of the stream URIs expiring or
+// invalidated by a reboot. The refreshed devices are sent to Refreshed.
+func newMediaRefresher(auth *Authenticator, profile string) *mediaRefresher {
+	return &mediaRefresher{
+		Refreshed:  make(chan device.Device),
+		auth:       auth,
+		profile:    profile,
+		devices:    map[string]device.Device{},
+		timers:     map[string]*time.Timer{},
+		probes:     map[string]rebootProbe{},
+		rebootPoll: rebootPoll(),
+	}
+}
+
+// rebootProbe the last state of a device probed for a reboot: its clock
+// offset and if it did not answer
+type rebootProbe struct {
+	offset time.Duration
+	down   bool
+}
+
+// mediaRefresher schedule the refresh of the devices stream URIs
+type mediaRefresher struct {
+	Refreshed chan device.Device
+	auth      *Authenticator
+	profile   string
+	mut       sync.Mutex
+	devices   map[string]device.Device
+	timers    map[string]*time.Timer
+	// rebootPoll is the probing interval of the devices with stream URIs
+	// invalidated by a reboot, as the reboots are only notified by the
+	// events, if enabled. The stream URIs are fetched again only once a
+	// probe notices a reboot.
+	rebootPoll time.Duration
+	probes     map[string]rebootProbe
+}
+
+// schedule the refresh of a device stream URIs before they expire,
+// replacing a previous schedule
+func (r *mediaRefresher) schedule(ctx context.Context, dev device.Device) {
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.next(ctx, dev)
+}
+
+// next schedule the next refresh or reboot probe of a device
+func (r *mediaRefresher) next(ctx context.Context, dev device.Device) {
+
+	r.cancelTimer(dev.UUID)
+	r.devices[dev.UUID] = dev
+
+	at := refreshTime(dev)
+	probe := false
+	if invalidAfterReboot(dev) && r.rebootPoll > 0 {
+		if _, ok := r.probes[dev.UUID]; !ok {
+			r.probes[dev.UUID] = rebootProbe{offset: dev.ClockSkew}
+		}
+		if poll := time.Now().Add(r.rebootPoll); at.IsZero() || poll.Before(at) {
+			at = poll
+			probe = true
+		}
+	}
+	if at.IsZero() {
+		return
+	}
+
+	r.after(ctx, dev.UUID, time.Until(at), probe)
+}
+
+// rebooted refresh the stream URIs of a device that rebooted, if they are
+// invalidated by a reboot
+func (r *mediaRefresher) rebooted(ctx context.Context, uuid string) {
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	dev, ok := r.devices[uuid]
+	if !ok || !invalidAfterReboot(dev) {
+		return
+	}
+
+	log.Printf("Device %s rebooted, refreshing its stream URIs", dev.Name)
+	r.cancelTimer(uuid)
+	r.after(ctx, uuid, 0, false)
+}
+
+// remove cancel the refresh of a device
+func (r *mediaRefresher) remove(uuid string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.cancelTimer(uuid)
+	delete(r.devices, uuid)
+	delete(r.probes, uuid)
+}
+
+// stop cancel all the scheduled refreshes
+func (r *mediaRefresher) stop() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for uuid := range r.timers {
+		r.cancelTimer(uuid)
+	}
+}
+
+func (r *mediaRefresher) cancelTimer(uuid string) {
+	if timer, ok := r.timers[uuid]; ok {
+		timer.Stop()
+		delete(r.timers, uuid)
+	}
+}
+
+// after refresh the stream URIs of a device after delay, or probe it for a
+// reboot if probe is true
+func (r *mediaRefresher) after(ctx context.Context, uuid string, delay time.Duration, probe bool) {
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		r.mut.Lock()
+		current, ok := r.timers[uuid]
+		dev := r.devices[uuid]
+		r.mut.Unlock()
+		// cancelled or replaced
+		if !ok || current != timer {
+			return
+		}
+		if probe {
+			r.probe(ctx, dev, timer)
+			return
+		}
+		r.refresh(ctx, dev, timer)
+	})
+	r.timers[uuid] = timer
+}
+
+// refresh resolve again the device media, retrying on failure
+func (r *mediaRefresher) refresh(ctx context.Context, dev device.Device, timer *time.Timer) {
+
+	err := refreshMedia(ctx, &dev, r.auth, r.profile)
+	if err != nil {
+		log.Printf("Stream URIs refresh failed for %s: %s", dev.Name, err)
+		r.mut.Lock()
+		if r.timers[dev.UUID] == timer {
+			r.after(ctx, dev.UUID, refreshRetry, false)
+		}
+		r.mut.Unlock()
+		return
+	}
+
+	// the clock measured on connect is the reference of the next probes
+	r.mut.Lock()
+	if _, ok := r.probes[dev.UUID]; ok {
+		r.probes[dev.UUID] = rebootProbe{offset: dev.ClockSkew}
+	}
+	r.mut.Unlock()
+
+	select {
+	case r.Refreshed <- dev:
+	case <-ctx.Done():
+	}
+}
+
+// probe refresh the stream URIs of a device once it rebooted, else schedule
+// the next probe
+func (r *mediaRefresher) probe(ctx context.Context, dev device.Device, timer *time.Timer) {
+
+	if r.probeReboot(ctx, dev) {
+		log.Printf("Device %s rebooted, refreshing its stream URIs", dev.Name)
+		r.refresh(ctx, dev, timer)
+		return
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.timers[dev.UUID] == timer {
+		r.next(ctx, dev)
+	}
+}
+
+// probeReboot return true if a device rebooted since the last probe, as it
+// did not answer or its clock went back. GetSystemDateAndTime is used as the
+// devices answer it without authentication.
+func (r *mediaRefresher) probeReboot(ctx context.Context, dev device.Device) bool {
+
+	client := NewClient(dev.Address, Credential{})
+	if trust := r.auth.Trust(); trust != nil {
+		client.SetTLSConfig(trust.TLSConfig(dev))
+	}
+	offset, err := getClockOffset(ctx, client)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	last, known := r.probes[dev.UUID]
+	if err != nil {
+		last.down = true
+		r.probes[dev.UUID] = last
+		return false
+	}
+	r.probes[dev.UUID] = rebootProbe{offset: offset}
+
+	return known && (last.down || offset < last.offset-rebootClockJump)
+}
+
+// refreshMedia fetch again the device media profiles and stream URIs, and
+// its clock skew
+func refreshMedia(ctx context.Context, dev *device.Device, auth *Authenticator, profile string) error {
+
+	client, err := Connect(ctx, *dev, auth)
+	if err != nil {
+		return err
+	}
+	resolveClock(client, dev)
+
+	return resolveMedia(ctx, client, dev, profile)
+}
@@ -0,0 +1,82 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshMedia(t *testing.T) {
+
+	auth := NewAuthenticator(nil)
+	camera, dev := resolveCamera(t, simulator.Config{
+		Profiles: []simulator.Profile{
+			{Token: "Profile_1", Name: "MainStream", Width: 1920, Height: 1080, URITimeout: 2 * time.Second, InvalidAfterReboot: true, InvalidAfterConnect: true},
+		},
+		ResetClock: true,
+	}, auth)
+	defer camera.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.True(t, dev.Profiles[0].InvalidAfterReboot)
+	assert.True(t, dev.Profiles[0].InvalidAfterConnect)
+	assert.NotZero(t, dev.Profiles[0].URIExpires)
+
+	refresher := newMediaRefresher(auth, "")
+	defer refresher.stop()
+
+	refreshed := func() device.Device {
+		select {
+		case next := <-refresher.Refreshed:
+			return next
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stream URIs not refreshed")
+		}
+		return device.Device{}
+	}
+
+	// refreshed at half of the timeout
+	refresher.schedule(ctx, dev)
+	next := refreshed()
+	assert.True(t, mediaChanged(dev, next))
+	assert.NotEqual(t, dev.MediaURI, next.MediaURI)
+
+	// refreshed on reboot
+	refresher.schedule(ctx, next)
+	assert.NoError(t, camera.Reboot())
+	refresher.rebooted(ctx, dev.UUID)
+	rebooted := refreshed()
+	assert.Contains(t, rebooted.MediaURI, "boot=1")
+
+	// the clock set after the reboot is not mistaken for a reboot
+	client, err := Connect(ctx, dev, auth)
+	if assert.NoError(t, err) {
+		assert.NoError(t, SyncTime(ctx, client, false))
+	}
+	refresher.rebootPoll = 100 * time.Millisecond
+	dev.Profiles[0].URIExpires = 0
+	dev.MediaURI = rebooted.MediaURI
+	refresher.schedule(ctx, dev)
+	select {
+	case <-refresher.Refreshed:
+		t.Fatal("Stream URIs refreshed without reboot")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// noticed by probing, without events, as the clock went back
+	assert.NoError(t, camera.Reboot())
+	polled := refreshed()
+	assert.Contains(t, polled.MediaURI, "boot=2")
+
+	// or as the device did not answer for a while
+	down := dev
+	down.Address = "http://127.0.0.1:1/onvif/device_service"
+	assert.False(t, refresher.probeReboot(ctx, down))
+	assert.True(t, refresher.probeReboot(ctx, dev))
+	assert.False(t, refresher.probeReboot(ctx, dev))
+}
@@ -0,0 +1,128 @@
+package onvif
+
+import (
+	"context"
+	"sync"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+// defaultResolveConcurrency is the number of devices resolved at the same time
+const defaultResolveConcurrency = 8
+
+// resolveConcurrency return the onvif.resolve_concurrency setting
+func resolveConcurrency() int {
+	concurrency := viper.GetViper().GetInt("onvif.resolve_concurrency")
+	if concurrency <= 0 {
+		concurrency = defaultResolveConcurrency
+	}
+	return concurrency
+}
+
+// resolution the outcome of the resolution of an event device
+type resolution struct {
+	ev  device.OnChangeEvent
+	err error
+	id  int
+}
+
+type resolveJob struct {
+	id     int
+	cancel context.CancelFunc
+}
+
+// newResolver init the workers resolving at most concurrency devices at a time
+func newResolver(concurrency int, resolve func(ctx context.Context, dev *device.Device) error) *resolver {
+	return &resolver{
+		Done:    make(chan resolution),
+		slots:   make(chan struct{}, concurrency),
+		resolve: resolve,
+		jobs:    map[string]*resolveJob{},
+	}
+}
+
+// resolver resolve the devices in the background, so that a device slow to
+// answer does not delay the others, sending the outcomes to Done. A single
+// resolution runs per device, a new one cancelling the previous.
+type resolver struct {
+	Done    chan resolution
+	slots   chan struct{}
+	resolve func(ctx context.Context, dev *device.Device) error
+	mut     sync.Mutex
+	nextID  int
+	jobs    map[string]*resolveJob
+}
+
+// start resolving the device of an event, replacing a running resolution
+func (r *resolver) start(ctx context.Context, ev device.OnChangeEvent) {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.mut.Lock()
+	r.cancelJob(ev.Device.UUID)
+	r.nextID++
+	id := r.nextID
+	r.jobs[ev.Device.UUID] = &resolveJob{id: id, cancel: cancel}
+	r.mut.Unlock()
+
+	go func() {
+		select {
+		case r.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		err := r.resolve(ctx, &ev.Device)
+		<-r.slots
+
+		select {
+		case r.Done <- resolution{ev: ev, err: err, id: id}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// finish return false if the resolution was cancelled or replaced, else
+// release it
+func (r *resolver) finish(res resolution) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	job, ok := r.jobs[res.ev.Device.UUID]
+	if !ok || job.id != res.id {
+		return false
+	}
+	job.cancel()
+	delete(r.jobs, res.ev.Device.UUID)
+	return true
+}
+
+// running return true if a device is being resolved
+func (r *resolver) running(uuid string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	_, ok := r.jobs[uuid]
+	return ok
+}
+
+// cancel the resolution of a device
+func (r *resolver) cancel(uuid string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.cancelJob(uuid)
+}
+
+// stop cancel all the resolutions
+func (r *resolver) stop() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for uuid := range r.jobs {
+		r.cancelJob(uuid)
+	}
+}
+
+func (r *resolver) cancelJob(uuid string) {
+	if job, ok := r.jobs[uuid]; ok {
+		job.cancel()
+		delete(r.jobs, uuid)
+	}
+}
@@ -0,0 +1,58 @@
+package onvif
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a device not answering holds its resolution until cancelled
+	resolver := newResolver(2, func(ctx context.Context, dev *device.Device) error {
+		if dev.UUID == "urn:uuid:offline" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		dev.MediaURI = "rtsp://" + dev.UUID
+		return nil
+	})
+	defer resolver.stop()
+
+	done := func() resolution {
+		select {
+		case res := <-resolver.Done:
+			return res
+		case <-time.After(time.Second):
+			t.Fatal("No resolution done")
+		}
+		return resolution{}
+	}
+
+	offline := device.OnChanged(device.Device{UUID: "urn:uuid:offline"}, device.DeviceAdded)
+	resolver.start(ctx, offline)
+	resolver.start(ctx, offline)
+	resolver.start(ctx, device.OnChanged(device.Device{UUID: "urn:uuid:online"}, device.DeviceAdded))
+
+	res := done()
+	assert.True(t, resolver.finish(res))
+	assert.NoError(t, res.err)
+	assert.Equal(t, "rtsp://urn:uuid:online", res.ev.Device.MediaURI)
+	assert.False(t, resolver.running("urn:uuid:online"))
+
+	// a cancelled resolution is dropped
+	assert.True(t, resolver.running(offline.Device.UUID))
+	resolver.cancel(offline.Device.UUID)
+	assert.False(t, resolver.running(offline.Device.UUID))
+	select {
+	case res := <-resolver.Done:
+		assert.False(t, resolver.finish(res))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
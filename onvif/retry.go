@@ -0,0 +1,117 @@
+package onvif
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	// retryInitial is the delay before the first resolution retry, doubled
+	// at each failure up to retryMax
+	retryInitial = 5 * time.Second
+	retryMax     = 5 * time.Minute
+)
+
+// retryDelay return the exponential backoff before a retry, attempt being
+// the number of failures so far
+func retryDelay(attempt int) time.Duration {
+	delay := retryInitial
+	for i := 1; i < attempt && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+// setPending mark a device failing to resolve as pending, counting the
+// failed attempts. It return false if the same error was already notified.
+func setPending(ev *device.OnChangeEvent, prev *device.Device, err error) bool {
+
+	attempts := 1
+	lastError := ""
+	if prev != nil && prev.ResolveError != "" {
+		attempts = prev.ResolveAttempts + 1
+		lastError = prev.ResolveError
+	}
+
+	ev.Event = device.DevicePending
+	ev.Device.ResolveError = err.Error()
+	ev.Device.ResolveAttempts = attempts
+
+	return ev.Device.ResolveError != lastError
+}
+
+// newResolveRetry init the retries of the devices failing to resolve
+func newResolveRetry() *resolveRetry {
+	return &resolveRetry{
+		Due:    make(chan string),
+		timers: map[string]*time.Timer{},
+	}
+}
+
+// resolveRetry schedule the resolution retries of the pending devices,
+// sending their UUID to Due when a retry is due
+type resolveRetry struct {
+	Due    chan string
+	mut    sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// schedule a retry after the backoff for attempt, replacing a previous one
+func (r *resolveRetry) schedule(ctx context.Context, uuid string, attempt int) time.Duration {
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.cancelTimer(uuid)
+
+	delay := retryDelay(attempt)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		r.mut.Lock()
+		current, ok := r.timers[uuid]
+		if ok && current == timer {
+			delete(r.timers, uuid)
+		}
+		r.mut.Unlock()
+		// cancelled or replaced
+		if !ok || current != timer {
+			return
+		}
+		select {
+		case r.Due <- uuid:
+		case <-ctx.Done():
+		}
+	})
+	r.timers[uuid] = timer
+
+	return delay
+}
+
+// cancel the retry of a device
+func (r *resolveRetry) cancel(uuid string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.cancelTimer(uuid)
+}
+
+// stop cancel all the retries
+func (r *resolveRetry) stop() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for uuid := range r.timers {
+		r.cancelTimer(uuid)
+	}
+}
+
+func (r *resolveRetry) cancelTimer(uuid string) {
+	if timer, ok := r.timers[uuid]; ok {
+		timer.Stop()
+		delete(r.timers, uuid)
+	}
+}
@@ -0,0 +1,35 @@
+package onvif
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRetry(t *testing.T) {
+
+	assert.Equal(t, retryInitial, retryDelay(1))
+	assert.Equal(t, 2*retryInitial, retryDelay(2))
+	assert.Equal(t, retryMax, retryDelay(20))
+
+	dev := device.Device{UUID: "urn:uuid:1"}
+
+	ev := device.OnChanged(dev, device.DeviceAdded)
+	assert.True(t, setPending(&ev, nil, errors.New("timeout")))
+	assert.Equal(t, device.DevicePending, ev.Event)
+	assert.Equal(t, 1, ev.Device.ResolveAttempts)
+
+	// the same error is not notified again
+	prev := ev.Device
+	ev = device.OnChanged(dev, device.DeviceAdded)
+	assert.False(t, setPending(&ev, &prev, errors.New("timeout")))
+	assert.Equal(t, 2, ev.Device.ResolveAttempts)
+
+	prev = ev.Device
+	ev = device.OnChanged(dev, device.DeviceUpdated)
+	assert.True(t, setPending(&ev, &prev, errors.New("not authorized")))
+	assert.Equal(t, 3, ev.Device.ResolveAttempts)
+	assert.Equal(t, "not authorized", ev.Device.ResolveError)
+}
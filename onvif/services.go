@@ -0,0 +1,37 @@
+package onvif
+
+import (
+	"context"
+
+	"github.com/muka/camd/device"
+)
+
+// resolveServices fill the device service map and capability flags
+func resolveServices(ctx context.Context, client *Client, dev *device.Device) error {
+
+	services, err := client.Services(ctx)
+	if err != nil {
+		return err
+	}
+
+	dev.Services = services
+	dev.Capabilities = capabilities(services)
+
+	return nil
+}
+
+// capabilities flag the optional services advertised by the device
+func capabilities(services map[string]device.Service) device.Capabilities {
+	has := func(name string) bool {
+		_, ok := services[name]
+		return ok
+	}
+	return device.Capabilities{
+		PTZ:       has("ptz"),
+		Events:    has("events"),
+		Analytics: has("analytics"),
+		Recording: has("recording"),
+		Imaging:   has("imaging"),
+		DeviceIO:  has("deviceio"),
+	}
+}
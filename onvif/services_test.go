@@ -0,0 +1,27 @@
+package onvif
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveServices(t *testing.T) {
+
+	camera, dev := resolveCamera(t, simulator.Config{Media2: true}, NewAuthenticator(nil))
+	defer camera.Stop()
+
+	assert.Equal(t, "2.60", dev.Services["media2"].Version)
+	assert.Equal(t, strings.Replace(camera.XAddr(), "device_service", "media2_service", 1), dev.Services["media2"].XAddr)
+	assert.False(t, dev.Capabilities.PTZ)
+
+	// ONVIF 1.x devices without GetServices
+	legacy, legacyDev := resolveCamera(t, simulator.Config{Legacy: true}, NewAuthenticator(nil))
+	defer legacy.Stop()
+
+	assert.Equal(t, strings.Replace(legacy.XAddr(), "device_service", "media_service", 1), legacyDev.Services["media"].XAddr)
+	assert.Empty(t, legacyDev.Services["media"].Version)
+	assert.Equal(t, "rtsp://127.0.0.1:554/Profile_1", legacyDev.MediaURI)
+}
@@ -0,0 +1,151 @@
+package simulator
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AuthWSSecurity require a WS-Security UsernameToken digest
+	AuthWSSecurity = "wsse"
+	// AuthDigest require HTTP Digest authentication
+	AuthDigest = "digest"
+	// AuthAny accept either WS-Security or HTTP Digest
+	AuthAny = "any"
+
+	digestRealm = "camd-simulator"
+
+	// securityWindow is how far the UsernameToken Created timestamp can be
+	// from the camera clock
+	securityWindow = 5 * time.Second
+)
+
+// unauthenticatedOperations can be called without credentials, as per ONVIF access policy
+var unauthenticatedOperations = map[string]bool{
+	"GetSystemDateAndTime": true,
+}
+
+// authenticate verify the request credentials, writing the error response if they are invalid
+func (c *Camera) authenticate(w http.ResponseWriter, r *http.Request, req soapRequest, config Config) bool {
+
+	if config.Username == "" || unauthenticatedOperations[req.Body.Operation.XMLName.Local] {
+		return true
+	}
+
+	mode := config.Auth
+	if mode == "" {
+		mode = AuthWSSecurity
+	}
+
+	if (mode == AuthWSSecurity || mode == AuthAny) && validSecurity(req, config) {
+		return true
+	}
+
+	if (mode == AuthDigest || mode == AuthAny) && validDigest(r, config) {
+		return true
+	}
+
+	if mode == AuthDigest || mode == AuthAny {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth", nonce="%s", algorithm=MD5`, digestRealm, c.nonce))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	c.fault(w, "Sender", "NotAuthorized", "Sender not authorized")
+	return false
+}
+
+// authenticateHTTP verify the credentials of a plain HTTP request, such as a
+// snapshot download. The Digest and any modes challenge for HTTP Digest, the
+// wsse one for Basic, as WS-Security does not apply outside SOAP.
+func (c *Camera) authenticateHTTP(w http.ResponseWriter, r *http.Request, config Config) bool {
+
+	if config.Username == "" {
+		return true
+	}
+
+	if username, password, ok := r.BasicAuth(); ok && config.Auth != AuthDigest {
+		if username == config.Username && password == config.Password {
+			return true
+		}
+	}
+
+	if config.Auth != "" && config.Auth != AuthWSSecurity {
+		if validDigest(r, config) {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth", nonce="%s", algorithm=MD5`, digestRealm, c.nonce))
+	} else {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, digestRealm))
+	}
+
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// validSecurity verify a WS-Security UsernameToken password digest
+func validSecurity(req soapRequest, config Config) bool {
+
+	token := req.Header.Security.UsernameToken
+	if token.Username != config.Username {
+		return false
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token.Nonce))
+	if err != nil {
+		return false
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(token.Created))
+	if err != nil {
+		return false
+	}
+	if skew := created.Sub(time.Now().Add(config.ClockOffset)); skew > securityWindow || skew < -securityWindow {
+		return false
+	}
+
+	hasher := sha1.New()
+	hasher.Write(nonce)
+	hasher.Write([]byte(strings.TrimSpace(token.Created)))
+	hasher.Write([]byte(config.Password))
+
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)) == strings.TrimSpace(token.Password)
+}
+
+// validDigest verify an HTTP Digest MD5 Authorization header
+func validDigest(r *http.Request, config Config) bool {
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+
+	params := map[string]string{}
+	for _, param := range strings.Split(header[7:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	if params["username"] != config.Username {
+		return false
+	}
+
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	ha1 := md5hex(config.Username + ":" + params["realm"] + ":" + config.Password)
+	ha2 := md5hex(r.Method + ":" + params["uri"])
+	expected := md5hex(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+
+	return params["response"] == expected
+}
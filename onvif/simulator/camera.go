@@ -0,0 +1,581 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/onvif/discovery"
+)
+
+const (
+	deviceServicePath = "/onvif/device_service"
+	mediaServicePath  = "/onvif/media_service"
+	media2ServicePath = "/onvif/media2_service"
+	eventsServicePath = "/onvif/events_service"
+	ptzServicePath    = "/onvif/ptz_service"
+	imagingPath       = "/onvif/imaging_service"
+	searchPath        = "/onvif/search_service"
+	replayPath        = "/onvif/replay_service"
+	deviceIOPath      = "/onvif/deviceio_service"
+	subscriptionPath  = "/onvif/subscription/"
+	snapshotPath      = "/onvif/snapshot/"
+)
+
+// Profile a simulated media profile
+type Profile struct {
+	Token string
+	Name  string
+	// Encoding is the video codec, eg. H264 or H265 (Media2 only)
+	Encoding  string
+	Width     int
+	Height    int
+	FrameRate int
+	Bitrate   int
+	// Quality is the encoder quality, from 1 to 10 (5 if zero)
+	Quality int
+	// GovLength is the H264 group of pictures length (FrameRate if zero)
+	GovLength int
+	// VideoSource is the video source token, VideoSource_1 if empty. The
+	// profiles of different sources simulate the channels of an NVR.
+	VideoSource string
+	// StreamURI overrides the default rtsp://<host>:554/<token> stream URI
+	StreamURI string
+	// SnapshotURI overrides the snapshot served by the camera
+	SnapshotURI string
+	// URITimeout limits the lifetime of the stream URIs, each GetStreamUri
+	// returning a new one
+	URITimeout time.Duration
+	// InvalidAfterReboot change the stream URIs when the camera reboots
+	InvalidAfterReboot bool
+	// InvalidAfterConnect flag the stream URIs as valid for a single connection
+	InvalidAfterConnect bool
+	// Offline fail GetStreamUri, as an NVR channel without a camera
+	Offline bool
+}
+
+// Config describes a simulated NetworkVideoTransmitter
+type Config struct {
+	UUID            string
+	Name            string
+	Hardware        string
+	Manufacturer    string
+	Model           string
+	FirmwareVersion string
+	SerialNumber    string
+	Hostname        string
+	// MAC is the hardware address of the simulated network interface
+	MAC      string
+	Location string
+	// Scopes are additional discovery scopes, eg. onvif://www.onvif.org/Profile/Streaming
+	Scopes []string
+	// Username and Password enable authentication for all the operations but GetSystemDateAndTime
+	Username string
+	Password string
+	// Auth is the authentication scheme, one of wsse (default), digest or any
+	Auth string
+	// Media2 enable the Media2 (ver20) service
+	Media2 bool
+	// PTZ enable the PTZ service, shared by all the profiles
+	PTZ bool
+	// Imaging enable the Imaging service, for the single video source
+	Imaging bool
+	// Recording enable the Recording Search and Replay services (Profile G),
+	// listing Recordings or a single recording of the last day if empty
+	Recording  bool
+	Recordings []Recording
+	// SearchStuck keep the recording searches Searching, as a misbehaving NVR
+	SearchStuck bool
+	// DeviceIO enable the DeviceIO service, for the DigitalInputs and the
+	// RelayOutputs, which are also available from the device service
+	DeviceIO      bool
+	RelayOutputs  []RelayOutput
+	DigitalInputs []DigitalInput
+	// Legacy disable GetServices, as ONVIF 1.x devices only support GetCapabilities
+	Legacy bool
+	// ClockOffset drifts the camera clock, which must match the WS-Security
+	// timestamps within the allowed window
+	ClockOffset time.Duration
+	// DaylightSavings and TimeZone (POSIX, eg. CET-1CEST,M3.5.0,M10.5.0/3) are
+	// the local time settings
+	DaylightSavings bool
+	TimeZone        string
+	// ResetClock set the clock back to 2000-01-01 on reboot, as the devices
+	// without a battery backed clock, until it is set again
+	ResetClock bool
+	// TLS serve HTTPS with a self-signed certificate, generated on start
+	TLS bool
+	// Address is the host:port the SOAP endpoint listens on, a random port on localhost if empty
+	Address  string
+	Profiles []Profile
+}
+
+// Camera a simulated NetworkVideoTransmitter
+type Camera struct {
+	config          Config
+	metadataVersion int
+	mut             sync.Mutex
+	listener        net.Listener
+	server          *http.Server
+	nonce           string
+	subscriptions   map[string]*subscription
+	ptz             ptzState
+	imaging         imagingState
+	system          systemState
+	// searches holds the offset of the next result of the recording searches
+	searches map[string]int
+	searchID int
+	relays   map[string]relayState
+	// boots and sessions count the reboots and the GetStreamUri calls
+	boots    int
+	sessions int
+	// certificate is the self-signed certificate served if TLS is enabled
+	certificate    *tls.Certificate
+	certificatePEM []byte
+}
+
+// NewCamera init a simulated camera, filling defaults for the missing configuration
+func NewCamera(config Config) *Camera {
+
+	if config.UUID == "" {
+		config.UUID = newUUID()
+	}
+	if !strings.HasPrefix(config.UUID, "urn:uuid:") {
+		config.UUID = "urn:uuid:" + config.UUID
+	}
+	if config.Name == "" {
+		config.Name = "Simulated Camera"
+	}
+	if config.Hardware == "" {
+		config.Hardware = "camd-simulator"
+	}
+	if config.Manufacturer == "" {
+		config.Manufacturer = "camd"
+	}
+	if config.Model == "" {
+		config.Model = config.Hardware
+	}
+	if config.FirmwareVersion == "" {
+		config.FirmwareVersion = "1.0.0"
+	}
+	if config.SerialNumber == "" {
+		config.SerialNumber = strings.ReplaceAll(strings.TrimPrefix(config.UUID, "urn:uuid:"), "-", "")
+	}
+	// derive a stable hostname and locally administered MAC from the UUID
+	id := sha1.Sum([]byte(config.UUID))
+	if config.Hostname == "" {
+		config.Hostname = fmt.Sprintf("camd-%x", id[:4])
+	}
+	if config.MAC == "" {
+		config.MAC = fmt.Sprintf("02:%02x:%02x:%02x:%02x:%02x", id[0], id[1], id[2], id[3], id[4])
+	}
+	if config.Address == "" {
+		config.Address = "127.0.0.1:0"
+	}
+	if len(config.Profiles) == 0 {
+		config.Profiles = []Profile{
+			{Token: "Profile_1", Name: "MainStream", Encoding: "H264", Width: 1920, Height: 1080, FrameRate: 25, Bitrate: 4096},
+			{Token: "Profile_2", Name: "SubStream", Encoding: "H264", Width: 640, Height: 360, FrameRate: 15, Bitrate: 512},
+		}
+	}
+
+	profiles := make([]Profile, len(config.Profiles))
+	for i, profile := range config.Profiles {
+		if profile.Quality == 0 {
+			profile.Quality = 5
+		}
+		if profile.GovLength == 0 {
+			profile.GovLength = profile.FrameRate
+		}
+		if profile.VideoSource == "" {
+			profile.VideoSource = videoSourceToken
+		}
+		profiles[i] = profile
+	}
+	config.Profiles = profiles
+
+	relays := make([]RelayOutput, len(config.RelayOutputs))
+	for i, relay := range config.RelayOutputs {
+		if relay.Token == "" {
+			relay.Token = fmt.Sprintf("RelayOutput_%d", i+1)
+		}
+		if relay.Mode == "" {
+			relay.Mode = "Bistable"
+		}
+		if relay.IdleState == "" {
+			relay.IdleState = "closed"
+		}
+		relays[i] = relay
+	}
+	config.RelayOutputs = relays
+
+	inputs := make([]DigitalInput, len(config.DigitalInputs))
+	for i, input := range config.DigitalInputs {
+		if input.Token == "" {
+			input.Token = fmt.Sprintf("DigitalInput_%d", i+1)
+		}
+		if input.IdleState == "" {
+			input.IdleState = "closed"
+		}
+		inputs[i] = input
+	}
+	config.DigitalInputs = inputs
+
+	if config.Recording && len(config.Recordings) == 0 {
+		config.Recordings = defaultRecordings(time.Now())
+	}
+
+	return &Camera{
+		config:          config,
+		metadataVersion: 1,
+		nonce:           strings.ReplaceAll(newUUID(), "-", ""),
+		subscriptions:   map[string]*subscription{},
+		searches:        map[string]int{},
+		relays:          map[string]relayState{},
+		imaging: imagingState{
+			settings:  defaultImagingSettings(),
+			persisted: defaultImagingSettings(),
+		},
+		system: systemState{dateTimeType: "Manual", ntpFromDHCP: true},
+	}
+}
+
+// UUID return the camera endpoint reference
+func (c *Camera) UUID() string {
+	return c.config.UUID
+}
+
+// Config return a copy of the camera configuration
+func (c *Camera) Config() Config {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.config
+}
+
+// XAddr return the device service address, empty if the camera is not running
+func (c *Camera) XAddr() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.xaddr(deviceServicePath)
+}
+
+func (c *Camera) xaddr(path string) string {
+	if c.listener == nil {
+		return ""
+	}
+	scheme := "http://"
+	if c.config.TLS {
+		scheme = "https://"
+	}
+	return scheme + advertisedAddr(c.listener.Addr()) + path
+}
+
+// Start listen for SOAP requests
+func (c *Camera) Start() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.listen()
+}
+
+func (c *Camera) listen() error {
+
+	listener, err := net.Listen("tcp", c.config.Address)
+	if err != nil {
+		return err
+	}
+
+	if c.config.TLS {
+		if c.certificate == nil {
+			cert, certPEM, err := newCertificate(c.config.Name)
+			if err != nil {
+				listener.Close()
+				return err
+			}
+			c.certificate = &cert
+			c.certificatePEM = certPEM
+		}
+		listener = tls.NewListener(listener, &tls.Config{GetCertificate: c.getCertificate})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(deviceServicePath, c.handleSOAP)
+	mux.HandleFunc(mediaServicePath, c.handleSOAP)
+	mux.HandleFunc(media2ServicePath, c.handleSOAP)
+	mux.HandleFunc(eventsServicePath, c.handleSOAP)
+	mux.HandleFunc(ptzServicePath, c.handleSOAP)
+	mux.HandleFunc(imagingPath, c.handleSOAP)
+	mux.HandleFunc(searchPath, c.handleSOAP)
+	mux.HandleFunc(replayPath, c.handleSOAP)
+	mux.HandleFunc(deviceIOPath, c.handleSOAP)
+	mux.HandleFunc(subscriptionPath, c.handleSOAP)
+	mux.HandleFunc(snapshotPath, c.handleSnapshot)
+
+	c.listener = listener
+	c.server = &http.Server{Handler: mux}
+
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Simulated camera %s failed: %s", c.config.UUID, err)
+		}
+	}(c.server)
+
+	return nil
+}
+
+// Stop close the SOAP endpoint
+func (c *Camera) Stop() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.close()
+}
+
+func (c *Camera) close() error {
+	if c.server == nil {
+		return nil
+	}
+	// drop the connections as a camera going down, without waiting for the
+	// pending PullMessages
+	err := c.server.Close()
+	c.server = nil
+	c.listener = nil
+	// subscriptions do not survive a restart
+	for _, sub := range c.subscriptions {
+		close(sub.done)
+	}
+	c.subscriptions = map[string]*subscription{}
+	return err
+}
+
+// Move change the listening address, as a camera getting a new DHCP lease
+func (c *Camera) Move(address string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if err := c.close(); err != nil {
+		return err
+	}
+	c.config.Address = address
+	c.metadataVersion++
+	return c.listen()
+}
+
+// Reboot restart the camera on the same address, dropping the subscriptions
+// and the stream URIs invalidated by a reboot
+func (c *Camera) Reboot() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.listener != nil {
+		c.config.Address = c.listener.Addr().String()
+	}
+	if err := c.close(); err != nil {
+		return err
+	}
+	c.boots++
+	if c.config.ResetClock {
+		c.config.ClockOffset = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Sub(time.Now())
+	}
+	c.ptz = ptzState{}
+	c.imaging = imagingState{
+		settings:  c.imaging.persisted,
+		persisted: c.imaging.persisted,
+	}
+	return c.listen()
+}
+
+// Rename change the name scope
+func (c *Camera) Rename(name string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.config.Name = name
+	c.metadataVersion++
+}
+
+// ProbeMatch return the WS-Discovery description of the camera
+func (c *Camera) ProbeMatch() discovery.ProbeMatch {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	scopes := []string{
+		"onvif://www.onvif.org/type/video_encoder",
+		"onvif://www.onvif.org/type/Network_Video_Transmitter",
+		"onvif://www.onvif.org/name/" + url.PathEscape(c.config.Name),
+		"onvif://www.onvif.org/hardware/" + url.PathEscape(c.config.Hardware),
+	}
+	if c.config.Location != "" {
+		scopes = append(scopes, "onvif://www.onvif.org/location/"+url.PathEscape(c.config.Location))
+	}
+	scopes = append(scopes, c.config.Scopes...)
+
+	return discovery.ProbeMatch{
+		EndpointReference: discovery.EndpointReference{Address: c.config.UUID},
+		Types:             "dn:NetworkVideoTransmitter",
+		Scopes:            strings.Join(scopes, " "),
+		XAddrs:            c.xaddr(deviceServicePath),
+		MetadataVersion:   strconv.Itoa(c.metadataVersion),
+	}
+}
+
+func (c *Camera) handleSOAP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := soapRequest{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		c.fault(w, "Sender", "WellFormed", err.Error())
+		return
+	}
+
+	operation := operationName(req)
+
+	c.mut.Lock()
+	call := &soapCall{
+		req:    req,
+		path:   r.URL.Path,
+		config: c.config,
+		xaddrs: map[string]string{
+			"device":       c.xaddr(deviceServicePath),
+			"media":        c.xaddr(mediaServicePath),
+			"events":       c.xaddr(eventsServicePath),
+			"subscription": c.xaddr(subscriptionPath),
+			"snapshot":     c.xaddr(snapshotPath),
+		},
+	}
+	if c.config.Media2 {
+		call.xaddrs["media2"] = c.xaddr(media2ServicePath)
+	}
+	if c.config.PTZ {
+		call.xaddrs["ptz"] = c.xaddr(ptzServicePath)
+	}
+	if c.config.Imaging {
+		call.xaddrs["imaging"] = c.xaddr(imagingPath)
+	}
+	if c.config.DeviceIO {
+		call.xaddrs["deviceio"] = c.xaddr(deviceIOPath)
+	}
+	if c.config.Recording {
+		call.xaddrs["search"] = c.xaddr(searchPath)
+		call.xaddrs["replay"] = c.xaddr(replayPath)
+	}
+	c.mut.Unlock()
+
+	if !c.authenticate(w, r, req, call.config) {
+		return
+	}
+
+	handler, ok := operations[operation]
+	if !ok {
+		c.fault(w, "Sender", "ActionNotSupported", fmt.Sprintf("Operation %s not supported", operation))
+		return
+	}
+
+	data, fault := handler(c, call)
+	if fault != nil {
+		c.fault(w, "Sender", fault.subcode, fault.reason)
+		return
+	}
+
+	if data == nil {
+		data = struct{}{}
+	}
+
+	res, err := render(operation, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/soap+xml; charset=utf-8")
+	w.Write(res)
+}
+
+func (c *Camera) fault(w http.ResponseWriter, code, subcode, reason string) {
+	res, err := render("Fault", struct{ Code, Subcode, Reason string }{code, subcode, reason})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/soap+xml; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(res)
+}
+
+// handleSnapshot serve a solid color JPEG sized as the requested profile
+func (c *Camera) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, snapshotPath), ".jpg")
+
+	c.mut.Lock()
+	config := c.config
+	c.mut.Unlock()
+
+	if !c.authenticateHTTP(w, r, config) {
+		return
+	}
+
+	profile, ok := findProfile(config.Profiles, token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, profile.Width, profile.Height))
+	for x := 0; x < profile.Width; x++ {
+		for y := 0; y < profile.Height; y++ {
+			img.Set(x, y, color.RGBA{R: 0x30, G: 0x60, B: 0x90, A: 0xff})
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "image/jpeg")
+	w.Write(buf.Bytes())
+}
+
+// advertisedAddr return a reachable host:port for a listener address
+func advertisedAddr(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort(localIP(), strconv.Itoa(tcpAddr.Port))
+}
+
+// localIP return the first non-loopback IPv4 address, or the loopback one
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, iface := range addrs {
+			addr, ok := iface.(*net.IPNet)
+			if ok && !addr.IP.IsLoopback() && addr.IP.To4() != nil {
+				return addr.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+)
+
+const nsDeviceIO = "http://www.onvif.org/ver10/deviceIO/wsdl"
+
+// RelayOutput a simulated relay output
+type RelayOutput struct {
+	Token string
+	// Mode is Bistable (default) or Monostable, back to inactive after DelayTime
+	Mode      string
+	DelayTime time.Duration
+	// IdleState is open or closed (default)
+	IdleState string
+}
+
+// DigitalInput a simulated digital input
+type DigitalInput struct {
+	Token string
+	// IdleState is open or closed (default)
+	IdleState string
+}
+
+// relayState the logical state of a relay, active until a Monostable
+// relay delay expires
+type relayState struct {
+	active bool
+	until  time.Time
+}
+
+func (s relayState) isActive(now time.Time) bool {
+	return s.active && (s.until.IsZero() || now.Before(s.until))
+}
+
+// Relay return true if a relay output is active
+func (c *Camera) Relay(token string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.relays[token].isActive(time.Now())
+}
+
+// deviceIOCall check the DeviceIO support, the relays being also available
+// from the device service
+func deviceIOCall(call *soapCall) *soapFault {
+	if call.req.Body.Operation.XMLName.Space == nsDeviceIO && !call.config.DeviceIO {
+		return &soapFault{"ActionNotSupported", "DeviceIO not supported"}
+	}
+	return nil
+}
+
+func getRelayOutputs(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := deviceIOCall(call); fault != nil {
+		return nil, fault
+	}
+
+	type relayOutput struct {
+		RelayOutput
+		Delay string
+	}
+	relays := []relayOutput{}
+	for _, relay := range call.config.RelayOutputs {
+		relays = append(relays, relayOutput{relay, fmt.Sprintf("PT%dS", int(relay.DelayTime.Seconds()))})
+	}
+
+	// the response elements are in the namespace of the service called
+	prefix := "tds"
+	if call.req.Body.Operation.XMLName.Space == nsDeviceIO {
+		prefix = "tmd"
+	}
+
+	return struct {
+		Prefix string
+		Relays []relayOutput
+	}{prefix, relays}, nil
+}
+
+func setRelayOutputState(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := deviceIOCall(call); fault != nil {
+		return nil, fault
+	}
+
+	req := call.req.Body.Operation
+	var relay *RelayOutput
+	for i := range call.config.RelayOutputs {
+		if call.config.RelayOutputs[i].Token == req.RelayOutputToken {
+			relay = &call.config.RelayOutputs[i]
+		}
+	}
+	if relay == nil {
+		return nil, &soapFault{"RelayToken", "Relay output not found"}
+	}
+	if req.LogicalState != "active" && req.LogicalState != "inactive" {
+		return nil, &soapFault{"InvalidArgVal", "Invalid logical state " + req.LogicalState}
+	}
+
+	state := relayState{active: req.LogicalState == "active"}
+	if state.active && relay.Mode == "Monostable" {
+		state.until = time.Now().Add(relay.DelayTime)
+	}
+
+	c.mut.Lock()
+	c.relays[relay.Token] = state
+	c.mut.Unlock()
+
+	source := map[string]string{"RelayToken": relay.Token}
+	c.Publish("Device/Trigger/Relay", source, map[string]string{"LogicalState": req.LogicalState})
+	if !state.until.IsZero() {
+		time.AfterFunc(relay.DelayTime, func() {
+			c.mut.Lock()
+			current := c.relays[relay.Token]
+			c.mut.Unlock()
+			// not changed since
+			if current == state {
+				c.Publish("Device/Trigger/Relay", source, map[string]string{"LogicalState": "inactive"})
+			}
+		})
+	}
+
+	return nil, nil
+}
+
+func getDigitalInputs(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if !call.config.DeviceIO {
+		return nil, &soapFault{"ActionNotSupported", "DeviceIO not supported"}
+	}
+	return call.config, nil
+}
@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"strings"
+)
+
+// encoderSuffix is appended to the profile token to name its video encoder
+const encoderSuffix = "_VideoEncoder"
+
+// encoderResolutions are the resolutions supported by the video encoders
+var encoderResolutions = [][2]int{{1920, 1080}, {1280, 720}, {640, 360}}
+
+// encoderLimits are the supported ranges of the video encoder settings
+var encoderLimits = struct {
+	FrameRate, Bitrate, Quality, GovLength [2]int
+}{
+	FrameRate: [2]int{1, 30},
+	Bitrate:   [2]int{64, 8192},
+	Quality:   [2]int{1, 10},
+	GovLength: [2]int{1, 300},
+}
+
+func inRange(value int, limits [2]int) bool {
+	return value >= limits[0] && value <= limits[1]
+}
+
+func getVideoEncoderConfigurationOptions(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	req := call.req.Body.Operation
+	if req.ProfileToken != "" {
+		if _, ok := findProfile(call.config.Profiles, req.ProfileToken); !ok {
+			return nil, &soapFault{"NoProfile", "Profile not found"}
+		}
+	}
+	if req.ConfigurationToken != "" {
+		if _, ok := findProfile(call.config.Profiles, strings.TrimSuffix(req.ConfigurationToken, encoderSuffix)); !ok {
+			return nil, &soapFault{"NoConfig", "Video encoder configuration not found"}
+		}
+	}
+
+	return struct {
+		Resolutions                            [][2]int
+		FrameRate, Bitrate, Quality, GovLength [2]int
+	}{
+		encoderResolutions,
+		encoderLimits.FrameRate,
+		encoderLimits.Bitrate,
+		encoderLimits.Quality,
+		encoderLimits.GovLength,
+	}, nil
+}
+
+// addVideoEncoderConfiguration accept only the encoder of the profile, as
+// the simulated profiles are fixed
+func addVideoEncoderConfiguration(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	profile, ok := findProfile(call.config.Profiles, call.req.Body.Operation.ProfileToken)
+	if !ok {
+		return nil, &soapFault{"NoProfile", "Profile not found"}
+	}
+	if call.req.Body.Operation.ConfigurationToken != profile.Token+encoderSuffix {
+		return nil, &soapFault{"ConfigurationConflict", "The profile is fixed"}
+	}
+
+	return nil, nil
+}
+
+func setVideoEncoderConfiguration(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	req := call.req.Body.Operation.Configuration
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	index := -1
+	for i, profile := range c.config.Profiles {
+		if profile.Token+encoderSuffix == req.Token {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, &soapFault{"NoConfig", "Video encoder configuration not found"}
+	}
+
+	// Media1 does not support H265
+	if req.Encoding != "H264" && req.Encoding != "JPEG" {
+		return nil, &soapFault{"ConfigModify", "Unsupported encoding " + req.Encoding}
+	}
+
+	supported := false
+	for _, resolution := range encoderResolutions {
+		if resolution[0] == req.Resolution.Width && resolution[1] == req.Resolution.Height {
+			supported = true
+		}
+	}
+	if !supported || !inRange(int(req.Quality), encoderLimits.Quality) {
+		return nil, &soapFault{"ConfigModify", "Unsupported resolution or quality"}
+	}
+
+	// the profiles are shared with the pending calls, so they are copied
+	profiles := append([]Profile{}, c.config.Profiles...)
+	profile := &profiles[index]
+
+	if req.RateControl != nil {
+		if !inRange(req.RateControl.FrameRateLimit, encoderLimits.FrameRate) || !inRange(req.RateControl.BitrateLimit, encoderLimits.Bitrate) {
+			return nil, &soapFault{"ConfigModify", "Unsupported frame rate or bitrate"}
+		}
+		profile.FrameRate = req.RateControl.FrameRateLimit
+		profile.Bitrate = req.RateControl.BitrateLimit
+	}
+	if req.H264 != nil && req.Encoding == "H264" {
+		if !inRange(req.H264.GovLength, encoderLimits.GovLength) {
+			return nil, &soapFault{"ConfigModify", "Unsupported GOV length"}
+		}
+		profile.GovLength = req.H264.GovLength
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		profile.Name = name
+	}
+	profile.Encoding = req.Encoding
+	profile.Width = req.Resolution.Width
+	profile.Height = req.Resolution.Height
+	profile.Quality = int(req.Quality)
+
+	c.config.Profiles = profiles
+
+	return nil, nil
+}
@@ -0,0 +1,281 @@
+package simulator
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSubscriptionTime = time.Minute
+	maxPullTimeout          = 10 * time.Second
+)
+
+// event a notification published by a camera
+type event struct {
+	Topic     string
+	Time      string
+	Operation string
+	Source    []item
+	Data      []item
+}
+
+// item a SimpleItem of an event
+type item struct {
+	Name  string
+	Value string
+}
+
+// subscription a PullPoint or, with a consumer, a WS-BaseNotification subscription
+type subscription struct {
+	id          string
+	consumer    string
+	termination time.Time
+	queue       []event
+	wake        chan struct{}
+	// done is closed when the camera stops
+	done chan struct{}
+}
+
+func items(values map[string]string) []item {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []item{}
+	for _, name := range names {
+		list = append(list, item{name, values[name]})
+	}
+	return list
+}
+
+// Publish send an event to the subscribers, eg. topic
+// RuleEngine/CellMotionDetector/Motion with data IsMotion=true
+func (c *Camera) Publish(topic string, source map[string]string, data map[string]string) {
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	ev := event{
+		Topic:     "tns1:" + strings.TrimPrefix(topic, "tns1:"),
+		Time:      time.Now().Add(c.config.ClockOffset).UTC().Format(time.RFC3339),
+		Operation: "Changed",
+		Source:    items(source),
+		Data:      items(data),
+	}
+
+	now := time.Now()
+	for id, sub := range c.subscriptions {
+		if now.After(sub.termination) {
+			delete(c.subscriptions, id)
+			continue
+		}
+
+		if sub.consumer != "" {
+			go notify(sub.consumer, ev)
+			continue
+		}
+
+		sub.queue = append(sub.queue, ev)
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notify send an event to a WS-BaseNotification consumer
+func notify(consumer string, ev event) {
+
+	body, err := render("Notify", struct{ Messages []event }{[]event{ev}})
+	if err != nil {
+		log.Printf("Notify failed: %s", err)
+		return
+	}
+
+	res, err := http.Post(consumer, "application/soap+xml; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Notify %s failed: %s", consumer, err)
+		return
+	}
+	res.Body.Close()
+}
+
+var xsdDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseTermination parse an xs:duration (eg. PT60S) or an absolute time
+// relative to the camera clock, returning the local termination time
+func parseTermination(value string, offset time.Duration, fallback time.Duration) time.Time {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Now().Add(fallback)
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Add(-offset)
+	}
+
+	return time.Now().Add(parseDuration(value, fallback))
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+
+	m := xsdDurationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return fallback
+	}
+
+	d := time.Duration(0)
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if n, err := strconv.Atoi(m[i+1]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+	if s, err := strconv.ParseFloat(m[4], 64); err == nil {
+		d += time.Duration(s * float64(time.Second))
+	}
+
+	return d
+}
+
+// times return the current and termination times of a subscription on the camera clock
+func (c *Camera) times(sub *subscription, offset time.Duration) (string, string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return time.Now().Add(offset).UTC().Format(time.RFC3339),
+		sub.termination.Add(offset).UTC().Format(time.RFC3339)
+}
+
+// addSubscription register a subscription, returning the template data of
+// the subscribe responses
+func (c *Camera) addSubscription(call *soapCall, consumer string) interface{} {
+
+	sub := &subscription{
+		id:          strings.ReplaceAll(newUUID(), "-", ""),
+		consumer:    consumer,
+		termination: parseTermination(call.req.Body.Operation.InitialTerminationTime, call.config.ClockOffset, defaultSubscriptionTime),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	c.mut.Lock()
+	c.subscriptions[sub.id] = sub
+	c.mut.Unlock()
+
+	current, termination := c.times(sub, call.config.ClockOffset)
+	return struct{ Address, Current, Termination string }{
+		call.xaddrs["subscription"] + sub.id, current, termination,
+	}
+}
+
+// getSubscription return the subscription addressed by the request path
+func (c *Camera) getSubscription(call *soapCall) (*subscription, *soapFault) {
+
+	id := strings.TrimPrefix(call.path, subscriptionPath)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	sub, ok := c.subscriptions[id]
+	if !ok || time.Now().After(sub.termination) {
+		delete(c.subscriptions, id)
+		return nil, &soapFault{"ResourceUnknown", "Subscription not found"}
+	}
+
+	return sub, nil
+}
+
+func createPullPointSubscription(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	return c.addSubscription(call, ""), nil
+}
+
+func subscribe(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	consumer := strings.TrimSpace(call.req.Body.Operation.ConsumerReference.Address)
+	if consumer == "" {
+		return nil, &soapFault{"InvalidArgVal", "Missing consumer reference"}
+	}
+	return c.addSubscription(call, consumer), nil
+}
+
+// pullMessages wait for events up to the requested timeout
+func pullMessages(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	sub, fault := c.getSubscription(call)
+	if fault != nil {
+		return nil, fault
+	}
+
+	timeout := parseDuration(call.req.Body.Operation.Timeout, maxPullTimeout)
+	if timeout > maxPullTimeout {
+		timeout = maxPullTimeout
+	}
+
+	limit := call.req.Body.Operation.MessageLimit
+	if limit <= 0 {
+		limit = 1
+	}
+
+	c.mut.Lock()
+	pending := len(sub.queue)
+	c.mut.Unlock()
+
+	if pending == 0 {
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return nil, &soapFault{"ResourceUnknown", "Subscription terminated"}
+		case <-time.After(timeout):
+		}
+	}
+
+	c.mut.Lock()
+	messages := sub.queue
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	sub.queue = sub.queue[len(messages):]
+	c.mut.Unlock()
+
+	current, termination := c.times(sub, call.config.ClockOffset)
+	return struct {
+		Current, Termination string
+		Messages             []event
+	}{current, termination, messages}, nil
+}
+
+func renew(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	sub, fault := c.getSubscription(call)
+	if fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	sub.termination = parseTermination(call.req.Body.Operation.TerminationTime, call.config.ClockOffset, defaultSubscriptionTime)
+	c.mut.Unlock()
+
+	current, termination := c.times(sub, call.config.ClockOffset)
+	return struct{ Current, Termination string }{current, termination}, nil
+}
+
+func unsubscribe(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	sub, fault := c.getSubscription(call)
+	if fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	delete(c.subscriptions, sub.id)
+	c.mut.Unlock()
+
+	return nil, nil
+}
@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	nsImaging = "http://www.onvif.org/ver20/imaging/wsdl"
+	// videoSourceToken is the single video source of the simulated cameras
+	videoSourceToken = "VideoSource_1"
+)
+
+// imagingSettings the simulated image settings
+type imagingSettings struct {
+	Brightness   float64
+	Saturation   float64
+	Contrast     float64
+	Sharpness    float64
+	IrCut        string
+	ExposureMode string
+	ExposureTime float64
+	Gain         float64
+	FocusMode    string
+	WDRMode      string
+	WDRLevel     float64
+}
+
+func defaultImagingSettings() imagingSettings {
+	return imagingSettings{
+		Brightness:   50,
+		Saturation:   50,
+		Contrast:     50,
+		Sharpness:    50,
+		IrCut:        "AUTO",
+		ExposureMode: "AUTO",
+		ExposureTime: 10000,
+		Gain:         0,
+		FocusMode:    "AUTO",
+		WDRMode:      "OFF",
+		WDRLevel:     50,
+	}
+}
+
+// imagingState the image settings and the focus, moving at speed units
+// per second during a continuous move
+type imagingState struct {
+	settings imagingSettings
+	// persisted are the settings restored on reboot
+	persisted imagingSettings
+	focus     float64
+	speed     float64
+	since     time.Time
+}
+
+// currentFocus return the focus position, updated by a continuous move
+func (s *imagingState) currentFocus(now time.Time) float64 {
+	if s.speed == 0 {
+		return s.focus
+	}
+	return math.Max(0, math.Min(1, s.focus+s.speed*now.Sub(s.since).Seconds()))
+}
+
+func (s *imagingState) focusTo(position float64) {
+	s.focus = math.Max(0, math.Min(1, position))
+	s.speed = 0
+}
+
+// imagingCall check the imaging support and the requested video source
+func imagingCall(call *soapCall) *soapFault {
+	if !call.config.Imaging {
+		return &soapFault{"ActionNotSupported", "Imaging not supported"}
+	}
+	if call.req.Body.Operation.VideoSourceToken != videoSourceToken {
+		return &soapFault{"NoSource", "Video source not found"}
+	}
+	return nil
+}
+
+// between check a requested value is in range
+func between(value *float64, min, max float64) bool {
+	return value == nil || (*value >= min && *value <= max)
+}
+
+// oneOf check a requested mode is allowed
+func oneOf(value string, modes ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, mode := range modes {
+		if value == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func getImagingSettings(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.imaging.settings, nil
+}
+
+func setImagingSettings(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	req := call.req.Body.Operation.ImagingSettings
+	valid := between(req.Brightness, 0, 100) &&
+		between(req.ColorSaturation, 0, 100) &&
+		between(req.Contrast, 0, 100) &&
+		between(req.Sharpness, 0, 100) &&
+		oneOf(req.IrCutFilter, "ON", "OFF", "AUTO") &&
+		oneOf(req.Exposure.Mode, "AUTO", "MANUAL") &&
+		between(req.Exposure.ExposureTime, 10, 40000) &&
+		between(req.Exposure.Gain, 0, 100) &&
+		oneOf(req.Focus.AutoFocusMode, "AUTO", "MANUAL") &&
+		oneOf(req.WideDynamicRange.Mode, "ON", "OFF") &&
+		between(req.WideDynamicRange.Level, 0, 100)
+	if !valid {
+		return nil, &soapFault{"SettingsInvalid", "Settings out of range"}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	s := &c.imaging.settings
+	set := func(target *float64, value *float64) {
+		if value != nil {
+			*target = *value
+		}
+	}
+	set(&s.Brightness, req.Brightness)
+	set(&s.Saturation, req.ColorSaturation)
+	set(&s.Contrast, req.Contrast)
+	set(&s.Sharpness, req.Sharpness)
+	set(&s.ExposureTime, req.Exposure.ExposureTime)
+	set(&s.Gain, req.Exposure.Gain)
+	set(&s.WDRLevel, req.WideDynamicRange.Level)
+	if req.IrCutFilter != "" {
+		s.IrCut = req.IrCutFilter
+	}
+	if req.Exposure.Mode != "" {
+		s.ExposureMode = req.Exposure.Mode
+	}
+	if req.Focus.AutoFocusMode != "" {
+		s.FocusMode = req.Focus.AutoFocusMode
+	}
+	if req.WideDynamicRange.Mode != "" {
+		s.WDRMode = req.WideDynamicRange.Mode
+	}
+
+	if call.req.Body.Operation.ForcePersistence {
+		c.imaging.persisted = *s
+	}
+
+	return nil, nil
+}
+
+func getImagingOptions(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+	return nil, nil
+}
+
+func imagingMove(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	focus := call.req.Body.Operation.Focus
+	now := time.Now()
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.imaging.settings.FocusMode != "MANUAL" {
+		return nil, &soapFault{"MoveNotSupported", "Focus is not in manual mode"}
+	}
+
+	current := c.imaging.currentFocus(now)
+	switch {
+	case focus.Absolute != nil:
+		c.imaging.focusTo(focus.Absolute.Position)
+	case focus.Relative != nil:
+		c.imaging.focusTo(current + focus.Relative.Distance)
+	case focus.Continuous != nil:
+		c.imaging.focusTo(current)
+		c.imaging.speed = focus.Continuous.Speed
+		c.imaging.since = now
+	default:
+		return nil, &soapFault{"InvalidArgVal", "Missing focus move"}
+	}
+
+	return nil, nil
+}
+
+func imagingStop(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.imaging.focusTo(c.imaging.currentFocus(time.Now()))
+	return nil, nil
+}
+
+func imagingGetStatus(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := imagingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	status := "IDLE"
+	if c.imaging.speed != 0 {
+		status = "MOVING"
+	}
+
+	return struct {
+		Position float64
+		Status   string
+	}{c.imaging.currentFocus(time.Now()), status}, nil
+}
@@ -0,0 +1,146 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// rebootDelay is the time a SystemReboot is answered before rebooting
+const rebootDelay = 100 * time.Millisecond
+
+func init() {
+	// registered here as rebooting restarts the server dispatching operations
+	operations["SystemReboot"] = systemReboot
+}
+
+// systemState the simulated device management settings
+type systemState struct {
+	// dateTimeType is Manual or NTP
+	dateTimeType string
+	ntpFromDHCP  bool
+	ntpServers   []string
+}
+
+func setSystemDateAndTime(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	req := call.req.Body.Operation
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	switch req.DateTimeType {
+	case "NTP":
+		// assume the NTP servers are reachable
+		c.config.ClockOffset = 0
+	case "Manual":
+		if req.UTCDateTime == nil {
+			return nil, &soapFault{"InvalidDateTime", "Missing UTCDateTime"}
+		}
+		utc := req.UTCDateTime
+		requested := time.Date(utc.Date.Year, time.Month(utc.Date.Month), utc.Date.Day, utc.Time.Hour, utc.Time.Minute, utc.Time.Second, 0, time.UTC)
+		if requested.Year() != utc.Date.Year || int(requested.Month()) != utc.Date.Month || requested.Day() != utc.Date.Day {
+			return nil, &soapFault{"InvalidDateTime", "Invalid date"}
+		}
+		c.config.ClockOffset = requested.Sub(time.Now()).Truncate(time.Second)
+	default:
+		return nil, &soapFault{"InvalidArgVal", fmt.Sprintf("Invalid DateTimeType %s", req.DateTimeType)}
+	}
+	c.system.dateTimeType = req.DateTimeType
+	// the local time settings are replaced, reset when missing as by most devices
+	c.config.DaylightSavings = req.DaylightSavings
+	c.config.TimeZone = ""
+	if req.TimeZone != nil {
+		c.config.TimeZone = req.TimeZone.TZ
+	}
+
+	return nil, nil
+}
+
+func setHostname(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	name := strings.TrimSpace(call.req.Body.Operation.Name)
+	if name == "" || len(name) > 63 || strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-.") != "" {
+		return nil, &soapFault{"InvalidHostname", "Invalid hostname"}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.config.Hostname = name
+
+	return nil, nil
+}
+
+func setNTP(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	req := call.req.Body.Operation
+	servers := []string{}
+	for _, host := range req.NTPManual {
+		server := host.DNSname + host.IPv4Address + host.IPv6Address
+		if server == "" {
+			return nil, &soapFault{"InvalidIPv4Address", "Missing NTP server address"}
+		}
+		servers = append(servers, server)
+	}
+	if !req.FromDHCP && len(servers) == 0 {
+		return nil, &soapFault{"InvalidArgVal", "Missing NTP servers"}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.system.ntpFromDHCP = req.FromDHCP
+	c.system.ntpServers = servers
+
+	return nil, nil
+}
+
+func getNTP(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return struct {
+		FromDHCP bool
+		Servers  []string
+	}{c.system.ntpFromDHCP, c.system.ntpServers}, nil
+}
+
+// NTP return the NTP servers set, empty if provided by DHCP
+func (c *Camera) NTP() (servers []string, fromDHCP bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]string{}, c.system.ntpServers...), c.system.ntpFromDHCP
+}
+
+func systemReboot(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	// answer before going down
+	time.AfterFunc(rebootDelay, func() {
+		if err := c.Reboot(); err != nil {
+			log.Printf("Simulated camera %s reboot failed: %s", c.UUID(), err)
+		}
+	})
+
+	return struct{ Message string }{"Rebooting in 1 second"}, nil
+}
+
+func getSystemLog(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var lines []string
+	switch call.req.Body.Operation.LogType {
+	case "System":
+		lines = append(lines,
+			fmt.Sprintf("%s firmware %s", c.config.Model, c.config.FirmwareVersion),
+			fmt.Sprintf("hostname %s", c.config.Hostname),
+			fmt.Sprintf("boots %d", c.boots),
+		)
+	case "Access":
+		lines = append(lines, fmt.Sprintf("user %s", c.config.Username))
+	default:
+		return nil, &soapFault{"InvalidArgVal", "Invalid LogType"}
+	}
+
+	return struct{ Log string }{strings.Join(lines, "\n")}, nil
+}
@@ -0,0 +1,258 @@
+package simulator
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const nsMedia2 = "http://www.onvif.org/ver20/media/wsdl"
+
+// soapCall the context of a SOAP operation
+type soapCall struct {
+	req    soapRequest
+	path   string
+	config Config
+	// xaddrs holds the service addresses by name
+	xaddrs map[string]string
+}
+
+// soapFault an operation failure, returned as a SOAP fault
+type soapFault struct {
+	subcode string
+	reason  string
+}
+
+// operationHandler return the data for the operation response template
+type operationHandler func(c *Camera, call *soapCall) (interface{}, *soapFault)
+
+// operations maps the supported operations, named as their response templates
+var operations = map[string]operationHandler{
+	"GetDeviceInformation": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return call.config, nil
+	},
+	"GetSystemDateAndTime": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		c.mut.Lock()
+		dateTimeType := c.system.dateTimeType
+		c.mut.Unlock()
+		return struct {
+			Now             time.Time
+			DateTimeType    string
+			DaylightSavings bool
+			TimeZone        string
+		}{time.Now().Add(call.config.ClockOffset).UTC(), dateTimeType, call.config.DaylightSavings, call.config.TimeZone}, nil
+	},
+	"SetSystemDateAndTime": setSystemDateAndTime,
+	"GetHostname": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return call.config, nil
+	},
+	"SetHostname":  setHostname,
+	"SetNTP":       setNTP,
+	"GetNTP":       getNTP,
+	"GetSystemLog": getSystemLog,
+	"GetNetworkInterfaces": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return struct{ MAC, Address string }{call.config.MAC, hostname(call.xaddrs["device"])}, nil
+	},
+	"GetCapabilities": getServices,
+	"GetServices": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		if call.config.Legacy {
+			return nil, &soapFault{"ActionNotSupported", "Operation GetServices not supported"}
+		}
+		return getServices(c, call)
+	},
+	"GetProfiles": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return call.config, nil
+	},
+	"GetVideoSources": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return videoSources(call.config.Profiles), nil
+	},
+	"GetStreamUri":   getStreamURI,
+	"GetSnapshotUri": getSnapshotURI,
+	"GetVideoEncoderConfigurations": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return call.config, nil
+	},
+	"SetVideoEncoderConfiguration":        setVideoEncoderConfiguration,
+	"AddVideoEncoderConfiguration":        addVideoEncoderConfiguration,
+	"GetVideoEncoderConfigurationOptions": getVideoEncoderConfigurationOptions,
+	"GetAudioEncoderConfigurations": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return nil, nil
+	},
+	"Media2GetProfiles": func(c *Camera, call *soapCall) (interface{}, *soapFault) {
+		return call.config, nil
+	},
+	"Media2GetStreamUri":   getStreamURI,
+	"Media2GetSnapshotUri": getSnapshotURI,
+
+	"CreatePullPointSubscription": createPullPointSubscription,
+	"Subscribe":                   subscribe,
+	"PullMessages":                pullMessages,
+	"Renew":                       renew,
+	"Unsubscribe":                 unsubscribe,
+
+	"PTZContinuousMove":   ptzContinuousMove,
+	"PTZAbsoluteMove":     ptzAbsoluteMove,
+	"PTZRelativeMove":     ptzRelativeMove,
+	"PTZStop":             ptzStop,
+	"PTZGetStatus":        ptzGetStatus,
+	"PTZGetPresets":       ptzGetPresets,
+	"PTZSetPreset":        ptzSetPreset,
+	"PTZGotoPreset":       ptzGotoPreset,
+	"PTZGotoHomePosition": ptzGotoHomePosition,
+
+	"ImagingGetImagingSettings": getImagingSettings,
+	"ImagingSetImagingSettings": setImagingSettings,
+	"ImagingGetOptions":         getImagingOptions,
+	"ImagingMove":               imagingMove,
+	"ImagingStop":               imagingStop,
+	"ImagingGetStatus":          imagingGetStatus,
+
+	"GetRecordingSummary":       getRecordingSummary,
+	"FindRecordings":            findRecordings,
+	"GetRecordingSearchResults": getRecordingSearchResults,
+	"EndSearch":                 endSearch,
+	"GetReplayUri":              getReplayURI,
+
+	"GetRelayOutputs":             getRelayOutputs,
+	"SetRelayOutputState":         setRelayOutputState,
+	"DeviceIOGetRelayOutputs":     getRelayOutputs,
+	"DeviceIOSetRelayOutputState": setRelayOutputState,
+	"DeviceIOGetDigitalInputs":    getDigitalInputs,
+}
+
+// operationPrefixes disambiguate the operations named as in other services
+var operationPrefixes = map[string]string{
+	nsMedia2:   "Media2",
+	nsPTZ:      "PTZ",
+	nsImaging:  "Imaging",
+	nsDeviceIO: "DeviceIO",
+}
+
+// operationName return the operation of a request, prefixed by service
+// as in operationPrefixes
+func operationName(req soapRequest) string {
+	return operationPrefixes[req.Body.Operation.XMLName.Space] + req.Body.Operation.XMLName.Local
+}
+
+func getServices(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	return struct {
+		DeviceXAddr, MediaXAddr, Media2XAddr, EventsXAddr, PTZXAddr, ImagingXAddr string
+		SearchXAddr, ReplayXAddr, DeviceIOXAddr                                   string
+	}{
+		call.xaddrs["device"],
+		call.xaddrs["media"],
+		call.xaddrs["media2"],
+		call.xaddrs["events"],
+		call.xaddrs["ptz"],
+		call.xaddrs["imaging"],
+		call.xaddrs["search"],
+		call.xaddrs["replay"],
+		call.xaddrs["deviceio"],
+	}, nil
+}
+
+func getStreamURI(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	profile, ok := findProfile(call.config.Profiles, call.req.Body.Operation.ProfileToken)
+	if !ok {
+		return nil, &soapFault{"NoProfile", "Profile not found"}
+	}
+	if profile.Offline {
+		return nil, &soapFault{"NoSource", "Video source offline"}
+	}
+
+	protocol := call.req.Body.Operation.StreamSetup.Transport.Protocol
+	if call.req.Body.Operation.Protocol != "" {
+		protocol = call.req.Body.Operation.Protocol
+	}
+
+	uri := profile.StreamURI
+	if uri == "" {
+		host := hostname(call.xaddrs["device"])
+		switch protocol {
+		case "HTTP", "RtspOverHttp":
+			uri = fmt.Sprintf("http://%s:80/rtsp-over-http/%s", host, profile.Token)
+		case "RTSPS":
+			uri = fmt.Sprintf("rtsps://%s:322/%s", host, profile.Token)
+		default:
+			uri = fmt.Sprintf("rtsp://%s:554/%s", host, profile.Token)
+		}
+	}
+
+	// time-limited and reboot-bound URIs carry a session
+	query := url.Values{}
+	if profile.InvalidAfterReboot {
+		c.mut.Lock()
+		query.Set("boot", strconv.Itoa(c.boots))
+		c.mut.Unlock()
+	}
+	if profile.URITimeout > 0 {
+		c.mut.Lock()
+		c.sessions++
+		query.Set("session", strconv.Itoa(c.sessions))
+		c.mut.Unlock()
+	}
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	return struct {
+		URI                 string
+		Timeout             string
+		InvalidAfterReboot  bool
+		InvalidAfterConnect bool
+	}{uri, fmt.Sprintf("PT%dS", int(profile.URITimeout.Seconds())), profile.InvalidAfterReboot, profile.InvalidAfterConnect}, nil
+}
+
+func getSnapshotURI(c *Camera, call *soapCall) (interface{}, *soapFault) {
+
+	profile, ok := findProfile(call.config.Profiles, call.req.Body.Operation.ProfileToken)
+	if !ok {
+		return nil, &soapFault{"NoProfile", "Profile not found"}
+	}
+
+	uri := profile.SnapshotURI
+	if uri == "" {
+		uri = call.xaddrs["snapshot"] + profile.Token + ".jpg"
+	}
+
+	return struct{ URI string }{uri}, nil
+}
+
+// sourceConfig return the token of the video source configuration of a
+// source, eg. VideoSourceConfig_1 for VideoSource_1
+func sourceConfig(source string) string {
+	return "VideoSourceConfig_" + strings.TrimPrefix(source, "VideoSource_")
+}
+
+// videoSources return a profile per video source, the first one bound to it
+func videoSources(profiles []Profile) []Profile {
+	sources := []Profile{}
+	seen := map[string]bool{}
+	for _, profile := range profiles {
+		if !seen[profile.VideoSource] {
+			seen[profile.VideoSource] = true
+			sources = append(sources, profile)
+		}
+	}
+	return sources
+}
+
+// findProfile return the profile matching token, or the first one if token is empty
+func findProfile(profiles []Profile, token string) (Profile, bool) {
+	for _, profile := range profiles {
+		if token == "" || profile.Token == token {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+func hostname(xaddr string) string {
+	u, err := url.Parse(xaddr)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
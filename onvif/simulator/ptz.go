@@ -0,0 +1,269 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const nsPTZ = "http://www.onvif.org/ver20/ptz/wsdl"
+
+// position a pan, tilt and zoom value in the generic spaces
+type position struct {
+	Pan  float64
+	Tilt float64
+	Zoom float64
+}
+
+// clamp limit a position to the generic spaces: -1 to 1 for pan and tilt, 0 to 1 for zoom
+func (p position) clamp() position {
+	return position{
+		Pan:  math.Max(-1, math.Min(1, p.Pan)),
+		Tilt: math.Max(-1, math.Min(1, p.Tilt)),
+		Zoom: math.Max(0, math.Min(1, p.Zoom)),
+	}
+}
+
+// apply replace the components set in a request vector
+func (p position) apply(v ptzVector) position {
+	if v.PanTilt != nil {
+		p.Pan = v.PanTilt.X
+		p.Tilt = v.PanTilt.Y
+	}
+	if v.Zoom != nil {
+		p.Zoom = v.Zoom.X
+	}
+	return p
+}
+
+// translate add the components set in a request vector
+func (p position) translate(v ptzVector) position {
+	if v.PanTilt != nil {
+		p.Pan += v.PanTilt.X
+		p.Tilt += v.PanTilt.Y
+	}
+	if v.Zoom != nil {
+		p.Zoom += v.Zoom.X
+	}
+	return p
+}
+
+// preset a stored position
+type preset struct {
+	Token    string
+	Name     string
+	Position position
+}
+
+// ptzState the simulated PTZ unit, shared by all the profiles. Absolute,
+// relative and preset moves complete immediately, continuous moves change
+// the position over time at velocity units per second.
+type ptzState struct {
+	position position
+	home     position
+	velocity position
+	since    time.Time
+	until    time.Time
+	presets  []preset
+}
+
+// current return the position, updated by a continuous move
+func (s *ptzState) current(now time.Time) position {
+	if s.velocity == (position{}) {
+		return s.position
+	}
+	end := now
+	if !s.until.IsZero() && s.until.Before(end) {
+		end = s.until
+	}
+	elapsed := end.Sub(s.since).Seconds()
+	return position{
+		Pan:  s.position.Pan + s.velocity.Pan*elapsed,
+		Tilt: s.position.Tilt + s.velocity.Tilt*elapsed,
+		Zoom: s.position.Zoom + s.velocity.Zoom*elapsed,
+	}.clamp()
+}
+
+// moving return if a continuous move is in progress
+func (s *ptzState) moving(now time.Time) bool {
+	return s.velocity != (position{}) && (s.until.IsZero() || now.Before(s.until))
+}
+
+// moveTo stop any continuous move, setting the position
+func (s *ptzState) moveTo(p position) {
+	s.position = p.clamp()
+	s.velocity = position{}
+}
+
+// ptzCall check the PTZ support and the requested profile
+func ptzCall(call *soapCall) *soapFault {
+	if !call.config.PTZ {
+		return &soapFault{"NoPTZProfile", "PTZ not supported"}
+	}
+	if _, ok := findProfile(call.config.Profiles, call.req.Body.Operation.ProfileToken); !ok {
+		return &soapFault{"NoProfile", "Profile not found"}
+	}
+	return nil
+}
+
+func ptzContinuousMove(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	op := call.req.Body.Operation
+	now := time.Now()
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.ptz.moveTo(c.ptz.current(now))
+	c.ptz.velocity = position{}.apply(op.Velocity)
+	c.ptz.since = now
+	c.ptz.until = time.Time{}
+	if op.Timeout != "" {
+		c.ptz.until = now.Add(parseDuration(op.Timeout, 0))
+	}
+
+	return nil, nil
+}
+
+func ptzAbsoluteMove(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.ptz.moveTo(c.ptz.current(time.Now()).apply(call.req.Body.Operation.Position))
+	return nil, nil
+}
+
+func ptzRelativeMove(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.ptz.moveTo(c.ptz.current(time.Now()).translate(call.req.Body.Operation.Translation))
+	return nil, nil
+}
+
+func ptzStop(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.ptz.moveTo(c.ptz.current(time.Now()))
+	return nil, nil
+}
+
+func ptzGetStatus(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	now := time.Now()
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	status := "IDLE"
+	if c.ptz.moving(now) {
+		status = "MOVING"
+	}
+
+	return struct {
+		Position position
+		Status   string
+		Time     string
+	}{c.ptz.current(now), status, now.Add(call.config.ClockOffset).UTC().Format(time.RFC3339)}, nil
+}
+
+func ptzGetPresets(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return struct{ Presets []preset }{append([]preset{}, c.ptz.presets...)}, nil
+}
+
+func ptzSetPreset(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	op := call.req.Body.Operation
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	current := c.ptz.current(time.Now())
+
+	if op.PresetToken != "" {
+		for i, p := range c.ptz.presets {
+			if p.Token == op.PresetToken {
+				c.ptz.presets[i].Position = current
+				if op.PresetName != "" {
+					c.ptz.presets[i].Name = op.PresetName
+				}
+				return struct{ Token string }{p.Token}, nil
+			}
+		}
+		return nil, &soapFault{"NoToken", "Preset not found"}
+	}
+
+	for _, p := range c.ptz.presets {
+		if p.Name == op.PresetName {
+			return nil, &soapFault{"PresetExist", "Preset name already exists"}
+		}
+	}
+
+	token := fmt.Sprintf("Preset_%d", len(c.ptz.presets)+1)
+	name := op.PresetName
+	if name == "" {
+		name = token
+	}
+	c.ptz.presets = append(c.ptz.presets, preset{Token: token, Name: name, Position: current})
+
+	return struct{ Token string }{token}, nil
+}
+
+func ptzGotoPreset(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, p := range c.ptz.presets {
+		if p.Token == call.req.Body.Operation.PresetToken {
+			c.ptz.moveTo(p.Position)
+			return nil, nil
+		}
+	}
+
+	return nil, &soapFault{"NoToken", "Preset not found"}
+}
+
+func ptzGotoHomePosition(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := ptzCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.ptz.moveTo(c.ptz.home)
+	return nil, nil
+}
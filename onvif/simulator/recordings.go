@@ -0,0 +1,158 @@
+package simulator
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Recording a simulated recording of the video source, eg. on an SD card
+type Recording struct {
+	Token string
+	Start time.Time
+	// End is the end of the recorded data, zero while still recording
+	End time.Time
+}
+
+// defaultRecordings return a single recording of the last day, still recording
+func defaultRecordings(now time.Time) []Recording {
+	return []Recording{{Token: "Recording_1", Start: now.Add(-24 * time.Hour).UTC().Truncate(time.Second)}}
+}
+
+// recordingInfo the search result of a recording
+type recordingInfo struct {
+	Token, Source, Start, End, Status string
+}
+
+func recordingInformation(recordings []Recording, now time.Time) []recordingInfo {
+	list := make([]recordingInfo, len(recordings))
+	for i, recording := range recordings {
+		end, status := recording.End, "Stopped"
+		if end.IsZero() {
+			end, status = now, "Recording"
+		}
+		list[i] = recordingInfo{
+			Token:  recording.Token,
+			Source: videoSourceToken,
+			Start:  recording.Start.UTC().Format(time.RFC3339),
+			End:    end.UTC().Format(time.RFC3339),
+			Status: status,
+		}
+	}
+	return list
+}
+
+// recordingCall check the recording support
+func recordingCall(call *soapCall) *soapFault {
+	if !call.config.Recording {
+		return &soapFault{"ActionNotSupported", "Recording not supported"}
+	}
+	return nil
+}
+
+func getRecordingSummary(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := recordingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	list := recordingInformation(call.config.Recordings, time.Now())
+	summary := struct {
+		From, Until string
+		Count       int
+	}{Count: len(list)}
+	for _, info := range list {
+		if summary.From == "" || info.Start < summary.From {
+			summary.From = info.Start
+		}
+		if info.End > summary.Until {
+			summary.Until = info.End
+		}
+	}
+	if summary.From == "" {
+		summary.From = time.Now().UTC().Format(time.RFC3339)
+		summary.Until = summary.From
+	}
+
+	return summary, nil
+}
+
+func findRecordings(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := recordingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.searchID++
+	token := "Search_" + strconv.Itoa(c.searchID)
+	c.searches[token] = 0
+
+	return struct{ Token string }{token}, nil
+}
+
+func getRecordingSearchResults(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := recordingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	req := call.req.Body.Operation
+	list := recordingInformation(call.config.Recordings, time.Now())
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	offset, ok := c.searches[req.SearchToken]
+	if !ok {
+		return nil, &soapFault{"InvalidToken", fmt.Sprintf("Search %s not found", req.SearchToken)}
+	}
+
+	end := len(list)
+	if req.MaxResults > 0 && offset+req.MaxResults < end {
+		end = offset + req.MaxResults
+	}
+	c.searches[req.SearchToken] = end
+
+	state := "Searching"
+	if end == len(list) && !call.config.SearchStuck {
+		state = "Completed"
+	}
+
+	return struct {
+		State      string
+		Recordings []recordingInfo
+	}{state, list[offset:end]}, nil
+}
+
+func endSearch(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := recordingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	token := call.req.Body.Operation.SearchToken
+	if _, ok := c.searches[token]; !ok {
+		return nil, &soapFault{"InvalidToken", fmt.Sprintf("Search %s not found", token)}
+	}
+	delete(c.searches, token)
+
+	return struct{ Current string }{time.Now().UTC().Format(time.RFC3339)}, nil
+}
+
+func getReplayURI(c *Camera, call *soapCall) (interface{}, *soapFault) {
+	if fault := recordingCall(call); fault != nil {
+		return nil, fault
+	}
+
+	token := call.req.Body.Operation.RecordingToken
+	for _, recording := range call.config.Recordings {
+		if recording.Token == token {
+			uri := fmt.Sprintf("rtsp://%s:554/replay/%s", hostname(call.xaddrs["device"]), token)
+			return struct{ URI string }{uri}, nil
+		}
+	}
+
+	return nil, &soapFault{"NoRecording", "Recording not found"}
+}
@@ -0,0 +1,140 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// ActionAdd start a camera
+	ActionAdd = "add"
+	// ActionRemove stop a camera
+	ActionRemove = "remove"
+	// ActionMove change the address of a camera
+	ActionMove = "move"
+	// ActionRename change the name of a camera
+	ActionRename = "rename"
+	// ActionEvent publish an event, eg. motion detected
+	ActionEvent = "event"
+	// ActionReboot restart a camera on the same address
+	ActionReboot = "reboot"
+	// ActionRenew replace the certificate of a camera serving HTTPS
+	ActionRenew = "renew"
+)
+
+// Step a scripted change to the simulated cameras
+type Step struct {
+	// After is the delay from the previous step
+	After   time.Duration
+	Action  string
+	UUID    string
+	Name    string
+	Address string
+	// Camera is the configuration of the camera to add
+	Camera Config
+	// Topic, Source and Data describe the event to publish, the items being
+	// Name=Value pairs as the configuration keys are case insensitive
+	Topic  string
+	Source []string
+	Data   []string
+}
+
+// Script a set of cameras started at once, followed by scripted steps
+type Script struct {
+	Cameras []Config
+	Steps   []Step
+}
+
+// LoadScript read a script from a YAML or JSON file
+func LoadScript(path string) (Script, error) {
+
+	script := Script{}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return script, err
+	}
+
+	if err := v.Unmarshal(&script); err != nil {
+		return script, fmt.Errorf("Invalid script %s: %s", path, err)
+	}
+
+	return script, nil
+}
+
+// Run add the script cameras and play the steps, until completed or stop is closed
+func (s *Simulator) Run(script Script, stop <-chan struct{}) error {
+
+	for _, config := range script.Cameras {
+		if _, err := s.Add(config); err != nil {
+			return err
+		}
+	}
+
+	for i, step := range script.Steps {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(step.After):
+		}
+		if err := s.Play(step); err != nil {
+			log.Printf("Step %d (%s) failed: %s", i+1, step.Action, err)
+		}
+	}
+
+	return nil
+}
+
+// Play apply a single step
+func (s *Simulator) Play(step Step) error {
+	switch step.Action {
+	case ActionAdd:
+		config := step.Camera
+		if config.UUID == "" {
+			config.UUID = step.UUID
+		}
+		if config.Name == "" {
+			config.Name = step.Name
+		}
+		if config.Address == "" {
+			config.Address = step.Address
+		}
+		_, err := s.Add(config)
+		return err
+	case ActionRemove:
+		return s.Remove(step.UUID)
+	case ActionMove:
+		return s.Move(step.UUID, step.Address)
+	case ActionRename:
+		return s.Rename(step.UUID, step.Name)
+	case ActionEvent:
+		camera, ok := s.Get(step.UUID)
+		if !ok {
+			return fmt.Errorf("Camera %s not found", step.UUID)
+		}
+		camera.Publish(step.Topic, pairs(step.Source), pairs(step.Data))
+		return nil
+	case ActionReboot:
+		return s.Reboot(step.UUID)
+	case ActionRenew:
+		return s.RenewCertificate(step.UUID)
+	}
+	return fmt.Errorf("Unknown action %s", step.Action)
+}
+
+// pairs convert a list of Name=Value items to a map
+func pairs(list []string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range list {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return values
+}
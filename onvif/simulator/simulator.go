@@ -0,0 +1,306 @@
+package simulator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/muka/camd/onvif/discovery"
+)
+
+const (
+	maxDatagramSize  = 8192
+	multicastAddress = "239.255.255.250:3702"
+)
+
+// NewSimulator init a simulator of ONVIF NetworkVideoTransmitters
+func NewSimulator() *Simulator {
+	return &Simulator{
+		cameras: map[string]*Camera{},
+	}
+}
+
+// Simulator runs a set of simulated cameras and answers WS-Discovery Probes on their behalf
+type Simulator struct {
+	mut     sync.Mutex
+	cameras map[string]*Camera
+	conn    *net.UDPConn
+}
+
+// Start listen for WS-Discovery Probes on the multicast group
+func (s *Simulator) Start() error {
+
+	groupAddress, err := net.ResolveUDPAddr("udp4", multicastAddress)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return fmt.Errorf("Failed to listen for probes: %s", err)
+	}
+	conn.SetReadBuffer(maxDatagramSize)
+
+	s.mut.Lock()
+	s.conn = conn
+	s.mut.Unlock()
+
+	go func() {
+		for {
+			buffer := make([]byte, maxDatagramSize)
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			for _, res := range s.handleProbe(buffer[:n]) {
+				if _, err := conn.WriteToUDP(res, from); err != nil {
+					log.Printf("Failed to send ProbeMatches to %s: %s", from, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop remove all the cameras, sending Bye for each of them
+func (s *Simulator) Stop() error {
+
+	s.mut.Lock()
+	ids := []string{}
+	for id := range s.cameras {
+		ids = append(ids, id)
+	}
+	s.mut.Unlock()
+
+	for _, id := range ids {
+		if err := s.Remove(id); err != nil {
+			log.Printf("Failed to remove camera %s: %s", id, err)
+		}
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
+
+// Cameras return the running cameras
+func (s *Simulator) Cameras() []*Camera {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	list := []*Camera{}
+	for _, camera := range s.cameras {
+		list = append(list, camera)
+	}
+	return list
+}
+
+// Get return a running camera by UUID
+func (s *Simulator) Get(id string) (*Camera, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	camera, ok := s.cameras[normalizeUUID(id)]
+	return camera, ok
+}
+
+// Add start a camera and announce it with Hello
+func (s *Simulator) Add(config Config) (*Camera, error) {
+
+	camera := NewCamera(config)
+
+	s.mut.Lock()
+	if _, ok := s.cameras[camera.UUID()]; ok {
+		s.mut.Unlock()
+		return nil, fmt.Errorf("Camera %s already exists", camera.UUID())
+	}
+	s.mut.Unlock()
+
+	if err := camera.Start(); err != nil {
+		return nil, err
+	}
+
+	s.mut.Lock()
+	s.cameras[camera.UUID()] = camera
+	s.mut.Unlock()
+
+	log.Printf("Added simulated camera name=%s xaddr=%s", camera.Config().Name, camera.XAddr())
+	s.hello(camera)
+
+	return camera, nil
+}
+
+// Remove announce a camera leaving with Bye and stop it
+func (s *Simulator) Remove(id string) error {
+
+	s.mut.Lock()
+	camera, ok := s.cameras[normalizeUUID(id)]
+	delete(s.cameras, normalizeUUID(id))
+	s.mut.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Camera %s not found", id)
+	}
+
+	s.bye(camera)
+	log.Printf("Removed simulated camera name=%s", camera.Config().Name)
+
+	return camera.Stop()
+}
+
+// Move change a camera address, announcing it with Hello
+func (s *Simulator) Move(id string, address string) error {
+
+	camera, ok := s.Get(id)
+	if !ok {
+		return fmt.Errorf("Camera %s not found", id)
+	}
+
+	if err := camera.Move(address); err != nil {
+		return err
+	}
+
+	log.Printf("Moved simulated camera name=%s xaddr=%s", camera.Config().Name, camera.XAddr())
+	s.hello(camera)
+
+	return nil
+}
+
+// Reboot restart a camera, announcing it with Hello
+func (s *Simulator) Reboot(id string) error {
+
+	camera, ok := s.Get(id)
+	if !ok {
+		return fmt.Errorf("Camera %s not found", id)
+	}
+
+	if err := camera.Reboot(); err != nil {
+		return err
+	}
+
+	log.Printf("Rebooted simulated camera name=%s", camera.Config().Name)
+	s.hello(camera)
+
+	return nil
+}
+
+// RenewCertificate replace the certificate of a camera serving HTTPS
+func (s *Simulator) RenewCertificate(id string) error {
+
+	camera, ok := s.Get(id)
+	if !ok {
+		return fmt.Errorf("Camera %s not found", id)
+	}
+
+	if !camera.Config().TLS {
+		return fmt.Errorf("Camera %s does not serve HTTPS", id)
+	}
+
+	if err := camera.RenewCertificate(); err != nil {
+		return err
+	}
+
+	log.Printf("Renewed certificate of simulated camera name=%s", camera.Config().Name)
+
+	return nil
+}
+
+// Rename change a camera name, announcing it with Hello
+func (s *Simulator) Rename(id string, name string) error {
+
+	camera, ok := s.Get(id)
+	if !ok {
+		return fmt.Errorf("Camera %s not found", id)
+	}
+
+	camera.Rename(name)
+	log.Printf("Renamed simulated camera %s name=%s", camera.UUID(), name)
+	s.hello(camera)
+
+	return nil
+}
+
+// handleProbe return a ProbeMatches message for each camera matching a Probe
+func (s *Simulator) handleProbe(buffer []byte) [][]byte {
+
+	probe := discovery.ProbeMatchEnvelope{}
+	if err := xml.Unmarshal(buffer, &probe); err != nil {
+		return nil
+	}
+
+	if strings.TrimSpace(probe.Header.Action.Text) != discovery.ActionProbe {
+		return nil
+	}
+
+	if !matchTypes(probe.Body.Probe.Types) {
+		return nil
+	}
+
+	responses := [][]byte{}
+	for _, camera := range s.Cameras() {
+		msg := discovery.CreateProbeMatchesMessage(newUUID(), probe.Header.MessageID, []discovery.ProbeMatch{camera.ProbeMatch()})
+		responses = append(responses, []byte(msg))
+	}
+
+	return responses
+}
+
+func (s *Simulator) hello(camera *Camera) {
+	s.multicast(discovery.CreateHelloMessage(newUUID(), "", camera.ProbeMatch()))
+}
+
+func (s *Simulator) bye(camera *Camera) {
+	s.multicast(discovery.CreateByeMessage(newUUID(), camera.ProbeMatch()))
+}
+
+func (s *Simulator) multicast(msg string) {
+
+	groupAddress, err := net.ResolveUDPAddr("udp4", multicastAddress)
+	if err != nil {
+		log.Printf("Failed to resolve multicast address: %s", err)
+		return
+	}
+
+	conn, err := net.DialUDP("udp4", nil, groupAddress)
+	if err != nil {
+		log.Printf("Failed to send announcement: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		log.Printf("Failed to send announcement: %s", err)
+	}
+}
+
+// matchTypes return true if a Probe types list is empty or includes NetworkVideoTransmitter
+func matchTypes(types string) bool {
+	list := strings.Fields(types)
+	if len(list) == 0 {
+		return true
+	}
+	for _, t := range list {
+		if t == "NetworkVideoTransmitter" || strings.HasSuffix(t, ":NetworkVideoTransmitter") {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeUUID(id string) string {
+	if strings.HasPrefix(id, "urn:uuid:") {
+		return id
+	}
+	return "urn:uuid:" + id
+}
+
+func newUUID() string {
+	return uuid.Must(uuid.NewV4()).String()
+}
@@ -0,0 +1,60 @@
+package simulator
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/muka/camd/onvif/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleProbe(t *testing.T) {
+
+	sim := NewSimulator()
+	camera := NewCamera(Config{Name: "Front Door"})
+	sim.cameras[camera.UUID()] = camera
+
+	probe := discovery.CreateProbeMessage("0a6dc791-2be6-4991-9af1-454778a1917a")
+	responses := sim.handleProbe([]byte(probe))
+	assert.Len(t, responses, 1)
+
+	res := discovery.ProbeMatchEnvelope{}
+	err := xml.Unmarshal(responses[0], &res)
+	if err != nil {
+		t.Fatalf("Failed to parse ProbeMatches: %s", err)
+	}
+
+	assert.Equal(t, "uuid:0a6dc791-2be6-4991-9af1-454778a1917a", res.Header.RelatesTo)
+	assert.Len(t, res.Body.ProbeMatches.ProbeMatch, 1)
+	match := res.Body.ProbeMatches.ProbeMatch[0]
+	assert.Equal(t, camera.UUID(), match.EndpointReference.Address)
+	assert.Contains(t, match.Scopes, "onvif://www.onvif.org/name/Front%20Door")
+}
+
+func TestGetStreamUri(t *testing.T) {
+
+	camera := NewCamera(Config{})
+	err := camera.Start()
+	if err != nil {
+		t.Fatalf("Failed to start camera: %s", err)
+	}
+	defer camera.Stop()
+
+	req := `<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:trt="http://www.onvif.org/ver10/media/wsdl"><s:Body><trt:GetStreamUri><trt:ProfileToken>Profile_2</trt:ProfileToken></trt:GetStreamUri></s:Body></s:Envelope>`
+	res, err := http.Post(camera.XAddr(), "application/soap+xml", strings.NewReader(req))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %s", err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), "rtsp://127.0.0.1:554/Profile_2")
+}
@@ -0,0 +1,300 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"text/template"
+)
+
+const envelopeHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tt="http://www.onvif.org/ver10/schema" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tr2="http://www.onvif.org/ver20/media/wsdl" xmlns:ter="http://www.onvif.org/ver10/error" xmlns:tev="http://www.onvif.org/ver10/events/wsdl" xmlns:wsnt="http://docs.oasis-open.org/wsn/b-2" xmlns:wsa="http://www.w3.org/2005/08/addressing" xmlns:tns1="http://www.onvif.org/ver10/topics" xmlns:tptz="http://www.onvif.org/ver20/ptz/wsdl" xmlns:timg="http://www.onvif.org/ver20/imaging/wsdl" xmlns:tse="http://www.onvif.org/ver10/search/wsdl" xmlns:trp="http://www.onvif.org/ver10/replay/wsdl" xmlns:tmd="http://www.onvif.org/ver10/deviceIO/wsdl"><s:Body>`
+
+const envelopeFooter = `</s:Body></s:Envelope>`
+
+// soapRequest a generic SOAP request, exposing the body operation and its common arguments
+type soapRequest struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Header  struct {
+		Security struct {
+			UsernameToken struct {
+				Username string `xml:"Username"`
+				Password string `xml:"Password"`
+				Nonce    string `xml:"Nonce"`
+				Created  string `xml:"Created"`
+			} `xml:"UsernameToken"`
+		} `xml:"Security"`
+	} `xml:"Header"`
+	Body struct {
+		Operation struct {
+			XMLName      xml.Name
+			ProfileToken string `xml:"ProfileToken"`
+			Protocol     string `xml:"Protocol"`
+			StreamSetup  struct {
+				Transport struct {
+					Protocol string `xml:"Protocol"`
+				} `xml:"Transport"`
+			} `xml:"StreamSetup"`
+			// events subscriptions
+			InitialTerminationTime string `xml:"InitialTerminationTime"`
+			TerminationTime        string `xml:"TerminationTime"`
+			Timeout                string `xml:"Timeout"`
+			MessageLimit           int    `xml:"MessageLimit"`
+			ConsumerReference      struct {
+				Address string `xml:"Address"`
+			} `xml:"ConsumerReference"`
+			// ptz
+			Velocity    ptzVector `xml:"Velocity"`
+			Position    ptzVector `xml:"Position"`
+			Translation ptzVector `xml:"Translation"`
+			PresetToken string    `xml:"PresetToken"`
+			PresetName  string    `xml:"PresetName"`
+			// imaging
+			VideoSourceToken string           `xml:"VideoSourceToken"`
+			ImagingSettings  imagingRequest   `xml:"ImagingSettings"`
+			ForcePersistence bool             `xml:"ForcePersistence"`
+			Focus            focusMoveRequest `xml:"Focus"`
+			// media
+			Configuration      encoderRequest `xml:"Configuration"`
+			ConfigurationToken string         `xml:"ConfigurationToken"`
+			// device management
+			FromDHCP  bool `xml:"FromDHCP"`
+			NTPManual []struct {
+				IPv4Address string `xml:"IPv4Address"`
+				IPv6Address string `xml:"IPv6Address"`
+				DNSname     string `xml:"DNSname"`
+			} `xml:"NTPManual"`
+			DateTimeType    string `xml:"DateTimeType"`
+			DaylightSavings bool   `xml:"DaylightSavings"`
+			TimeZone        *struct {
+				TZ string `xml:"TZ"`
+			} `xml:"TimeZone"`
+			UTCDateTime *struct {
+				Time struct {
+					Hour   int `xml:"Hour"`
+					Minute int `xml:"Minute"`
+					Second int `xml:"Second"`
+				} `xml:"Time"`
+				Date struct {
+					Year  int `xml:"Year"`
+					Month int `xml:"Month"`
+					Day   int `xml:"Day"`
+				} `xml:"Date"`
+			} `xml:"UTCDateTime"`
+			Name    string `xml:"Name"`
+			LogType string `xml:"LogType"`
+			// recording search and replay
+			SearchToken    string `xml:"SearchToken"`
+			MaxResults     int    `xml:"MaxResults"`
+			RecordingToken string `xml:"RecordingToken"`
+			// relays
+			RelayOutputToken string `xml:"RelayOutputToken"`
+			LogicalState     string `xml:"LogicalState"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// ptzVector a PTZ request vector, nil components are left unchanged
+type ptzVector struct {
+	PanTilt *struct {
+		X float64 `xml:"x,attr"`
+		Y float64 `xml:"y,attr"`
+	} `xml:"PanTilt"`
+	Zoom *struct {
+		X float64 `xml:"x,attr"`
+	} `xml:"Zoom"`
+}
+
+// encoderRequest the SetVideoEncoderConfiguration values
+type encoderRequest struct {
+	Token      string `xml:"token,attr"`
+	Name       string `xml:"Name"`
+	Encoding   string `xml:"Encoding"`
+	Resolution struct {
+		Width  int `xml:"Width"`
+		Height int `xml:"Height"`
+	} `xml:"Resolution"`
+	Quality     float64 `xml:"Quality"`
+	RateControl *struct {
+		FrameRateLimit int `xml:"FrameRateLimit"`
+		BitrateLimit   int `xml:"BitrateLimit"`
+	} `xml:"RateControl"`
+	H264 *struct {
+		GovLength int `xml:"GovLength"`
+	} `xml:"H264"`
+}
+
+// imagingRequest the SetImagingSettings values, nil or empty if unchanged
+type imagingRequest struct {
+	Brightness      *float64 `xml:"Brightness"`
+	ColorSaturation *float64 `xml:"ColorSaturation"`
+	Contrast        *float64 `xml:"Contrast"`
+	Sharpness       *float64 `xml:"Sharpness"`
+	IrCutFilter     string   `xml:"IrCutFilter"`
+	Exposure        struct {
+		Mode         string   `xml:"Mode"`
+		ExposureTime *float64 `xml:"ExposureTime"`
+		Gain         *float64 `xml:"Gain"`
+	} `xml:"Exposure"`
+	Focus struct {
+		AutoFocusMode string `xml:"AutoFocusMode"`
+	} `xml:"Focus"`
+	WideDynamicRange struct {
+		Mode  string   `xml:"Mode"`
+		Level *float64 `xml:"Level"`
+	} `xml:"WideDynamicRange"`
+}
+
+// focusMoveRequest an imaging Move, only one mode being set
+type focusMoveRequest struct {
+	Absolute *struct {
+		Position float64 `xml:"Position"`
+	} `xml:"Absolute"`
+	Relative *struct {
+		Distance float64 `xml:"Distance"`
+	} `xml:"Relative"`
+	Continuous *struct {
+		Speed float64 `xml:"Speed"`
+	} `xml:"Continuous"`
+}
+
+var templates = template.Must(template.New("soap").Funcs(template.FuncMap{
+	"escape":       escape,
+	"sourceConfig": sourceConfig,
+}).Parse(`
+{{define "GetDeviceInformation"}}<tds:GetDeviceInformationResponse><tds:Manufacturer>{{escape .Manufacturer}}</tds:Manufacturer><tds:Model>{{escape .Model}}</tds:Model><tds:FirmwareVersion>{{escape .FirmwareVersion}}</tds:FirmwareVersion><tds:SerialNumber>{{escape .SerialNumber}}</tds:SerialNumber><tds:HardwareId>{{escape .Hardware}}</tds:HardwareId></tds:GetDeviceInformationResponse>{{end}}
+
+{{define "GetSystemDateAndTime"}}<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime><tt:DateTimeType>{{.DateTimeType}}</tt:DateTimeType><tt:DaylightSavings>{{.DaylightSavings}}</tt:DaylightSavings>{{if .TimeZone}}<tt:TimeZone><tt:TZ>{{.TimeZone}}</tt:TZ></tt:TimeZone>{{end}}<tt:UTCDateTime><tt:Time><tt:Hour>{{.Now.Hour}}</tt:Hour><tt:Minute>{{.Now.Minute}}</tt:Minute><tt:Second>{{.Now.Second}}</tt:Second></tt:Time><tt:Date><tt:Year>{{.Now.Year}}</tt:Year><tt:Month>{{printf "%d" .Now.Month}}</tt:Month><tt:Day>{{.Now.Day}}</tt:Day></tt:Date></tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>{{end}}
+
+{{define "SetNTP"}}<tds:SetNTPResponse></tds:SetNTPResponse>{{end}}
+
+{{define "SetSystemDateAndTime"}}<tds:SetSystemDateAndTimeResponse></tds:SetSystemDateAndTimeResponse>{{end}}
+
+{{define "SetHostname"}}<tds:SetHostnameResponse></tds:SetHostnameResponse>{{end}}
+
+{{define "SystemReboot"}}<tds:SystemRebootResponse><tds:Message>{{escape .Message}}</tds:Message></tds:SystemRebootResponse>{{end}}
+
+{{define "GetSystemLog"}}<tds:GetSystemLogResponse><tds:SystemLog><tt:String>{{escape .Log}}</tt:String></tds:SystemLog></tds:GetSystemLogResponse>{{end}}
+
+{{define "GetHostname"}}<tds:GetHostnameResponse><tds:HostnameInformation><tt:FromDHCP>false</tt:FromDHCP><tt:Name>{{escape .Hostname}}</tt:Name></tds:HostnameInformation></tds:GetHostnameResponse>{{end}}
+
+{{define "GetNetworkInterfaces"}}<tds:GetNetworkInterfacesResponse><tds:NetworkInterfaces token="eth0"><tt:Enabled>true</tt:Enabled><tt:Info><tt:Name>eth0</tt:Name><tt:HwAddress>{{escape .MAC}}</tt:HwAddress><tt:MTU>1500</tt:MTU></tt:Info><tt:IPv4><tt:Enabled>true</tt:Enabled><tt:Config><tt:Manual><tt:Address>{{escape .Address}}</tt:Address><tt:PrefixLength>24</tt:PrefixLength></tt:Manual><tt:DHCP>false</tt:DHCP></tt:Config></tt:IPv4></tds:NetworkInterfaces></tds:GetNetworkInterfacesResponse>{{end}}
+
+{{define "GetCapabilities"}}<tds:GetCapabilitiesResponse><tds:Capabilities><tt:Device><tt:XAddr>{{escape .DeviceXAddr}}</tt:XAddr></tt:Device><tt:Media><tt:XAddr>{{escape .MediaXAddr}}</tt:XAddr><tt:StreamingCapabilities><tt:RTPMulticast>false</tt:RTPMulticast><tt:RTP_TCP>true</tt:RTP_TCP><tt:RTP_RTSP_TCP>true</tt:RTP_RTSP_TCP></tt:StreamingCapabilities></tt:Media><tt:Events><tt:XAddr>{{escape .EventsXAddr}}</tt:XAddr><tt:WSSubscriptionPolicySupport>true</tt:WSSubscriptionPolicySupport><tt:WSPullPointSupport>true</tt:WSPullPointSupport></tt:Events>{{if .ImagingXAddr}}<tt:Imaging><tt:XAddr>{{escape .ImagingXAddr}}</tt:XAddr></tt:Imaging>{{end}}{{if .PTZXAddr}}<tt:PTZ><tt:XAddr>{{escape .PTZXAddr}}</tt:XAddr></tt:PTZ>{{end}}{{if or .DeviceIOXAddr .SearchXAddr}}<tt:Extension>{{if .DeviceIOXAddr}}<tt:DeviceIO><tt:XAddr>{{escape .DeviceIOXAddr}}</tt:XAddr></tt:DeviceIO>{{end}}{{if .SearchXAddr}}<tt:Search><tt:XAddr>{{escape .SearchXAddr}}</tt:XAddr><tt:MetadataSearch>false</tt:MetadataSearch></tt:Search><tt:Replay><tt:XAddr>{{escape .ReplayXAddr}}</tt:XAddr></tt:Replay>{{end}}</tt:Extension>{{end}}</tds:Capabilities></tds:GetCapabilitiesResponse>{{end}}
+
+{{define "GetServices"}}<tds:GetServicesResponse><tds:Service><tds:Namespace>http://www.onvif.org/ver10/device/wsdl</tds:Namespace><tds:XAddr>{{escape .DeviceXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service><tds:Service><tds:Namespace>http://www.onvif.org/ver10/media/wsdl</tds:Namespace><tds:XAddr>{{escape .MediaXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{if .Media2XAddr}}<tds:Service><tds:Namespace>http://www.onvif.org/ver20/media/wsdl</tds:Namespace><tds:XAddr>{{escape .Media2XAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{end}}<tds:Service><tds:Namespace>http://www.onvif.org/ver10/events/wsdl</tds:Namespace><tds:XAddr>{{escape .EventsXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{if .PTZXAddr}}<tds:Service><tds:Namespace>http://www.onvif.org/ver20/ptz/wsdl</tds:Namespace><tds:XAddr>{{escape .PTZXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{end}}{{if .ImagingXAddr}}<tds:Service><tds:Namespace>http://www.onvif.org/ver20/imaging/wsdl</tds:Namespace><tds:XAddr>{{escape .ImagingXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{end}}{{if .SearchXAddr}}<tds:Service><tds:Namespace>http://www.onvif.org/ver10/search/wsdl</tds:Namespace><tds:XAddr>{{escape .SearchXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service><tds:Service><tds:Namespace>http://www.onvif.org/ver10/replay/wsdl</tds:Namespace><tds:XAddr>{{escape .ReplayXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{end}}{{if .DeviceIOXAddr}}<tds:Service><tds:Namespace>http://www.onvif.org/ver10/deviceIO/wsdl</tds:Namespace><tds:XAddr>{{escape .DeviceIOXAddr}}</tds:XAddr><tds:Version><tt:Major>2</tt:Major><tt:Minor>60</tt:Minor></tds:Version></tds:Service>{{end}}</tds:GetServicesResponse>{{end}}
+
+{{define "GetProfiles"}}<trt:GetProfilesResponse>{{range .Profiles}}<trt:Profiles token="{{escape .Token}}" fixed="true"><tt:Name>{{escape .Name}}</tt:Name><tt:VideoSourceConfiguration token="{{escape (sourceConfig .VideoSource)}}"><tt:Name>{{escape (sourceConfig .VideoSource)}}</tt:Name><tt:UseCount>{{len $.Profiles}}</tt:UseCount><tt:SourceToken>{{escape .VideoSource}}</tt:SourceToken><tt:Bounds x="0" y="0" width="{{.Width}}" height="{{.Height}}"></tt:Bounds></tt:VideoSourceConfiguration><tt:VideoEncoderConfiguration token="{{escape .Token}}_VideoEncoder"><tt:Name>{{escape .Name}}</tt:Name><tt:UseCount>1</tt:UseCount><tt:Encoding>{{escape .Encoding}}</tt:Encoding><tt:Resolution><tt:Width>{{.Width}}</tt:Width><tt:Height>{{.Height}}</tt:Height></tt:Resolution><tt:Quality>{{.Quality}}</tt:Quality><tt:RateControl><tt:FrameRateLimit>{{.FrameRate}}</tt:FrameRateLimit><tt:EncodingInterval>1</tt:EncodingInterval><tt:BitrateLimit>{{.Bitrate}}</tt:BitrateLimit></tt:RateControl>{{if eq .Encoding "H264"}}<tt:H264><tt:GovLength>{{.GovLength}}</tt:GovLength><tt:H264Profile>Main</tt:H264Profile></tt:H264>{{end}}</tt:VideoEncoderConfiguration></trt:Profiles>{{end}}</trt:GetProfilesResponse>{{end}}
+
+{{define "Media2GetProfiles"}}<tr2:GetProfilesResponse>{{range .Profiles}}<tr2:Profiles token="{{escape .Token}}" fixed="true"><tr2:Name>{{escape .Name}}</tr2:Name><tr2:Configurations><tr2:VideoSource token="{{escape (sourceConfig .VideoSource)}}"><tt:Name>{{escape (sourceConfig .VideoSource)}}</tt:Name><tt:UseCount>{{len $.Profiles}}</tt:UseCount><tt:SourceToken>{{escape .VideoSource}}</tt:SourceToken><tt:Bounds x="0" y="0" width="{{.Width}}" height="{{.Height}}"></tt:Bounds></tr2:VideoSource><tr2:VideoEncoder token="{{escape .Token}}_VideoEncoder" GovLength="{{.GovLength}}" Profile="Main"><tt:Name>{{escape .Name}}</tt:Name><tt:UseCount>1</tt:UseCount><tt:Encoding>{{escape .Encoding}}</tt:Encoding><tt:Resolution><tt:Width>{{.Width}}</tt:Width><tt:Height>{{.Height}}</tt:Height></tt:Resolution><tt:RateControl ConstantBitRate="false"><tt:FrameRateLimit>{{.FrameRate}}</tt:FrameRateLimit><tt:BitrateLimit>{{.Bitrate}}</tt:BitrateLimit></tt:RateControl><tt:Quality>{{.Quality}}</tt:Quality></tr2:VideoEncoder></tr2:Configurations></tr2:Profiles>{{end}}</tr2:GetProfilesResponse>{{end}}
+
+{{define "GetVideoSources"}}<trt:GetVideoSourcesResponse>{{range .}}<trt:VideoSources token="{{escape .VideoSource}}"><tt:Framerate>{{.FrameRate}}</tt:Framerate><tt:Resolution><tt:Width>{{.Width}}</tt:Width><tt:Height>{{.Height}}</tt:Height></tt:Resolution></trt:VideoSources>{{end}}</trt:GetVideoSourcesResponse>{{end}}
+
+{{define "GetVideoEncoderConfigurations"}}<trt:GetVideoEncoderConfigurationsResponse>{{range .Profiles}}<trt:Configurations token="{{escape .Token}}_VideoEncoder"><tt:Name>{{escape .Name}}</tt:Name><tt:UseCount>1</tt:UseCount><tt:Encoding>{{escape .Encoding}}</tt:Encoding><tt:Resolution><tt:Width>{{.Width}}</tt:Width><tt:Height>{{.Height}}</tt:Height></tt:Resolution><tt:Quality>{{.Quality}}</tt:Quality><tt:RateControl><tt:FrameRateLimit>{{.FrameRate}}</tt:FrameRateLimit><tt:EncodingInterval>1</tt:EncodingInterval><tt:BitrateLimit>{{.Bitrate}}</tt:BitrateLimit></tt:RateControl>{{if eq .Encoding "H264"}}<tt:H264><tt:GovLength>{{.GovLength}}</tt:GovLength><tt:H264Profile>Main</tt:H264Profile></tt:H264>{{end}}<tt:Multicast><tt:Address><tt:Type>IPv4</tt:Type><tt:IPv4Address>0.0.0.0</tt:IPv4Address></tt:Address><tt:Port>0</tt:Port><tt:TTL>1</tt:TTL><tt:AutoStart>false</tt:AutoStart></tt:Multicast><tt:SessionTimeout>PT60S</tt:SessionTimeout></trt:Configurations>{{end}}</trt:GetVideoEncoderConfigurationsResponse>{{end}}
+
+{{define "CodecRanges"}}<tt:FrameRateRange><tt:Min>{{index .FrameRate 0}}</tt:Min><tt:Max>{{index .FrameRate 1}}</tt:Max></tt:FrameRateRange><tt:EncodingIntervalRange><tt:Min>1</tt:Min><tt:Max>1</tt:Max></tt:EncodingIntervalRange>{{end}}
+
+{{define "Resolutions"}}{{range .Resolutions}}<tt:ResolutionsAvailable><tt:Width>{{index . 0}}</tt:Width><tt:Height>{{index . 1}}</tt:Height></tt:ResolutionsAvailable>{{end}}{{end}}
+
+{{define "GetVideoEncoderConfigurationOptions"}}<trt:GetVideoEncoderConfigurationOptionsResponse><trt:Options><tt:QualityRange><tt:Min>{{index .Quality 0}}</tt:Min><tt:Max>{{index .Quality 1}}</tt:Max></tt:QualityRange><tt:JPEG>{{template "Resolutions" .}}{{template "CodecRanges" .}}</tt:JPEG><tt:H264>{{template "Resolutions" .}}<tt:GovLengthRange><tt:Min>{{index .GovLength 0}}</tt:Min><tt:Max>{{index .GovLength 1}}</tt:Max></tt:GovLengthRange>{{template "CodecRanges" .}}<tt:H264ProfilesSupported>Main</tt:H264ProfilesSupported><tt:H264ProfilesSupported>High</tt:H264ProfilesSupported></tt:H264><tt:Extension><tt:JPEG>{{template "Resolutions" .}}{{template "CodecRanges" .}}<tt:BitrateRange><tt:Min>{{index .Bitrate 0}}</tt:Min><tt:Max>{{index .Bitrate 1}}</tt:Max></tt:BitrateRange></tt:JPEG><tt:H264>{{template "Resolutions" .}}<tt:GovLengthRange><tt:Min>{{index .GovLength 0}}</tt:Min><tt:Max>{{index .GovLength 1}}</tt:Max></tt:GovLengthRange>{{template "CodecRanges" .}}<tt:H264ProfilesSupported>Main</tt:H264ProfilesSupported><tt:H264ProfilesSupported>High</tt:H264ProfilesSupported><tt:BitrateRange><tt:Min>{{index .Bitrate 0}}</tt:Min><tt:Max>{{index .Bitrate 1}}</tt:Max></tt:BitrateRange></tt:H264></tt:Extension></trt:Options></trt:GetVideoEncoderConfigurationOptionsResponse>{{end}}
+
+{{define "SetVideoEncoderConfiguration"}}<trt:SetVideoEncoderConfigurationResponse></trt:SetVideoEncoderConfigurationResponse>{{end}}
+{{define "AddVideoEncoderConfiguration"}}<trt:AddVideoEncoderConfigurationResponse></trt:AddVideoEncoderConfigurationResponse>{{end}}
+
+{{define "GetAudioEncoderConfigurations"}}<trt:GetAudioEncoderConfigurationsResponse></trt:GetAudioEncoderConfigurationsResponse>{{end}}
+
+{{define "GetNTP"}}<tds:GetNTPResponse><tds:NTPInformation><tt:FromDHCP>{{.FromDHCP}}</tt:FromDHCP>{{range .Servers}}<tt:NTPManual><tt:Type>DNS</tt:Type><tt:DNSname>{{escape .}}</tt:DNSname></tt:NTPManual>{{end}}</tds:NTPInformation></tds:GetNTPResponse>{{end}}
+
+{{define "Media2GetStreamUri"}}<tr2:GetStreamUriResponse><tr2:Uri>{{escape .URI}}</tr2:Uri></tr2:GetStreamUriResponse>{{end}}
+
+{{define "Media2GetSnapshotUri"}}<tr2:GetSnapshotUriResponse><tr2:Uri>{{escape .URI}}</tr2:Uri></tr2:GetSnapshotUriResponse>{{end}}
+
+{{define "GetStreamUri"}}<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>{{escape .URI}}</tt:Uri><tt:InvalidAfterConnect>{{.InvalidAfterConnect}}</tt:InvalidAfterConnect><tt:InvalidAfterReboot>{{.InvalidAfterReboot}}</tt:InvalidAfterReboot><tt:Timeout>{{.Timeout}}</tt:Timeout></trt:MediaUri></trt:GetStreamUriResponse>{{end}}
+
+{{define "GetSnapshotUri"}}<trt:GetSnapshotUriResponse><trt:MediaUri><tt:Uri>{{escape .URI}}</tt:Uri><tt:InvalidAfterConnect>false</tt:InvalidAfterConnect><tt:InvalidAfterReboot>false</tt:InvalidAfterReboot><tt:Timeout>PT0S</tt:Timeout></trt:MediaUri></trt:GetSnapshotUriResponse>{{end}}
+
+{{define "NotificationMessage"}}<wsnt:NotificationMessage><wsnt:Topic Dialect="http://www.onvif.org/ver10/tev/topicExpression/ConcreteSet">{{escape .Topic}}</wsnt:Topic><wsnt:Message><tt:Message UtcTime="{{escape .Time}}" PropertyOperation="{{escape .Operation}}"><tt:Source>{{range .Source}}<tt:SimpleItem Name="{{escape .Name}}" Value="{{escape .Value}}"/>{{end}}</tt:Source><tt:Data>{{range .Data}}<tt:SimpleItem Name="{{escape .Name}}" Value="{{escape .Value}}"/>{{end}}</tt:Data></tt:Message></wsnt:Message></wsnt:NotificationMessage>{{end}}
+
+{{define "CreatePullPointSubscription"}}<tev:CreatePullPointSubscriptionResponse><tev:SubscriptionReference><wsa:Address>{{escape .Address}}</wsa:Address></tev:SubscriptionReference><wsnt:CurrentTime>{{.Current}}</wsnt:CurrentTime><wsnt:TerminationTime>{{.Termination}}</wsnt:TerminationTime></tev:CreatePullPointSubscriptionResponse>{{end}}
+
+{{define "Subscribe"}}<wsnt:SubscribeResponse><wsnt:SubscriptionReference><wsa:Address>{{escape .Address}}</wsa:Address></wsnt:SubscriptionReference><wsnt:CurrentTime>{{.Current}}</wsnt:CurrentTime><wsnt:TerminationTime>{{.Termination}}</wsnt:TerminationTime></wsnt:SubscribeResponse>{{end}}
+
+{{define "PullMessages"}}<tev:PullMessagesResponse><tev:CurrentTime>{{.Current}}</tev:CurrentTime><tev:TerminationTime>{{.Termination}}</tev:TerminationTime>{{range .Messages}}{{template "NotificationMessage" .}}{{end}}</tev:PullMessagesResponse>{{end}}
+
+{{define "Renew"}}<wsnt:RenewResponse><wsnt:TerminationTime>{{.Termination}}</wsnt:TerminationTime><wsnt:CurrentTime>{{.Current}}</wsnt:CurrentTime></wsnt:RenewResponse>{{end}}
+
+{{define "Unsubscribe"}}<wsnt:UnsubscribeResponse></wsnt:UnsubscribeResponse>{{end}}
+
+{{define "Notify"}}<wsnt:Notify>{{range .Messages}}{{template "NotificationMessage" .}}{{end}}</wsnt:Notify>{{end}}
+
+{{define "PTZVector"}}<tt:PanTilt x="{{.Pan}}" y="{{.Tilt}}" space="http://www.onvif.org/ver10/tptz/PanTiltSpaces/PositionGenericSpace"/><tt:Zoom x="{{.Zoom}}" space="http://www.onvif.org/ver10/tptz/ZoomSpaces/PositionGenericSpace"/>{{end}}
+
+{{define "PTZContinuousMove"}}<tptz:ContinuousMoveResponse></tptz:ContinuousMoveResponse>{{end}}
+
+{{define "PTZAbsoluteMove"}}<tptz:AbsoluteMoveResponse></tptz:AbsoluteMoveResponse>{{end}}
+
+{{define "PTZRelativeMove"}}<tptz:RelativeMoveResponse></tptz:RelativeMoveResponse>{{end}}
+
+{{define "PTZStop"}}<tptz:StopResponse></tptz:StopResponse>{{end}}
+
+{{define "PTZGetStatus"}}<tptz:GetStatusResponse><tptz:PTZStatus><tt:Position>{{template "PTZVector" .Position}}</tt:Position><tt:MoveStatus><tt:PanTilt>{{.Status}}</tt:PanTilt><tt:Zoom>{{.Status}}</tt:Zoom></tt:MoveStatus><tt:UtcTime>{{.Time}}</tt:UtcTime></tptz:PTZStatus></tptz:GetStatusResponse>{{end}}
+
+{{define "PTZGetPresets"}}<tptz:GetPresetsResponse>{{range .Presets}}<tptz:Preset token="{{escape .Token}}"><tt:Name>{{escape .Name}}</tt:Name><tt:PTZPosition>{{template "PTZVector" .Position}}</tt:PTZPosition></tptz:Preset>{{end}}</tptz:GetPresetsResponse>{{end}}
+
+{{define "PTZSetPreset"}}<tptz:SetPresetResponse><tptz:PresetToken>{{escape .Token}}</tptz:PresetToken></tptz:SetPresetResponse>{{end}}
+
+{{define "PTZGotoPreset"}}<tptz:GotoPresetResponse></tptz:GotoPresetResponse>{{end}}
+
+{{define "PTZGotoHomePosition"}}<tptz:GotoHomePositionResponse></tptz:GotoHomePositionResponse>{{end}}
+
+{{define "ImagingGetImagingSettings"}}<timg:GetImagingSettingsResponse><timg:ImagingSettings><tt:Brightness>{{.Brightness}}</tt:Brightness><tt:ColorSaturation>{{.Saturation}}</tt:ColorSaturation><tt:Contrast>{{.Contrast}}</tt:Contrast><tt:Exposure><tt:Mode>{{.ExposureMode}}</tt:Mode><tt:MinExposureTime>10</tt:MinExposureTime><tt:MaxExposureTime>40000</tt:MaxExposureTime><tt:ExposureTime>{{.ExposureTime}}</tt:ExposureTime><tt:Gain>{{.Gain}}</tt:Gain></tt:Exposure><tt:Focus><tt:AutoFocusMode>{{.FocusMode}}</tt:AutoFocusMode></tt:Focus><tt:IrCutFilter>{{.IrCut}}</tt:IrCutFilter><tt:Sharpness>{{.Sharpness}}</tt:Sharpness><tt:WideDynamicRange><tt:Mode>{{.WDRMode}}</tt:Mode><tt:Level>{{.WDRLevel}}</tt:Level></tt:WideDynamicRange></timg:ImagingSettings></timg:GetImagingSettingsResponse>{{end}}
+
+{{define "ImagingSetImagingSettings"}}<timg:SetImagingSettingsResponse></timg:SetImagingSettingsResponse>{{end}}
+
+{{define "ImagingGetOptions"}}<timg:GetOptionsResponse><timg:ImagingOptions><tt:Brightness><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:Brightness><tt:ColorSaturation><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:ColorSaturation><tt:Contrast><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:Contrast><tt:Exposure><tt:Mode>AUTO</tt:Mode><tt:Mode>MANUAL</tt:Mode><tt:ExposureTime><tt:Min>10</tt:Min><tt:Max>40000</tt:Max></tt:ExposureTime><tt:Gain><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:Gain></tt:Exposure><tt:Focus><tt:AutoFocusModes>AUTO</tt:AutoFocusModes><tt:AutoFocusModes>MANUAL</tt:AutoFocusModes></tt:Focus><tt:IrCutFilterModes>ON</tt:IrCutFilterModes><tt:IrCutFilterModes>OFF</tt:IrCutFilterModes><tt:IrCutFilterModes>AUTO</tt:IrCutFilterModes><tt:Sharpness><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:Sharpness><tt:WideDynamicRange><tt:Mode>ON</tt:Mode><tt:Mode>OFF</tt:Mode><tt:Level><tt:Min>0</tt:Min><tt:Max>100</tt:Max></tt:Level></tt:WideDynamicRange></timg:ImagingOptions></timg:GetOptionsResponse>{{end}}
+
+{{define "GetRecordingSummary"}}<tse:GetRecordingSummaryResponse><tse:Summary><tt:DataFrom>{{.From}}</tt:DataFrom><tt:DataUntil>{{.Until}}</tt:DataUntil><tt:NumberRecordings>{{.Count}}</tt:NumberRecordings></tse:Summary></tse:GetRecordingSummaryResponse>{{end}}
+
+{{define "FindRecordings"}}<tse:FindRecordingsResponse><tse:SearchToken>{{escape .Token}}</tse:SearchToken></tse:FindRecordingsResponse>{{end}}
+
+{{define "GetRecordingSearchResults"}}<tse:GetRecordingSearchResultsResponse><tse:ResultList><tt:SearchState>{{.State}}</tt:SearchState>{{range .Recordings}}<tt:RecordingInformation><tt:RecordingToken>{{escape .Token}}</tt:RecordingToken><tt:Source><tt:SourceId>{{escape .Source}}</tt:SourceId><tt:Name>{{escape .Source}}</tt:Name><tt:Location></tt:Location><tt:Description></tt:Description><tt:Address></tt:Address></tt:Source><tt:EarliestRecording>{{.Start}}</tt:EarliestRecording><tt:LatestRecording>{{.End}}</tt:LatestRecording><tt:Content>SD card</tt:Content><tt:Track><tt:TrackToken>VIDEO001</tt:TrackToken><tt:TrackType>Video</tt:TrackType><tt:Description>Video</tt:Description><tt:DataFrom>{{.Start}}</tt:DataFrom><tt:DataTo>{{.End}}</tt:DataTo></tt:Track><tt:RecordingStatus>{{.Status}}</tt:RecordingStatus></tt:RecordingInformation>{{end}}</tse:ResultList></tse:GetRecordingSearchResultsResponse>{{end}}
+
+{{define "EndSearch"}}<tse:EndSearchResponse><tse:Endpoint>{{.Current}}</tse:Endpoint></tse:EndSearchResponse>{{end}}
+
+{{define "GetReplayUri"}}<trp:GetReplayUriResponse><trp:Uri>{{escape .URI}}</trp:Uri></trp:GetReplayUriResponse>{{end}}
+
+{{define "RelayOutputs"}}{{$prefix := .Prefix}}{{range .Relays}}<{{$prefix}}:RelayOutputs token="{{escape .Token}}"><tt:Properties><tt:Mode>{{escape .Mode}}</tt:Mode><tt:DelayTime>{{.Delay}}</tt:DelayTime><tt:IdleState>{{escape .IdleState}}</tt:IdleState></tt:Properties></{{$prefix}}:RelayOutputs>{{end}}{{end}}
+
+{{define "GetRelayOutputs"}}<tds:GetRelayOutputsResponse>{{template "RelayOutputs" .}}</tds:GetRelayOutputsResponse>{{end}}
+
+{{define "SetRelayOutputState"}}<tds:SetRelayOutputStateResponse></tds:SetRelayOutputStateResponse>{{end}}
+
+{{define "DeviceIOGetRelayOutputs"}}<tmd:GetRelayOutputsResponse>{{template "RelayOutputs" .}}</tmd:GetRelayOutputsResponse>{{end}}
+
+{{define "DeviceIOSetRelayOutputState"}}<tmd:SetRelayOutputStateResponse></tmd:SetRelayOutputStateResponse>{{end}}
+
+{{define "DeviceIOGetDigitalInputs"}}<tmd:GetDigitalInputsResponse>{{range .DigitalInputs}}<tmd:DigitalInputs token="{{escape .Token}}" IdleState="{{escape .IdleState}}"/>{{end}}</tmd:GetDigitalInputsResponse>{{end}}
+
+{{define "ImagingMove"}}<timg:MoveResponse></timg:MoveResponse>{{end}}
+
+{{define "ImagingStop"}}<timg:StopResponse></timg:StopResponse>{{end}}
+
+{{define "ImagingGetStatus"}}<timg:GetStatusResponse><timg:Status><tt:FocusStatus20><tt:Position>{{.Position}}</tt:Position><tt:MoveStatus>{{.Status}}</tt:MoveStatus></tt:FocusStatus20></timg:Status></timg:GetStatusResponse>{{end}}
+
+{{define "Fault"}}<s:Fault><s:Code><s:Value>s:{{.Code}}</s:Value><s:Subcode><s:Value>ter:{{.Subcode}}</s:Value></s:Subcode></s:Code><s:Reason><s:Text xml:lang="en">{{escape .Reason}}</s:Text></s:Reason></s:Fault>{{end}}
+`))
+
+// render execute a response template wrapping it in a SOAP envelope
+func render(name string, data interface{}) ([]byte, error) {
+	buf := bytes.NewBufferString(envelopeHeader)
+	if err := templates.ExecuteTemplate(buf, name, data); err != nil {
+		return nil, err
+	}
+	buf.WriteString(envelopeFooter)
+	return buf.Bytes(), nil
+}
+
+func escape(value string) string {
+	buf := bytes.Buffer{}
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
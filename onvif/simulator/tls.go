@@ -0,0 +1,86 @@
+package simulator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+)
+
+// newCertificate generate a self-signed certificate for localhost, as the
+// ones the cameras create on first boot
+func newCertificate(name string) (tls.Certificate, []byte, error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"camd"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// getCertificate serve the current certificate, replaced by RenewCertificate
+func (c *Camera) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.certificate, nil
+}
+
+// CertificatePEM return the PEM encoded certificate of the HTTPS endpoint,
+// nil if TLS is disabled
+func (c *Camera) CertificatePEM() []byte {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.certificatePEM
+}
+
+// RenewCertificate replace the self-signed certificate, as a camera reset to
+// its factory defaults or swapped for another one on the same address
+func (c *Camera) RenewCertificate() error {
+
+	cert, certPEM, err := newCertificate(c.Config().Name)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.certificate = &cert
+	c.certificatePEM = certPEM
+	// drop the kept-alive connections, to handshake with the new certificate
+	if c.server != nil {
+		c.server.SetKeepAlivesEnabled(false)
+		c.server.SetKeepAlivesEnabled(true)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+const defaultSnapshotMaxAge = time.Minute
+
+// LoadSnapshotCache return the cache configured by onvif.snapshot.cache and
+// onvif.snapshot.max_age, nil if caching is disabled
+func LoadSnapshotCache() *SnapshotCache {
+
+	dir := viper.GetViper().GetString("onvif.snapshot.cache")
+	if dir == "" {
+		return nil
+	}
+
+	maxAge := viper.GetViper().GetDuration("onvif.snapshot.max_age")
+	if maxAge <= 0 {
+		maxAge = defaultSnapshotMaxAge
+	}
+
+	return NewSnapshotCache(dir, maxAge)
+}
+
+// NewSnapshotCache init a cache storing the snapshots in dir, considered
+// fresh for maxAge
+func NewSnapshotCache(dir string, maxAge time.Duration) *SnapshotCache {
+	return &SnapshotCache{
+		Dir:    dir,
+		MaxAge: maxAge,
+	}
+}
+
+// SnapshotCache store the fetched snapshots on disk, one JPEG per device profile
+type SnapshotCache struct {
+	Dir    string
+	MaxAge time.Duration
+}
+
+// Path return the file storing the snapshot of a device profile
+func (s *SnapshotCache) Path(uuid, profile string) string {
+	name := strings.TrimPrefix(uuid, "urn:uuid:")
+	if profile != "" {
+		name += "_" + profile
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, name)
+	return filepath.Join(s.Dir, name+".jpg")
+}
+
+// Get return a cached snapshot, if not older than MaxAge
+func (s *SnapshotCache) Get(uuid, profile string) ([]byte, bool) {
+
+	path := s.Path(uuid, profile)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > s.MaxAge {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// Put store a snapshot
+func (s *SnapshotCache) Put(uuid, profile string, data []byte) error {
+
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// write then rename, so readers never see a partial image
+	path := s.Path(uuid, profile)
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// snapshotProfile return the token of a profile, of the primary one if
+// profile is empty, with its snapshot URI if known. The profiles are asked to
+// the device if the primary one is not known yet.
+func snapshotProfile(ctx context.Context, client *Client, dev device.Device, profile string) (string, string, error) {
+
+	if profile != "" {
+		for _, p := range dev.Profiles {
+			if p.Token == profile {
+				return profile, p.SnapshotURI, nil
+			}
+		}
+		return profile, "", nil
+	}
+
+	profiles := dev.Profiles
+	if len(profiles) == 0 {
+		var err error
+		profiles, err = resolveProfiles(ctx, client)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	primary, ok := primaryProfile(profiles, viper.GetViper().GetString("onvif.profile"))
+	if !ok || primary.SnapshotURI == "" {
+		return "", "", errors.New("Snapshot not available")
+	}
+	return primary.Token, primary.SnapshotURI, nil
+}
+
+// snapshotURI ask the device the snapshot URI of a profile
+func snapshotURI(ctx context.Context, client *Client, profile string) (string, error) {
+
+	if client.HasService(ctx, "media2") {
+		if uri, err := media2GetSnapshotURI(ctx, client, profile); err == nil {
+			return uri, nil
+		}
+	}
+
+	return getSnapshotURI(ctx, client, profile)
+}
+
+// FetchSnapshot download the JPEG snapshot of a device profile (the primary
+// one if profile is empty) with the client credentials. If cache is not nil,
+// a fresh cached image is returned and the fetched ones are stored, by
+// profile token.
+func FetchSnapshot(ctx context.Context, client *Client, dev device.Device, profile string, cache *SnapshotCache) ([]byte, error) {
+
+	token, uri, err := snapshotProfile(ctx, client, dev, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		if b, ok := cache.Get(dev.UUID, token); ok {
+			return b, nil
+		}
+	}
+
+	if uri == "" {
+		uri, err = snapshotURI(ctx, client, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, contentType, err := client.Fetch(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("Unexpected snapshot content type %s", contentType)
+	}
+
+	// the snapshot is returned even if it cannot be cached
+	if cache != nil {
+		if err := cache.Put(dev.UUID, token, b); err != nil {
+			log.Printf("Snapshot cache error for %s: %s", dev.Name, err)
+		}
+	}
+
+	return b, nil
+}
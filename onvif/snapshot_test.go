@@ -0,0 +1,78 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchSnapshot(t *testing.T) {
+
+	for _, mode := range []string{simulator.AuthWSSecurity, simulator.AuthDigest} {
+		t.Run(mode, func(t *testing.T) {
+
+			auth := NewAuthenticator([]Credential{{Username: "admin", Password: "secret"}})
+			camera, dev := resolveCamera(t, simulator.Config{
+				Username: "admin",
+				Password: "secret",
+				Auth:     mode,
+			}, auth)
+			defer camera.Stop()
+
+			client, err := Connect(context.Background(), dev, auth)
+			if err != nil {
+				t.Fatalf("Connect failed: %s", err)
+			}
+
+			dir, err := ioutil.TempDir("", "camd-snapshot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			cache := NewSnapshotCache(dir, time.Minute)
+			image, err := FetchSnapshot(context.Background(), client, dev, "Profile_2", cache)
+			if err != nil {
+				t.Fatalf("FetchSnapshot failed: %s", err)
+			}
+
+			config, err := jpeg.DecodeConfig(bytes.NewReader(image))
+			if err != nil {
+				t.Fatalf("Invalid JPEG: %s", err)
+			}
+			assert.Equal(t, 640, config.Width)
+
+			// a cache failing to store returns the snapshot anyway
+			assert.NoError(t, ioutil.WriteFile(dir+"/file", nil, 0644))
+			uncached, err := FetchSnapshot(context.Background(), client, dev, "Profile_2", NewSnapshotCache(dir+"/file/cache", time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, image, uncached)
+
+			// the primary profile is cached by its token
+			primary, err := FetchSnapshot(context.Background(), client, dev, "", cache)
+			assert.NoError(t, err)
+
+			camera.Stop()
+
+			cached, err := FetchSnapshot(context.Background(), client, dev, "Profile_2", cache)
+			if err != nil {
+				t.Fatalf("Cached FetchSnapshot failed: %s", err)
+			}
+			assert.Equal(t, image, cached)
+
+			cached, err = FetchSnapshot(context.Background(), client, dev, dev.Profiles[0].Token, cache)
+			assert.NoError(t, err)
+			assert.Equal(t, primary, cached)
+			files, _ := filepath.Glob(filepath.Join(dir, "*.jpg"))
+			assert.Len(t, files, 2)
+		})
+	}
+}
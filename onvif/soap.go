@@ -0,0 +1,144 @@
+package onvif
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	nsEnvelope     = "http://www.w3.org/2003/05/soap-envelope"
+	nsSecurity     = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	nsUtility      = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	nsSchema       = "http://www.onvif.org/ver10/schema"
+	nsDevice       = "http://www.onvif.org/ver10/device/wsdl"
+	nsMedia        = "http://www.onvif.org/ver10/media/wsdl"
+	passwordDigest = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest"
+	base64Binary   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+)
+
+// requestEnvelope a SOAP request wrapping an operation in its body
+type requestEnvelope struct {
+	XMLName xml.Name       `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  *requestHeader `xml:"http://www.w3.org/2003/05/soap-envelope Header,omitempty"`
+	Body    struct {
+		Operation interface{}
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+}
+
+type requestHeader struct {
+	Action   string `xml:"http://www.w3.org/2005/08/addressing Action,omitempty"`
+	To       string `xml:"http://www.w3.org/2005/08/addressing To,omitempty"`
+	Security *security
+}
+
+// security a WS-Security UsernameToken header
+type security struct {
+	XMLName        xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
+	MustUnderstand string   `xml:"http://www.w3.org/2003/05/soap-envelope mustUnderstand,attr"`
+	UsernameToken  struct {
+		Username string `xml:"Username"`
+		Password struct {
+			Type  string `xml:"Type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Password"`
+		Nonce struct {
+			EncodingType string `xml:"EncodingType,attr"`
+			Value        string `xml:",chardata"`
+		} `xml:"Nonce"`
+		Created string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Created"`
+	} `xml:"UsernameToken"`
+}
+
+// newSecurity create a UsernameToken with a password digest
+// Digest = B64ENCODE( SHA1( Nonce + Created + Password ) )
+func newSecurity(username, password string, now time.Time) (*security, error) {
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	created := now.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	hasher := sha1.New()
+	hasher.Write(nonce)
+	hasher.Write([]byte(created))
+	hasher.Write([]byte(password))
+
+	sec := &security{MustUnderstand: "1"}
+	sec.UsernameToken.Username = username
+	sec.UsernameToken.Password.Type = passwordDigest
+	sec.UsernameToken.Password.Value = base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+	sec.UsernameToken.Nonce.EncodingType = base64Binary
+	sec.UsernameToken.Nonce.Value = base64.StdEncoding.EncodeToString(nonce)
+	sec.UsernameToken.Created = created
+
+	return sec, nil
+}
+
+// faultEnvelope a SOAP response carrying a fault
+type faultEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Fault *struct {
+			Code struct {
+				Value   string `xml:"Value"`
+				Subcode struct {
+					Value   string `xml:"Value"`
+					Subcode struct {
+						Value string `xml:"Value"`
+					} `xml:"Subcode"`
+				} `xml:"Subcode"`
+			} `xml:"Code"`
+			Reason struct {
+				Text string `xml:"Text"`
+			} `xml:"Reason"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// Fault a SOAP fault returned by a device
+type Fault struct {
+	Code    string
+	Subcode string
+	Reason  string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("SOAP fault %s/%s: %s", f.Code, f.Subcode, f.Reason)
+}
+
+// parseFault return the fault in a response, if any
+func parseFault(body []byte) *Fault {
+
+	res := faultEnvelope{}
+	if err := xml.Unmarshal(body, &res); err != nil || res.Body.Fault == nil {
+		return nil
+	}
+
+	fault := res.Body.Fault
+	subcode := fault.Code.Subcode.Value
+	if fault.Code.Subcode.Subcode.Value != "" {
+		subcode = fault.Code.Subcode.Subcode.Value
+	}
+
+	return &Fault{
+		Code:    localName(fault.Code.Value),
+		Subcode: localName(subcode),
+		Reason:  strings.TrimSpace(fault.Reason.Text),
+	}
+}
+
+// localName strip the namespace prefix from a qualified name
+func localName(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, ":"); i > -1 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,44 @@
+package onvif
+
+import (
+	"log"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/registry"
+	"github.com/spf13/viper"
+)
+
+// LoadDeviceStore return the store of the registry configured by onvif.store,
+// nil if disabled
+func LoadDeviceStore() *registry.Store {
+	path := viper.GetViper().GetString("onvif.store")
+	if path == "" {
+		return nil
+	}
+	return registry.NewStore(path)
+}
+
+// storedDevices return the ONVIF devices persisted by the registry of the
+// discover process, excluding the NVR channels bound to their parent
+func storedDevices() []device.Device {
+
+	devices := []device.Device{}
+
+	store := LoadDeviceStore()
+	if store == nil {
+		return devices
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		log.Printf("Device store error: %s", err)
+		return devices
+	}
+
+	for _, entry := range entries {
+		if entry.Source == registry.SourceONVIF && entry.Device.Parent == "" {
+			devices = append(devices, entry.Device)
+		}
+	}
+	return devices
+}
@@ -0,0 +1,386 @@
+package onvif
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/spf13/viper"
+)
+
+// CertificateChangedTopic is the topic of the alert notified when the
+// certificate of a device does not match its pinned fingerprint
+const CertificateChangedTopic = "camd/CertificateChanged"
+
+// PinMismatch the certificate of a device does not match its pin
+type PinMismatch struct {
+	Key         string
+	Pinned      string
+	Fingerprint string
+}
+
+func (e *PinMismatch) Error() string {
+	return fmt.Sprintf("Certificate of %s changed (pinned %s, got %s), unpin the device if expected", e.Key, shortFingerprint(e.Pinned), shortFingerprint(e.Fingerprint))
+}
+
+// IsPinMismatch return the mismatch if err is caused by a certificate change
+func IsPinMismatch(err error) (*PinMismatch, bool) {
+	var mismatch *PinMismatch
+	ok := errors.As(err, &mismatch)
+	return mismatch, ok
+}
+
+func shortFingerprint(fingerprint string) string {
+	if len(fingerprint) > 16 {
+		return fingerprint[:16]
+	}
+	return fingerprint
+}
+
+// Fingerprint return the SHA-256 fingerprint of a certificate, hex encoded
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Pin the fingerprint of a device certificate, trusted on first use
+type Pin struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject,omitempty"`
+	NotAfter    time.Time `json:"notAfter"`
+	FirstSeen   time.Time `json:"firstSeen"`
+}
+
+// NewPinStore init a store persisting the pins in a JSON file, in memory
+// only if path is empty
+func NewPinStore(path string) *PinStore {
+	return &PinStore{path: path}
+}
+
+// PinStore persist the certificate pins of the devices, by UUID or address
+// for the devices without UUID
+type PinStore struct {
+	path string
+	mut  sync.Mutex
+	pins map[string]Pin
+}
+
+// load read the pins once, the lock being held
+func (s *PinStore) load() error {
+
+	if s.pins != nil {
+		return nil
+	}
+	s.pins = map[string]Pin{}
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &s.pins)
+}
+
+func (s *PinStore) save() error {
+
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(s.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// Get return the pin of a device
+func (s *PinStore) Get(key string) (Pin, bool, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if err := s.load(); err != nil {
+		return Pin{}, false, err
+	}
+	pin, ok := s.pins[key]
+	return pin, ok, nil
+}
+
+// Put store the pin of a device, replacing a previous one
+func (s *PinStore) Put(key string, pin Pin) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.pins[key] = pin
+	return s.save()
+}
+
+// Delete drop the pin of a device, pinning its next certificate
+func (s *PinStore) Delete(key string) (bool, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	if _, ok := s.pins[key]; !ok {
+		return false, nil
+	}
+	delete(s.pins, key)
+	return true, s.save()
+}
+
+// PinKey return the key of the pin of a device, its UUID or, without UUID,
+// the host and port of its address
+func PinKey(dev device.Device) string {
+	if dev.UUID != "" {
+		return dev.UUID
+	}
+	if u, err := url.Parse(dev.Address); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return dev.Address
+}
+
+// pinsFile is the default file of the certificate pins, next to onvif.store
+const pinsFile = "pins.json"
+
+// pinsPath return the file storing the certificate pins, onvif.tls.pins or
+// pins.json next to onvif.store, or in the user configuration directory
+// (eg. ~/.config/camd) without store
+func pinsPath() string {
+
+	v := viper.GetViper()
+	if path := v.GetString("onvif.tls.pins"); path != "" {
+		return path
+	}
+	if store := v.GetString("onvif.store"); store != "" {
+		return filepath.Join(filepath.Dir(store), pinsFile)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "camd", pinsFile)
+	}
+	return ""
+}
+
+// LoadTrust read the TLS settings of the HTTPS endpoints from onvif.tls:
+// ca lists PEM files of CAs trusted in addition to the system ones, insecure
+// lists the selectors (see LookupAll) of the devices with self-signed
+// certificates, trusted on first use only, and pins is the file storing the
+// certificate fingerprints (see pinsPath), shared by Discover and the
+// commands so that the pins survive a restart.
+func LoadTrust() (*Trust, error) {
+
+	v := viper.GetViper()
+
+	var roots *x509.CertPool
+	if files := v.GetStringSlice("onvif.tls.ca"); len(files) > 0 {
+		var err error
+		roots, err = loadCertPool(files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewTrust(roots, v.GetStringSlice("onvif.tls.insecure"), NewPinStore(pinsPath())), nil
+}
+
+// loadCertPool return the system CAs with the ones of the PEM files
+func loadCertPool(files []string) (*x509.CertPool, error) {
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("No certificate found in %s", file)
+		}
+	}
+
+	return roots, nil
+}
+
+// NewTrust init the verification of the device certificates against roots
+// (the system CAs if nil), but the devices matching an insecure selector
+func NewTrust(roots *x509.CertPool, insecure []string, pins *PinStore) *Trust {
+	if pins == nil {
+		pins = NewPinStore("")
+	}
+	return &Trust{
+		roots:    roots,
+		insecure: insecure,
+		pins:     pins,
+		alerted:  map[string]string{},
+	}
+}
+
+// Trust verify the certificates of the HTTPS endpoints and pin them on first
+// use. The certificate of an insecure device must match its pin, while a
+// verified one replaces the previous pin. Either way, a change is notified
+// once to OnCertificateChanged.
+type Trust struct {
+	roots    *x509.CertPool
+	insecure []string
+	pins     *PinStore
+	// OnCertificateChanged is called when the certificate of a device does not match its pin
+	OnCertificateChanged func(dev device.Device, mismatch *PinMismatch)
+	mut                  sync.Mutex
+	alerted              map[string]string
+}
+
+// Pins return the certificate pins store
+func (t *Trust) Pins() *PinStore {
+	return t.pins
+}
+
+// Insecure return true if the device certificate is not verified
+func (t *Trust) Insecure(dev device.Device) bool {
+	for _, selector := range t.insecure {
+		if selector == "all" || matchSelector(dev, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSConfig return the TLS configuration to connect to a device
+func (t *Trust) TLSConfig(dev device.Device) *tls.Config {
+
+	insecure := t.Insecure(dev)
+
+	return &tls.Config{
+		// verified by verifyPeerCertificate, to pin the self-signed ones
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return t.verifyPeerCertificate(dev, insecure, rawCerts)
+		},
+	}
+}
+
+func (t *Trust) verifyPeerCertificate(dev device.Device, insecure bool, rawCerts [][]byte) error {
+
+	if len(rawCerts) == 0 {
+		return errors.New("No certificate presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	leaf := certs[0]
+
+	if !insecure {
+		host := dev.Address
+		if u, err := url.Parse(dev.Address); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         t.roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	key := PinKey(dev)
+	fingerprint := Fingerprint(leaf)
+	pin, ok, err := t.pins.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if ok && pin.Fingerprint != fingerprint {
+		t.alert(dev, &PinMismatch{Key: key, Pinned: pin.Fingerprint, Fingerprint: fingerprint})
+		if insecure {
+			return &PinMismatch{Key: key, Pinned: pin.Fingerprint, Fingerprint: fingerprint}
+		}
+	}
+
+	if !ok || pin.Fingerprint != fingerprint {
+		return t.pins.Put(key, Pin{
+			Fingerprint: fingerprint,
+			Subject:     leaf.Subject.String(),
+			NotAfter:    leaf.NotAfter,
+			FirstSeen:   time.Now(),
+		})
+	}
+
+	return nil
+}
+
+// alert notify a certificate change once per fingerprint
+func (t *Trust) alert(dev device.Device, mismatch *PinMismatch) {
+
+	t.mut.Lock()
+	alerted := t.alerted[mismatch.Key] == mismatch.Fingerprint
+	t.alerted[mismatch.Key] = mismatch.Fingerprint
+	callback := t.OnCertificateChanged
+	t.mut.Unlock()
+
+	if !alerted && callback != nil {
+		callback(dev, mismatch)
+	}
+}
+
+// certificateAlert return the notification of a certificate change
+func certificateAlert(dev device.Device, mismatch *PinMismatch) device.Notification {
+
+	host := dev.Address
+	if u, err := url.Parse(dev.Address); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	return device.Notification{
+		Topic:     CertificateChangedTopic,
+		Time:      time.Now(),
+		Operation: "Changed",
+		Source:    map[string]string{"Address": host},
+		Data: map[string]string{
+			"Pinned":      mismatch.Pinned,
+			"Fingerprint": mismatch.Fingerprint,
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package onvif
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/muka/camd/device"
+	"github.com/muka/camd/onvif/simulator"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSPinning(t *testing.T) {
+
+	camera, dev := startCamera(t, simulator.Config{TLS: true})
+	defer camera.Stop()
+	assert.True(t, strings.HasPrefix(dev.Address, "https://"))
+
+	ctx := context.Background()
+	pins := NewPinStore("")
+
+	// self-signed, not trusted unless insecure
+	auth := NewAuthenticator(nil)
+	auth.SetTrust(NewTrust(nil, nil, pins))
+	_, err := Connect(ctx, dev, auth)
+	assert.Error(t, err)
+
+	trust := NewTrust(nil, []string{camera.UUID()}, pins)
+	changes := []*PinMismatch{}
+	trust.OnCertificateChanged = func(dev device.Device, mismatch *PinMismatch) {
+		changes = append(changes, mismatch)
+	}
+	auth.SetTrust(trust)
+
+	_, err = Connect(ctx, dev, auth)
+	if err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+	pin, ok, err := pins.Get(PinKey(dev))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// a new certificate does not match the pin, alerting once
+	assert.NoError(t, camera.RenewCertificate())
+	for i := 0; i < 2; i++ {
+		_, err = Connect(ctx, dev, auth)
+		mismatch, ok := IsPinMismatch(err)
+		if assert.True(t, ok, "expected a pin mismatch, got %v", err) {
+			assert.Equal(t, pin.Fingerprint, mismatch.Pinned)
+		}
+	}
+	assert.Len(t, changes, 1)
+
+	// verified by the camera certificate as CA, replacing the pin
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(camera.CertificatePEM()))
+	auth.SetTrust(NewTrust(roots, nil, pins))
+	_, err = Connect(ctx, dev, auth)
+	assert.NoError(t, err)
+
+	auth.SetTrust(trust)
+	_, err = Connect(ctx, dev, auth)
+	assert.NoError(t, err)
+
+	removed, err := pins.Delete(PinKey(dev))
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	// the pins are persisted by default, next to the device store
+	defer viper.Reset()
+	viper.Set("onvif.store", "/var/lib/camd/devices.json")
+	assert.Equal(t, "/var/lib/camd/pins.json", pinsPath())
+	viper.Set("onvif.tls.pins", "/etc/camd/pins.json")
+	assert.Equal(t, "/etc/camd/pins.json", pinsPath())
+}
@@ -1,6 +1,10 @@
 package onvif
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
 
 // GetStremUriResponse soap message response
 type GetStremUriResponse struct {
@@ -26,3 +30,1242 @@ func (r *GetStremUriResponse) GetURI() string {
 func (r *GetStremUriResponse) GetTimeout() string {
 	return r.Body.GetStreamUriResponse.MediaUri.Timeout
 }
+
+// GetInvalidAfterReboot return if the URI is invalidated by a device reboot
+func (r *GetStremUriResponse) GetInvalidAfterReboot() bool {
+	invalid, _ := strconv.ParseBool(strings.TrimSpace(r.Body.GetStreamUriResponse.MediaUri.InvalidAfterReboot))
+	return invalid
+}
+
+// GetInvalidAfterConnect return if the URI is valid for a single connection
+func (r *GetStremUriResponse) GetInvalidAfterConnect() bool {
+	invalid, _ := strconv.ParseBool(strings.TrimSpace(r.Body.GetStreamUriResponse.MediaUri.InvalidAfterConnect))
+	return invalid
+}
+
+// GetDeviceInformation request the device information
+type GetDeviceInformation struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetDeviceInformation"`
+}
+
+// GetDeviceInformationResponse soap message response
+type GetDeviceInformationResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetDeviceInformationResponse struct {
+			Manufacturer    string `xml:"Manufacturer"`
+			Model           string `xml:"Model"`
+			FirmwareVersion string `xml:"FirmwareVersion"`
+			SerialNumber    string `xml:"SerialNumber"`
+			HardwareID      string `xml:"HardwareId"`
+		} `xml:"GetDeviceInformationResponse"`
+	} `xml:"Body"`
+}
+
+// GetCapabilities request the device capabilities
+type GetCapabilities struct {
+	XMLName  xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetCapabilities"`
+	Category string   `xml:"Category"`
+}
+
+// capabilityXAddr a capability section, exposing the service address
+type capabilityXAddr struct {
+	XAddr string `xml:"XAddr"`
+}
+
+// GetCapabilitiesResponse soap message response
+type GetCapabilitiesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetCapabilitiesResponse struct {
+			Capabilities struct {
+				Analytics capabilityXAddr `xml:"Analytics"`
+				Device    capabilityXAddr `xml:"Device"`
+				Events    capabilityXAddr `xml:"Events"`
+				Imaging   capabilityXAddr `xml:"Imaging"`
+				Media     capabilityXAddr `xml:"Media"`
+				PTZ       capabilityXAddr `xml:"PTZ"`
+				Extension struct {
+					DeviceIO  capabilityXAddr `xml:"DeviceIO"`
+					Recording capabilityXAddr `xml:"Recording"`
+					Search    capabilityXAddr `xml:"Search"`
+					Replay    capabilityXAddr `xml:"Replay"`
+				} `xml:"Extension"`
+			} `xml:"Capabilities"`
+		} `xml:"GetCapabilitiesResponse"`
+	} `xml:"Body"`
+}
+
+// StreamSetup the stream type and transport of a stream URI
+type StreamSetup struct {
+	Stream    string `xml:"http://www.onvif.org/ver10/schema Stream"`
+	Transport struct {
+		Protocol string `xml:"http://www.onvif.org/ver10/schema Protocol"`
+	} `xml:"http://www.onvif.org/ver10/schema Transport"`
+}
+
+// GetStreamUri request the stream URI of a profile
+type GetStreamUri struct {
+	XMLName      xml.Name    `xml:"http://www.onvif.org/ver10/media/wsdl GetStreamUri"`
+	StreamSetup  StreamSetup `xml:"StreamSetup"`
+	ProfileToken string      `xml:"ProfileToken"`
+}
+
+// GetProfiles request the media profiles
+type GetProfiles struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetProfiles"`
+}
+
+// Profile a media profile, as returned by GetProfiles
+type Profile struct {
+	Token                    string `xml:"token,attr"`
+	Name                     string `xml:"Name"`
+	VideoSourceConfiguration *struct {
+		Token       string `xml:"token,attr"`
+		SourceToken string `xml:"SourceToken"`
+	} `xml:"VideoSourceConfiguration"`
+	VideoEncoderConfiguration *struct {
+		Token      string `xml:"token,attr"`
+		Encoding   string `xml:"Encoding"`
+		Resolution struct {
+			Width  int `xml:"Width"`
+			Height int `xml:"Height"`
+		} `xml:"Resolution"`
+		RateControl struct {
+			FrameRateLimit float64 `xml:"FrameRateLimit"`
+			BitrateLimit   int     `xml:"BitrateLimit"`
+		} `xml:"RateControl"`
+	} `xml:"VideoEncoderConfiguration"`
+	AudioEncoderConfiguration *struct {
+		Token      string `xml:"token,attr"`
+		Encoding   string `xml:"Encoding"`
+		Bitrate    int    `xml:"Bitrate"`
+		SampleRate int    `xml:"SampleRate"`
+	} `xml:"AudioEncoderConfiguration"`
+}
+
+// GetProfilesResponse soap message response
+type GetProfilesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetProfilesResponse struct {
+			Profiles []Profile `xml:"Profiles"`
+		} `xml:"GetProfilesResponse"`
+	} `xml:"Body"`
+}
+
+// GetServices request the services of the device
+type GetServices struct {
+	XMLName           xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetServices"`
+	IncludeCapability bool     `xml:"IncludeCapability"`
+}
+
+// GetServicesResponse soap message response
+type GetServicesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetServicesResponse struct {
+			Service []struct {
+				Namespace string `xml:"Namespace"`
+				XAddr     string `xml:"XAddr"`
+				Version   struct {
+					Major int `xml:"Major"`
+					Minor int `xml:"Minor"`
+				} `xml:"Version"`
+			} `xml:"Service"`
+		} `xml:"GetServicesResponse"`
+	} `xml:"Body"`
+}
+
+// Media2GetProfiles request the media profiles from the Media2 service
+type Media2GetProfiles struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver20/media/wsdl GetProfiles"`
+	Type    []string `xml:"Type"`
+}
+
+// Media2GetProfilesResponse soap message response
+type Media2GetProfilesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetProfilesResponse struct {
+			Profiles []struct {
+				Token          string `xml:"token,attr"`
+				Name           string `xml:"Name"`
+				Configurations struct {
+					VideoSource *struct {
+						Token       string `xml:"token,attr"`
+						SourceToken string `xml:"SourceToken"`
+					} `xml:"VideoSource"`
+					VideoEncoder *struct {
+						Token      string `xml:"token,attr"`
+						Encoding   string `xml:"Encoding"`
+						Resolution struct {
+							Width  int `xml:"Width"`
+							Height int `xml:"Height"`
+						} `xml:"Resolution"`
+						RateControl struct {
+							FrameRateLimit float64 `xml:"FrameRateLimit"`
+							BitrateLimit   int     `xml:"BitrateLimit"`
+						} `xml:"RateControl"`
+					} `xml:"VideoEncoder"`
+					AudioEncoder *struct {
+						Token      string `xml:"token,attr"`
+						Encoding   string `xml:"Encoding"`
+						Bitrate    int    `xml:"Bitrate"`
+						SampleRate int    `xml:"SampleRate"`
+					} `xml:"AudioEncoder"`
+				} `xml:"Configurations"`
+			} `xml:"Profiles"`
+		} `xml:"GetProfilesResponse"`
+	} `xml:"Body"`
+}
+
+// Media2GetStreamUri request the stream URI of a profile from the Media2 service
+type Media2GetStreamUri struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/media/wsdl GetStreamUri"`
+	Protocol     string   `xml:"Protocol"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+// Media2GetStreamUriResponse soap message response
+type Media2GetStreamUriResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetStreamUriResponse struct {
+			URI string `xml:"Uri"`
+		} `xml:"GetStreamUriResponse"`
+	} `xml:"Body"`
+}
+
+// GetSnapshotUri request the snapshot URI of a profile
+type GetSnapshotUri struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetSnapshotUri"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+// GetSnapshotUriResponse soap message response
+type GetSnapshotUriResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetSnapshotUriResponse struct {
+			MediaUri struct {
+				URI string `xml:"Uri"`
+			} `xml:"MediaUri"`
+		} `xml:"GetSnapshotUriResponse"`
+	} `xml:"Body"`
+}
+
+// Media2GetSnapshotUri request the snapshot URI of a profile from the Media2 service
+type Media2GetSnapshotUri struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/media/wsdl GetSnapshotUri"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+// Media2GetSnapshotUriResponse soap message response
+type Media2GetSnapshotUriResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetSnapshotUriResponse struct {
+			URI string `xml:"Uri"`
+		} `xml:"GetSnapshotUriResponse"`
+	} `xml:"Body"`
+}
+
+// GetHostname request the device hostname
+type GetHostname struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetHostname"`
+}
+
+// GetHostnameResponse soap message response
+type GetHostnameResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetHostnameResponse struct {
+			HostnameInformation struct {
+				FromDHCP bool   `xml:"FromDHCP"`
+				Name     string `xml:"Name"`
+			} `xml:"HostnameInformation"`
+		} `xml:"GetHostnameResponse"`
+	} `xml:"Body"`
+}
+
+// GetNetworkInterfaces request the device network interfaces
+type GetNetworkInterfaces struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNetworkInterfaces"`
+}
+
+// NetworkInterface a device network interface
+type NetworkInterface struct {
+	Token   string `xml:"token,attr"`
+	Enabled bool   `xml:"Enabled"`
+	Info    struct {
+		Name      string `xml:"Name"`
+		HwAddress string `xml:"HwAddress"`
+		MTU       int    `xml:"MTU"`
+	} `xml:"Info"`
+	IPv4 struct {
+		Enabled bool `xml:"Enabled"`
+		Config  struct {
+			Manual []struct {
+				Address string `xml:"Address"`
+			} `xml:"Manual"`
+			FromDHCP struct {
+				Address string `xml:"Address"`
+			} `xml:"FromDHCP"`
+			DHCP bool `xml:"DHCP"`
+		} `xml:"Config"`
+	} `xml:"IPv4"`
+}
+
+// Addresses return the configured IPv4 addresses
+func (n NetworkInterface) Addresses() []string {
+	addrs := []string{}
+	for _, manual := range n.IPv4.Config.Manual {
+		addrs = append(addrs, manual.Address)
+	}
+	if n.IPv4.Config.FromDHCP.Address != "" {
+		addrs = append(addrs, n.IPv4.Config.FromDHCP.Address)
+	}
+	return addrs
+}
+
+// GetNetworkInterfacesResponse soap message response
+type GetNetworkInterfacesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetNetworkInterfacesResponse struct {
+			NetworkInterfaces []NetworkInterface `xml:"NetworkInterfaces"`
+		} `xml:"GetNetworkInterfacesResponse"`
+	} `xml:"Body"`
+}
+
+// GetSystemDateAndTime request the device clock, allowed without authentication
+type GetSystemDateAndTime struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetSystemDateAndTime"`
+}
+
+// DateTime an ONVIF date and time
+type DateTime struct {
+	Time struct {
+		Hour   int `xml:"Hour"`
+		Minute int `xml:"Minute"`
+		Second int `xml:"Second"`
+	} `xml:"Time"`
+	Date struct {
+		Year  int `xml:"Year"`
+		Month int `xml:"Month"`
+		Day   int `xml:"Day"`
+	} `xml:"Date"`
+}
+
+// GetSystemDateAndTimeResponse soap message response
+type GetSystemDateAndTimeResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetSystemDateAndTimeResponse struct {
+			SystemDateAndTime struct {
+				DateTimeType    string `xml:"DateTimeType"`
+				DaylightSavings bool   `xml:"DaylightSavings"`
+				TimeZone        struct {
+					TZ string `xml:"TZ"`
+				} `xml:"TimeZone"`
+				UTCDateTime   *DateTime `xml:"UTCDateTime"`
+				LocalDateTime *DateTime `xml:"LocalDateTime"`
+			} `xml:"SystemDateAndTime"`
+		} `xml:"GetSystemDateAndTimeResponse"`
+	} `xml:"Body"`
+}
+
+// CreatePullPointSubscription request a pull point subscription to the device events
+type CreatePullPointSubscription struct {
+	XMLName                xml.Name `xml:"http://www.onvif.org/ver10/events/wsdl CreatePullPointSubscription"`
+	InitialTerminationTime string   `xml:"InitialTerminationTime,omitempty"`
+}
+
+// CreatePullPointSubscriptionResponse soap message response
+type CreatePullPointSubscriptionResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		CreatePullPointSubscriptionResponse struct {
+			SubscriptionReference struct {
+				Address string `xml:"Address"`
+			} `xml:"SubscriptionReference"`
+			CurrentTime     string `xml:"CurrentTime"`
+			TerminationTime string `xml:"TerminationTime"`
+		} `xml:"CreatePullPointSubscriptionResponse"`
+	} `xml:"Body"`
+}
+
+// Subscribe request a WS-BaseNotification subscription, notifications being
+// sent to the consumer address
+type Subscribe struct {
+	XMLName           xml.Name `xml:"http://docs.oasis-open.org/wsn/b-2 Subscribe"`
+	ConsumerReference struct {
+		Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+	} `xml:"ConsumerReference"`
+	InitialTerminationTime string `xml:"InitialTerminationTime,omitempty"`
+}
+
+// SubscribeResponse soap message response
+type SubscribeResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		SubscribeResponse struct {
+			SubscriptionReference struct {
+				Address string `xml:"Address"`
+			} `xml:"SubscriptionReference"`
+			CurrentTime     string `xml:"CurrentTime"`
+			TerminationTime string `xml:"TerminationTime"`
+		} `xml:"SubscribeResponse"`
+	} `xml:"Body"`
+}
+
+// PullMessages request the pending notifications of a pull point
+type PullMessages struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver10/events/wsdl PullMessages"`
+	Timeout      string   `xml:"Timeout"`
+	MessageLimit int      `xml:"MessageLimit"`
+}
+
+// SimpleItem a name and value pair of a notification message
+type SimpleItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+// NotificationMessage a WS-BaseNotification message carrying an ONVIF event
+type NotificationMessage struct {
+	Topic struct {
+		Dialect string `xml:"Dialect,attr"`
+		Value   string `xml:",chardata"`
+	} `xml:"Topic"`
+	Message struct {
+		Message struct {
+			UtcTime           string `xml:"UtcTime,attr"`
+			PropertyOperation string `xml:"PropertyOperation,attr"`
+			Source            struct {
+				SimpleItem []SimpleItem `xml:"SimpleItem"`
+			} `xml:"Source"`
+			Key struct {
+				SimpleItem []SimpleItem `xml:"SimpleItem"`
+			} `xml:"Key"`
+			Data struct {
+				SimpleItem []SimpleItem `xml:"SimpleItem"`
+			} `xml:"Data"`
+		} `xml:"Message"`
+	} `xml:"Message"`
+}
+
+// PullMessagesResponse soap message response
+type PullMessagesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullMessagesResponse struct {
+			CurrentTime         string                `xml:"CurrentTime"`
+			TerminationTime     string                `xml:"TerminationTime"`
+			NotificationMessage []NotificationMessage `xml:"NotificationMessage"`
+		} `xml:"PullMessagesResponse"`
+	} `xml:"Body"`
+}
+
+// Notify the notifications sent by a device to a consumer
+type Notify struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Notify struct {
+			NotificationMessage []NotificationMessage `xml:"NotificationMessage"`
+		} `xml:"Notify"`
+	} `xml:"Body"`
+}
+
+// Renew extend a subscription
+type Renew struct {
+	XMLName         xml.Name `xml:"http://docs.oasis-open.org/wsn/b-2 Renew"`
+	TerminationTime string   `xml:"TerminationTime"`
+}
+
+// RenewResponse soap message response
+type RenewResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		RenewResponse struct {
+			TerminationTime string `xml:"TerminationTime"`
+			CurrentTime     string `xml:"CurrentTime"`
+		} `xml:"RenewResponse"`
+	} `xml:"Body"`
+}
+
+// Unsubscribe terminate a subscription
+type Unsubscribe struct {
+	XMLName xml.Name `xml:"http://docs.oasis-open.org/wsn/b-2 Unsubscribe"`
+}
+
+// Vector2D a pan and tilt value
+type Vector2D struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+// Vector1D a zoom value
+type Vector1D struct {
+	X float64 `xml:"x,attr"`
+}
+
+// PTZVector a pan, tilt and zoom position, translation or speed
+type PTZVector struct {
+	PanTilt *Vector2D `xml:"http://www.onvif.org/ver10/schema PanTilt,omitempty"`
+	Zoom    *Vector1D `xml:"http://www.onvif.org/ver10/schema Zoom,omitempty"`
+}
+
+// ContinuousMove start moving at the given velocity, until Stop or the timeout
+type ContinuousMove struct {
+	XMLName      xml.Name  `xml:"http://www.onvif.org/ver20/ptz/wsdl ContinuousMove"`
+	ProfileToken string    `xml:"ProfileToken"`
+	Velocity     PTZVector `xml:"Velocity"`
+	Timeout      string    `xml:"Timeout,omitempty"`
+}
+
+// AbsoluteMove move to a position
+type AbsoluteMove struct {
+	XMLName      xml.Name   `xml:"http://www.onvif.org/ver20/ptz/wsdl AbsoluteMove"`
+	ProfileToken string     `xml:"ProfileToken"`
+	Position     PTZVector  `xml:"Position"`
+	Speed        *PTZVector `xml:"Speed,omitempty"`
+}
+
+// RelativeMove move by a translation from the current position
+type RelativeMove struct {
+	XMLName      xml.Name   `xml:"http://www.onvif.org/ver20/ptz/wsdl RelativeMove"`
+	ProfileToken string     `xml:"ProfileToken"`
+	Translation  PTZVector  `xml:"Translation"`
+	Speed        *PTZVector `xml:"Speed,omitempty"`
+}
+
+// Stop stop the pan, tilt and zoom movements
+type Stop struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/ptz/wsdl Stop"`
+	ProfileToken string   `xml:"ProfileToken"`
+	PanTilt      bool     `xml:"PanTilt"`
+	Zoom         bool     `xml:"Zoom"`
+}
+
+// GetPresets request the PTZ presets of a profile
+type GetPresets struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/ptz/wsdl GetPresets"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+// GetPresetsResponse soap message response
+type GetPresetsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetPresetsResponse struct {
+			Preset []struct {
+				Token       string     `xml:"token,attr"`
+				Name        string     `xml:"Name"`
+				PTZPosition *PTZVector `xml:"PTZPosition"`
+			} `xml:"Preset"`
+		} `xml:"GetPresetsResponse"`
+	} `xml:"Body"`
+}
+
+// GotoPreset move to a preset
+type GotoPreset struct {
+	XMLName      xml.Name   `xml:"http://www.onvif.org/ver20/ptz/wsdl GotoPreset"`
+	ProfileToken string     `xml:"ProfileToken"`
+	PresetToken  string     `xml:"PresetToken"`
+	Speed        *PTZVector `xml:"Speed,omitempty"`
+}
+
+// SetPreset store the current position as a preset, replacing PresetToken if set
+type SetPreset struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/ptz/wsdl SetPreset"`
+	ProfileToken string   `xml:"ProfileToken"`
+	PresetName   string   `xml:"PresetName,omitempty"`
+	PresetToken  string   `xml:"PresetToken,omitempty"`
+}
+
+// SetPresetResponse soap message response
+type SetPresetResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		SetPresetResponse struct {
+			PresetToken string `xml:"PresetToken"`
+		} `xml:"SetPresetResponse"`
+	} `xml:"Body"`
+}
+
+// GotoHomePosition move to the home position
+type GotoHomePosition struct {
+	XMLName      xml.Name   `xml:"http://www.onvif.org/ver20/ptz/wsdl GotoHomePosition"`
+	ProfileToken string     `xml:"ProfileToken"`
+	Speed        *PTZVector `xml:"Speed,omitempty"`
+}
+
+// PTZGetStatus request the PTZ position and move status of a profile
+type PTZGetStatus struct {
+	XMLName      xml.Name `xml:"http://www.onvif.org/ver20/ptz/wsdl GetStatus"`
+	ProfileToken string   `xml:"ProfileToken"`
+}
+
+// PTZGetStatusResponse soap message response
+type PTZGetStatusResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetStatusResponse struct {
+			PTZStatus struct {
+				Position   PTZVector `xml:"Position"`
+				MoveStatus struct {
+					PanTilt string `xml:"PanTilt"`
+					Zoom    string `xml:"Zoom"`
+				} `xml:"MoveStatus"`
+			} `xml:"PTZStatus"`
+		} `xml:"GetStatusResponse"`
+	} `xml:"Body"`
+}
+
+// Exposure the exposure settings, times in microseconds and gain and iris in dB
+type Exposure struct {
+	Mode            string   `xml:"http://www.onvif.org/ver10/schema Mode" json:"mode"`
+	Priority        string   `xml:"http://www.onvif.org/ver10/schema Priority,omitempty" json:"priority,omitempty"`
+	MinExposureTime *float64 `xml:"http://www.onvif.org/ver10/schema MinExposureTime,omitempty" json:"minExposureTime,omitempty"`
+	MaxExposureTime *float64 `xml:"http://www.onvif.org/ver10/schema MaxExposureTime,omitempty" json:"maxExposureTime,omitempty"`
+	MinGain         *float64 `xml:"http://www.onvif.org/ver10/schema MinGain,omitempty" json:"minGain,omitempty"`
+	MaxGain         *float64 `xml:"http://www.onvif.org/ver10/schema MaxGain,omitempty" json:"maxGain,omitempty"`
+	MinIris         *float64 `xml:"http://www.onvif.org/ver10/schema MinIris,omitempty" json:"minIris,omitempty"`
+	MaxIris         *float64 `xml:"http://www.onvif.org/ver10/schema MaxIris,omitempty" json:"maxIris,omitempty"`
+	ExposureTime    *float64 `xml:"http://www.onvif.org/ver10/schema ExposureTime,omitempty" json:"exposureTime,omitempty"`
+	Gain            *float64 `xml:"http://www.onvif.org/ver10/schema Gain,omitempty" json:"gain,omitempty"`
+	Iris            *float64 `xml:"http://www.onvif.org/ver10/schema Iris,omitempty" json:"iris,omitempty"`
+}
+
+// FocusConfiguration the focus settings
+type FocusConfiguration struct {
+	AutoFocusMode string   `xml:"http://www.onvif.org/ver10/schema AutoFocusMode" json:"mode"`
+	DefaultSpeed  *float64 `xml:"http://www.onvif.org/ver10/schema DefaultSpeed,omitempty" json:"defaultSpeed,omitempty"`
+	NearLimit     *float64 `xml:"http://www.onvif.org/ver10/schema NearLimit,omitempty" json:"nearLimit,omitempty"`
+	FarLimit      *float64 `xml:"http://www.onvif.org/ver10/schema FarLimit,omitempty" json:"farLimit,omitempty"`
+}
+
+// WideDynamicRange the WDR settings
+type WideDynamicRange struct {
+	Mode  string   `xml:"http://www.onvif.org/ver10/schema Mode" json:"mode"`
+	Level *float64 `xml:"http://www.onvif.org/ver10/schema Level,omitempty" json:"level,omitempty"`
+}
+
+// ImagingSettings the image settings of a video source. Nil fields are not
+// supported by the device, or left unchanged by SetImagingSettings.
+type ImagingSettings struct {
+	Brightness       *float64            `xml:"http://www.onvif.org/ver10/schema Brightness,omitempty" json:"brightness,omitempty"`
+	ColorSaturation  *float64            `xml:"http://www.onvif.org/ver10/schema ColorSaturation,omitempty" json:"saturation,omitempty"`
+	Contrast         *float64            `xml:"http://www.onvif.org/ver10/schema Contrast,omitempty" json:"contrast,omitempty"`
+	Exposure         *Exposure           `xml:"http://www.onvif.org/ver10/schema Exposure,omitempty" json:"exposure,omitempty"`
+	Focus            *FocusConfiguration `xml:"http://www.onvif.org/ver10/schema Focus,omitempty" json:"focus,omitempty"`
+	IrCutFilter      *string             `xml:"http://www.onvif.org/ver10/schema IrCutFilter,omitempty" json:"ircut,omitempty"`
+	Sharpness        *float64            `xml:"http://www.onvif.org/ver10/schema Sharpness,omitempty" json:"sharpness,omitempty"`
+	WideDynamicRange *WideDynamicRange   `xml:"http://www.onvif.org/ver10/schema WideDynamicRange,omitempty" json:"wdr,omitempty"`
+}
+
+// GetImagingSettings request the image settings of a video source
+type GetImagingSettings struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver20/imaging/wsdl GetImagingSettings"`
+	VideoSourceToken string   `xml:"VideoSourceToken"`
+}
+
+// GetImagingSettingsResponse soap message response
+type GetImagingSettingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetImagingSettingsResponse struct {
+			ImagingSettings ImagingSettings `xml:"ImagingSettings"`
+		} `xml:"GetImagingSettingsResponse"`
+	} `xml:"Body"`
+}
+
+// SetImagingSettings change the image settings of a video source
+type SetImagingSettings struct {
+	XMLName          xml.Name        `xml:"http://www.onvif.org/ver20/imaging/wsdl SetImagingSettings"`
+	VideoSourceToken string          `xml:"VideoSourceToken"`
+	ImagingSettings  ImagingSettings `xml:"ImagingSettings"`
+	ForcePersistence bool            `xml:"ForcePersistence"`
+}
+
+// FloatRange the allowed range of a setting
+type FloatRange struct {
+	Min float64 `xml:"Min" json:"min"`
+	Max float64 `xml:"Max" json:"max"`
+}
+
+// ImagingOptions the allowed image settings of a video source, nil ranges
+// are not supported
+type ImagingOptions struct {
+	Brightness      *FloatRange `xml:"Brightness" json:"brightness,omitempty"`
+	ColorSaturation *FloatRange `xml:"ColorSaturation" json:"saturation,omitempty"`
+	Contrast        *FloatRange `xml:"Contrast" json:"contrast,omitempty"`
+	Exposure        *struct {
+		Mode         []string    `xml:"Mode" json:"mode"`
+		ExposureTime *FloatRange `xml:"ExposureTime" json:"exposureTime,omitempty"`
+		Gain         *FloatRange `xml:"Gain" json:"gain,omitempty"`
+		Iris         *FloatRange `xml:"Iris" json:"iris,omitempty"`
+	} `xml:"Exposure" json:"exposure,omitempty"`
+	Focus *struct {
+		AutoFocusModes []string    `xml:"AutoFocusModes" json:"mode"`
+		DefaultSpeed   *FloatRange `xml:"DefaultSpeed" json:"defaultSpeed,omitempty"`
+		NearLimit      *FloatRange `xml:"NearLimit" json:"nearLimit,omitempty"`
+		FarLimit       *FloatRange `xml:"FarLimit" json:"farLimit,omitempty"`
+	} `xml:"Focus" json:"focus,omitempty"`
+	IrCutFilterModes []string    `xml:"IrCutFilterModes" json:"ircut,omitempty"`
+	Sharpness        *FloatRange `xml:"Sharpness" json:"sharpness,omitempty"`
+	WideDynamicRange *struct {
+		Mode  []string    `xml:"Mode" json:"mode"`
+		Level *FloatRange `xml:"Level" json:"level,omitempty"`
+	} `xml:"WideDynamicRange" json:"wdr,omitempty"`
+}
+
+// ImagingGetOptions request the allowed image settings of a video source
+type ImagingGetOptions struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver20/imaging/wsdl GetOptions"`
+	VideoSourceToken string   `xml:"VideoSourceToken"`
+}
+
+// ImagingGetOptionsResponse soap message response
+type ImagingGetOptionsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetOptionsResponse struct {
+			ImagingOptions ImagingOptions `xml:"ImagingOptions"`
+		} `xml:"GetOptionsResponse"`
+	} `xml:"Body"`
+}
+
+// AbsoluteFocus move the focus to a position
+type AbsoluteFocus struct {
+	Position float64  `xml:"http://www.onvif.org/ver10/schema Position"`
+	Speed    *float64 `xml:"http://www.onvif.org/ver10/schema Speed,omitempty"`
+}
+
+// RelativeFocus move the focus by a distance
+type RelativeFocus struct {
+	Distance float64  `xml:"http://www.onvif.org/ver10/schema Distance"`
+	Speed    *float64 `xml:"http://www.onvif.org/ver10/schema Speed,omitempty"`
+}
+
+// ContinuousFocus move the focus at a speed, until stopped
+type ContinuousFocus struct {
+	Speed float64 `xml:"http://www.onvif.org/ver10/schema Speed"`
+}
+
+// FocusMove a focus move, only one of the modes being set
+type FocusMove struct {
+	Absolute   *AbsoluteFocus   `xml:"http://www.onvif.org/ver10/schema Absolute,omitempty"`
+	Relative   *RelativeFocus   `xml:"http://www.onvif.org/ver10/schema Relative,omitempty"`
+	Continuous *ContinuousFocus `xml:"http://www.onvif.org/ver10/schema Continuous,omitempty"`
+}
+
+// ImagingMove move the focus of a video source
+type ImagingMove struct {
+	XMLName          xml.Name  `xml:"http://www.onvif.org/ver20/imaging/wsdl Move"`
+	VideoSourceToken string    `xml:"VideoSourceToken"`
+	Focus            FocusMove `xml:"Focus"`
+}
+
+// ImagingStop stop the focus move of a video source
+type ImagingStop struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver20/imaging/wsdl Stop"`
+	VideoSourceToken string   `xml:"VideoSourceToken"`
+}
+
+// ImagingGetStatus request the focus status of a video source
+type ImagingGetStatus struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver20/imaging/wsdl GetStatus"`
+	VideoSourceToken string   `xml:"VideoSourceToken"`
+}
+
+// ImagingGetStatusResponse soap message response
+type ImagingGetStatusResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetStatusResponse struct {
+			Status struct {
+				FocusStatus20 struct {
+					Position   float64 `xml:"Position"`
+					MoveStatus string  `xml:"MoveStatus"`
+					Error      string  `xml:"Error"`
+				} `xml:"FocusStatus20"`
+			} `xml:"Status"`
+		} `xml:"GetStatusResponse"`
+	} `xml:"Body"`
+}
+
+// NetworkHost an NTP server, by IP address or DNS name
+type NetworkHost struct {
+	Type        string `xml:"http://www.onvif.org/ver10/schema Type" json:"type"`
+	IPv4Address string `xml:"http://www.onvif.org/ver10/schema IPv4Address,omitempty" json:"ipv4Address,omitempty"`
+	IPv6Address string `xml:"http://www.onvif.org/ver10/schema IPv6Address,omitempty" json:"ipv6Address,omitempty"`
+	DNSname     string `xml:"http://www.onvif.org/ver10/schema DNSname,omitempty" json:"dnsName,omitempty"`
+}
+
+// Address return the IP address or DNS name of the host
+func (h NetworkHost) Address() string {
+	switch {
+	case h.DNSname != "":
+		return h.DNSname
+	case h.IPv6Address != "":
+		return h.IPv6Address
+	}
+	return h.IPv4Address
+}
+
+// SetNTP set the NTP servers, or use the ones provided by DHCP
+type SetNTP struct {
+	XMLName   xml.Name      `xml:"http://www.onvif.org/ver10/device/wsdl SetNTP"`
+	FromDHCP  bool          `xml:"FromDHCP"`
+	NTPManual []NetworkHost `xml:"NTPManual,omitempty"`
+}
+
+// SetDateTime a date and time in the schema namespace, as required by SetSystemDateAndTime
+type SetDateTime struct {
+	Time struct {
+		Hour   int `xml:"http://www.onvif.org/ver10/schema Hour"`
+		Minute int `xml:"http://www.onvif.org/ver10/schema Minute"`
+		Second int `xml:"http://www.onvif.org/ver10/schema Second"`
+	} `xml:"http://www.onvif.org/ver10/schema Time"`
+	Date struct {
+		Year  int `xml:"http://www.onvif.org/ver10/schema Year"`
+		Month int `xml:"http://www.onvif.org/ver10/schema Month"`
+		Day   int `xml:"http://www.onvif.org/ver10/schema Day"`
+	} `xml:"http://www.onvif.org/ver10/schema Date"`
+}
+
+// SetTimeZone a POSIX time zone in the schema namespace, as required by SetSystemDateAndTime
+type SetTimeZone struct {
+	TZ string `xml:"http://www.onvif.org/ver10/schema TZ"`
+}
+
+// SetSystemDateAndTime set the device clock, manually or by NTP
+type SetSystemDateAndTime struct {
+	XMLName         xml.Name     `xml:"http://www.onvif.org/ver10/device/wsdl SetSystemDateAndTime"`
+	DateTimeType    string       `xml:"DateTimeType"`
+	DaylightSavings bool         `xml:"DaylightSavings"`
+	TimeZone        *SetTimeZone `xml:"TimeZone,omitempty"`
+	UTCDateTime     *SetDateTime `xml:"UTCDateTime,omitempty"`
+}
+
+// SetHostname set the device hostname
+type SetHostname struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SetHostname"`
+	Name    string   `xml:"Name"`
+}
+
+// SystemReboot request a device reboot
+type SystemReboot struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SystemReboot"`
+}
+
+// SystemRebootResponse soap message response
+type SystemRebootResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		SystemRebootResponse struct {
+			Message string `xml:"Message"`
+		} `xml:"SystemRebootResponse"`
+	} `xml:"Body"`
+}
+
+// GetSystemLog request the system or access log
+type GetSystemLog struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetSystemLog"`
+	LogType string   `xml:"LogType"`
+}
+
+// GetSystemLogResponse soap message response
+type GetSystemLogResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetSystemLogResponse struct {
+			SystemLog struct {
+				Binary *struct{} `xml:"Binary"`
+				String string    `xml:"String"`
+			} `xml:"SystemLog"`
+		} `xml:"GetSystemLogResponse"`
+	} `xml:"Body"`
+}
+
+// GetNTP request the NTP servers
+type GetNTP struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetNTP"`
+}
+
+// GetNTPResponse soap message response
+type GetNTPResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetNTPResponse struct {
+			NTPInformation struct {
+				FromDHCP    bool          `xml:"FromDHCP"`
+				NTPFromDHCP []NetworkHost `xml:"NTPFromDHCP"`
+				NTPManual   []NetworkHost `xml:"NTPManual"`
+			} `xml:"NTPInformation"`
+		} `xml:"GetNTPResponse"`
+	} `xml:"Body"`
+}
+
+// VideoResolution a video resolution, in pixels
+type VideoResolution struct {
+	Width  int `xml:"http://www.onvif.org/ver10/schema Width" json:"width"`
+	Height int `xml:"http://www.onvif.org/ver10/schema Height" json:"height"`
+}
+
+// VideoRateControl the frame rate and bitrate (kbps) limits of an encoder
+type VideoRateControl struct {
+	FrameRateLimit   int `xml:"http://www.onvif.org/ver10/schema FrameRateLimit" json:"frameRate"`
+	EncodingInterval int `xml:"http://www.onvif.org/ver10/schema EncodingInterval" json:"encodingInterval"`
+	BitrateLimit     int `xml:"http://www.onvif.org/ver10/schema BitrateLimit" json:"bitrate"`
+}
+
+// H264Configuration the H264 settings of an encoder
+type H264Configuration struct {
+	GovLength   int    `xml:"http://www.onvif.org/ver10/schema GovLength" json:"govLength"`
+	H264Profile string `xml:"http://www.onvif.org/ver10/schema H264Profile" json:"profile"`
+}
+
+// MulticastConfiguration the multicast streaming settings of an encoder
+type MulticastConfiguration struct {
+	Address   NetworkHost `xml:"http://www.onvif.org/ver10/schema Address" json:"address"`
+	Port      int         `xml:"http://www.onvif.org/ver10/schema Port" json:"port"`
+	TTL       int         `xml:"http://www.onvif.org/ver10/schema TTL" json:"ttl"`
+	AutoStart bool        `xml:"http://www.onvif.org/ver10/schema AutoStart" json:"autoStart"`
+}
+
+// VideoEncoderConfiguration a video encoder configuration of the media service
+type VideoEncoderConfiguration struct {
+	Token          string                 `xml:"token,attr" json:"token"`
+	Name           string                 `xml:"http://www.onvif.org/ver10/schema Name" json:"name"`
+	UseCount       int                    `xml:"http://www.onvif.org/ver10/schema UseCount" json:"useCount"`
+	Encoding       string                 `xml:"http://www.onvif.org/ver10/schema Encoding" json:"encoding"`
+	Resolution     VideoResolution        `xml:"http://www.onvif.org/ver10/schema Resolution" json:"resolution"`
+	Quality        float64                `xml:"http://www.onvif.org/ver10/schema Quality" json:"quality"`
+	RateControl    *VideoRateControl      `xml:"http://www.onvif.org/ver10/schema RateControl,omitempty" json:"rateControl,omitempty"`
+	H264           *H264Configuration     `xml:"http://www.onvif.org/ver10/schema H264,omitempty" json:"h264,omitempty"`
+	Multicast      MulticastConfiguration `xml:"http://www.onvif.org/ver10/schema Multicast" json:"multicast"`
+	SessionTimeout string                 `xml:"http://www.onvif.org/ver10/schema SessionTimeout" json:"sessionTimeout"`
+}
+
+// GetVideoEncoderConfigurations request the video encoder configurations
+type GetVideoEncoderConfigurations struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetVideoEncoderConfigurations"`
+}
+
+// GetVideoEncoderConfigurationsResponse soap message response
+type GetVideoEncoderConfigurationsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetVideoEncoderConfigurationsResponse struct {
+			Configurations []VideoEncoderConfiguration `xml:"Configurations"`
+		} `xml:"GetVideoEncoderConfigurationsResponse"`
+	} `xml:"Body"`
+}
+
+// SetVideoEncoderConfiguration change a video encoder configuration
+type SetVideoEncoderConfiguration struct {
+	XMLName          xml.Name                  `xml:"http://www.onvif.org/ver10/media/wsdl SetVideoEncoderConfiguration"`
+	Configuration    VideoEncoderConfiguration `xml:"Configuration"`
+	ForcePersistence bool                      `xml:"ForcePersistence"`
+}
+
+// AudioEncoderConfiguration an audio encoder configuration of the media
+// service, bitrate in kbps and sample rate in kHz
+type AudioEncoderConfiguration struct {
+	Token          string                 `xml:"token,attr" json:"token"`
+	Name           string                 `xml:"http://www.onvif.org/ver10/schema Name" json:"name"`
+	UseCount       int                    `xml:"http://www.onvif.org/ver10/schema UseCount" json:"useCount"`
+	Encoding       string                 `xml:"http://www.onvif.org/ver10/schema Encoding" json:"encoding"`
+	Bitrate        int                    `xml:"http://www.onvif.org/ver10/schema Bitrate" json:"bitrate"`
+	SampleRate     int                    `xml:"http://www.onvif.org/ver10/schema SampleRate" json:"sampleRate"`
+	Multicast      MulticastConfiguration `xml:"http://www.onvif.org/ver10/schema Multicast" json:"multicast"`
+	SessionTimeout string                 `xml:"http://www.onvif.org/ver10/schema SessionTimeout" json:"sessionTimeout"`
+}
+
+// GetAudioEncoderConfigurations request the audio encoder configurations
+type GetAudioEncoderConfigurations struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetAudioEncoderConfigurations"`
+}
+
+// GetAudioEncoderConfigurationsResponse soap message response
+type GetAudioEncoderConfigurationsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetAudioEncoderConfigurationsResponse struct {
+			Configurations []AudioEncoderConfiguration `xml:"Configurations"`
+		} `xml:"GetAudioEncoderConfigurationsResponse"`
+	} `xml:"Body"`
+}
+
+// SetAudioEncoderConfiguration change an audio encoder configuration
+type SetAudioEncoderConfiguration struct {
+	XMLName          xml.Name                  `xml:"http://www.onvif.org/ver10/media/wsdl SetAudioEncoderConfiguration"`
+	Configuration    AudioEncoderConfiguration `xml:"Configuration"`
+	ForcePersistence bool                      `xml:"ForcePersistence"`
+}
+
+// AddVideoEncoderConfiguration bind a video encoder configuration to a profile
+type AddVideoEncoderConfiguration struct {
+	XMLName            xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl AddVideoEncoderConfiguration"`
+	ProfileToken       string   `xml:"ProfileToken"`
+	ConfigurationToken string   `xml:"ConfigurationToken"`
+}
+
+// AddAudioEncoderConfiguration bind an audio encoder configuration to a profile
+type AddAudioEncoderConfiguration struct {
+	XMLName            xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl AddAudioEncoderConfiguration"`
+	ProfileToken       string   `xml:"ProfileToken"`
+	ConfigurationToken string   `xml:"ConfigurationToken"`
+}
+
+// IntRange the allowed range of an integer setting
+type IntRange struct {
+	Min int `xml:"http://www.onvif.org/ver10/schema Min" json:"min"`
+	Max int `xml:"http://www.onvif.org/ver10/schema Max" json:"max"`
+}
+
+// CodecOptions the allowed settings of an encoding, GovLengthRange and
+// H264ProfilesSupported being set for H264 only
+type CodecOptions struct {
+	ResolutionsAvailable  []VideoResolution `xml:"http://www.onvif.org/ver10/schema ResolutionsAvailable"`
+	GovLengthRange        *IntRange         `xml:"http://www.onvif.org/ver10/schema GovLengthRange"`
+	FrameRateRange        IntRange          `xml:"http://www.onvif.org/ver10/schema FrameRateRange"`
+	EncodingIntervalRange IntRange          `xml:"http://www.onvif.org/ver10/schema EncodingIntervalRange"`
+	H264ProfilesSupported []string          `xml:"http://www.onvif.org/ver10/schema H264ProfilesSupported"`
+}
+
+// GetVideoEncoderConfigurationOptions request the allowed settings of a
+// video encoder configuration, as used by a profile if set
+type GetVideoEncoderConfigurationOptions struct {
+	XMLName            xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetVideoEncoderConfigurationOptions"`
+	ConfigurationToken string   `xml:"ConfigurationToken,omitempty"`
+	ProfileToken       string   `xml:"ProfileToken,omitempty"`
+}
+
+// GetVideoEncoderConfigurationOptionsResponse soap message response
+type GetVideoEncoderConfigurationOptionsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetVideoEncoderConfigurationOptionsResponse struct {
+			Options struct {
+				QualityRange IntRange      `xml:"http://www.onvif.org/ver10/schema QualityRange"`
+				JPEG         *CodecOptions `xml:"http://www.onvif.org/ver10/schema JPEG"`
+				MPEG4        *CodecOptions `xml:"http://www.onvif.org/ver10/schema MPEG4"`
+				H264         *CodecOptions `xml:"http://www.onvif.org/ver10/schema H264"`
+				// Extension holds the bitrate ranges, in kbps
+				Extension *struct {
+					JPEG *struct {
+						BitrateRange *IntRange `xml:"http://www.onvif.org/ver10/schema BitrateRange"`
+					} `xml:"http://www.onvif.org/ver10/schema JPEG"`
+					MPEG4 *struct {
+						BitrateRange *IntRange `xml:"http://www.onvif.org/ver10/schema BitrateRange"`
+					} `xml:"http://www.onvif.org/ver10/schema MPEG4"`
+					H264 *struct {
+						BitrateRange *IntRange `xml:"http://www.onvif.org/ver10/schema BitrateRange"`
+					} `xml:"http://www.onvif.org/ver10/schema H264"`
+				} `xml:"http://www.onvif.org/ver10/schema Extension"`
+			} `xml:"Options"`
+		} `xml:"GetVideoEncoderConfigurationOptionsResponse"`
+	} `xml:"Body"`
+}
+
+// GetRecordingSummary request the time range of all the recordings
+type GetRecordingSummary struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/search/wsdl GetRecordingSummary"`
+}
+
+// GetRecordingSummaryResponse soap message response
+type GetRecordingSummaryResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetRecordingSummaryResponse struct {
+			Summary struct {
+				DataFrom         string `xml:"DataFrom"`
+				DataUntil        string `xml:"DataUntil"`
+				NumberRecordings int    `xml:"NumberRecordings"`
+			} `xml:"Summary"`
+		} `xml:"GetRecordingSummaryResponse"`
+	} `xml:"Body"`
+}
+
+// FindRecordings start a search of the recordings, all of them with an empty scope
+type FindRecordings struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/search/wsdl FindRecordings"`
+	Scope   struct {
+		IncludedRecordings []string `xml:"http://www.onvif.org/ver10/schema IncludedRecordings,omitempty"`
+	} `xml:"Scope"`
+	MaxMatches    int    `xml:"MaxMatches,omitempty"`
+	KeepAliveTime string `xml:"KeepAliveTime"`
+}
+
+// FindRecordingsResponse soap message response
+type FindRecordingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		FindRecordingsResponse struct {
+			SearchToken string `xml:"SearchToken"`
+		} `xml:"FindRecordingsResponse"`
+	} `xml:"Body"`
+}
+
+// GetRecordingSearchResults request the results of a search, waiting up to
+// WaitTime for MinResults
+type GetRecordingSearchResults struct {
+	XMLName     xml.Name `xml:"http://www.onvif.org/ver10/search/wsdl GetRecordingSearchResults"`
+	SearchToken string   `xml:"SearchToken"`
+	MinResults  int      `xml:"MinResults,omitempty"`
+	MaxResults  int      `xml:"MaxResults,omitempty"`
+	WaitTime    string   `xml:"WaitTime,omitempty"`
+}
+
+// RecordingInformation a recording found by a search
+type RecordingInformation struct {
+	RecordingToken string `xml:"RecordingToken"`
+	Source         struct {
+		SourceID    string `xml:"SourceId"`
+		Name        string `xml:"Name"`
+		Location    string `xml:"Location"`
+		Description string `xml:"Description"`
+		Address     string `xml:"Address"`
+	} `xml:"Source"`
+	EarliestRecording string `xml:"EarliestRecording"`
+	LatestRecording   string `xml:"LatestRecording"`
+	Content           string `xml:"Content"`
+	Track             []struct {
+		TrackToken  string `xml:"TrackToken"`
+		TrackType   string `xml:"TrackType"`
+		Description string `xml:"Description"`
+		DataFrom    string `xml:"DataFrom"`
+		DataTo      string `xml:"DataTo"`
+	} `xml:"Track"`
+	RecordingStatus string `xml:"RecordingStatus"`
+}
+
+// GetRecordingSearchResultsResponse soap message response
+type GetRecordingSearchResultsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetRecordingSearchResultsResponse struct {
+			ResultList struct {
+				// SearchState is Queued, Searching, Completed or Unknown
+				SearchState          string                 `xml:"SearchState"`
+				RecordingInformation []RecordingInformation `xml:"RecordingInformation"`
+			} `xml:"ResultList"`
+		} `xml:"GetRecordingSearchResultsResponse"`
+	} `xml:"Body"`
+}
+
+// EndSearch release a search
+type EndSearch struct {
+	XMLName     xml.Name `xml:"http://www.onvif.org/ver10/search/wsdl EndSearch"`
+	SearchToken string   `xml:"SearchToken"`
+}
+
+// GetReplayUri request the RTSP URI replaying a recording
+type GetReplayUri struct {
+	XMLName        xml.Name    `xml:"http://www.onvif.org/ver10/replay/wsdl GetReplayUri"`
+	StreamSetup    StreamSetup `xml:"StreamSetup"`
+	RecordingToken string      `xml:"RecordingToken"`
+}
+
+// GetReplayUriResponse soap message response
+type GetReplayUriResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetReplayUriResponse struct {
+			Uri string `xml:"Uri"`
+		} `xml:"GetReplayUriResponse"`
+	} `xml:"Body"`
+}
+
+// RelayOutputProperties the behavior of a relay output
+type RelayOutputProperties struct {
+	// Mode is Monostable (back to idle after DelayTime) or Bistable
+	Mode      string `xml:"http://www.onvif.org/ver10/schema Mode"`
+	DelayTime string `xml:"http://www.onvif.org/ver10/schema DelayTime"`
+	// IdleState is the physical state of the inactive relay, open or closed
+	IdleState string `xml:"http://www.onvif.org/ver10/schema IdleState"`
+}
+
+// RelayOutput a relay output of the device
+type RelayOutput struct {
+	Token      string                `xml:"token,attr"`
+	Properties RelayOutputProperties `xml:"Properties"`
+}
+
+// GetRelayOutputs request the relay outputs, from the DeviceIO service
+type GetRelayOutputs struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/deviceIO/wsdl GetRelayOutputs"`
+}
+
+// GetDeviceRelayOutputs request the relay outputs, from the device service
+type GetDeviceRelayOutputs struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl GetRelayOutputs"`
+}
+
+// GetRelayOutputsResponse soap message response, from either service
+type GetRelayOutputsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetRelayOutputsResponse struct {
+			RelayOutputs []RelayOutput `xml:"RelayOutputs"`
+		} `xml:"GetRelayOutputsResponse"`
+	} `xml:"Body"`
+}
+
+// SetRelayOutputState activate or deactivate a relay, from the DeviceIO service
+type SetRelayOutputState struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver10/deviceIO/wsdl SetRelayOutputState"`
+	RelayOutputToken string   `xml:"RelayOutputToken"`
+	// LogicalState is active or inactive
+	LogicalState string `xml:"LogicalState"`
+}
+
+// SetDeviceRelayOutputState activate or deactivate a relay, from the device service
+type SetDeviceRelayOutputState struct {
+	XMLName          xml.Name `xml:"http://www.onvif.org/ver10/device/wsdl SetRelayOutputState"`
+	RelayOutputToken string   `xml:"RelayOutputToken"`
+	LogicalState     string   `xml:"LogicalState"`
+}
+
+// GetDigitalInputs request the digital inputs
+type GetDigitalInputs struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/deviceIO/wsdl GetDigitalInputs"`
+}
+
+// GetDigitalInputsResponse soap message response
+type GetDigitalInputsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetDigitalInputsResponse struct {
+			DigitalInputs []struct {
+				Token string `xml:"token,attr"`
+				// IdleState is closed or open
+				IdleState string `xml:"IdleState,attr"`
+			} `xml:"DigitalInputs"`
+		} `xml:"GetDigitalInputsResponse"`
+	} `xml:"Body"`
+}
+
+// GetVideoSources request the video sources, eg. the channels of an NVR
+type GetVideoSources struct {
+	XMLName xml.Name `xml:"http://www.onvif.org/ver10/media/wsdl GetVideoSources"`
+}
+
+// GetVideoSourcesResponse soap message response
+type GetVideoSourcesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetVideoSourcesResponse struct {
+			VideoSources []struct {
+				Token      string          `xml:"token,attr"`
+				Framerate  float64         `xml:"Framerate"`
+				Resolution VideoResolution `xml:"Resolution"`
+			} `xml:"VideoSources"`
+		} `xml:"GetVideoSourcesResponse"`
+	} `xml:"Body"`
+}
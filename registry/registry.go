@@ -0,0 +1,261 @@
+package registry
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/muka/camd/device"
+)
+
+const (
+	// SourceVideo is the source of the local video4linux devices
+	SourceVideo = "video"
+	// SourceONVIF is the source of the devices discovered on the network
+	SourceONVIF = "onvif"
+)
+
+// Entry a device currently known to the registry
+type Entry struct {
+	Device device.Device
+	// Source is the discovery source reporting the device, eg. onvif
+	Source string
+	// FirstSeen is when the device was added, LastSeen when it was last
+	// added, updated or published an event
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// New init an empty registry
+func New() *Registry {
+	return &Registry{
+		entries:     map[string]*Entry{},
+		subscribers: map[int]*subscriber{},
+	}
+}
+
+// Registry hold the devices reported by all the discovery sources, and
+// forward their events to the subscribers, in order
+type Registry struct {
+	mut         sync.Mutex
+	entries     map[string]*Entry
+	subscribers map[int]*subscriber
+	nextID      int
+	store       *Store
+	// publish serializes the updates and their queueing to the subscribers
+	publish sync.Mutex
+}
+
+// subscriberQueue is the number of events queued for a subscriber, dropped
+// once full so that a lagging subscriber does not block the sources
+const subscriberQueue = 256
+
+type subscriber struct {
+	queue  chan device.OnChangeEvent
+	events chan device.OnChangeEvent
+	done   chan struct{}
+}
+
+// Persist save the entries in store on each change of a device. The events
+// published by the devices are not persisted.
+func (r *Registry) Persist(store *Store) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.store = store
+}
+
+// Input return a channel receiving the events of a discovery source, applied
+// until ctx is done. The events sent afterwards are discarded until the
+// channel is closed, so that the sources do not block on shutdown.
+func (r *Registry) Input(ctx context.Context, source string) chan device.OnChangeEvent {
+
+	input := make(chan device.OnChangeEvent)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				for range input {
+				}
+				return
+			case ev, ok := <-input:
+				if !ok {
+					return
+				}
+				r.Update(source, ev)
+			}
+		}
+	}()
+
+	return input
+}
+
+// Update apply an event of a source to the registry, queueing it to the
+// subscribers. The removals of unknown devices are dropped, while their
+// events are forwarded, eg. a certificate alert of a device failing to
+// resolve.
+func (r *Registry) Update(source string, ev device.OnChangeEvent) {
+
+	r.publish.Lock()
+	defer r.publish.Unlock()
+
+	if !r.apply(source, ev, time.Now()) {
+		return
+	}
+
+	if ev.Event != device.DeviceEvent {
+		r.save()
+	}
+
+	r.mut.Lock()
+	subscribers := make([]*subscriber, 0, len(r.subscribers))
+	for _, sub := range r.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	r.mut.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub.queue <- ev:
+		default:
+			log.Printf("Registry subscriber lagging, dropped event of %s\n", ev.Device.UUID)
+		}
+	}
+}
+
+// apply update the entry of the event device, returning false if the event
+// must be dropped
+func (r *Registry) apply(source string, ev device.OnChangeEvent, now time.Time) bool {
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	entry, ok := r.entries[ev.Device.UUID]
+
+	switch ev.Event {
+	case device.DeviceRemoved:
+		if !ok {
+			return false
+		}
+		delete(r.entries, ev.Device.UUID)
+	case device.DeviceEvent:
+		if ok {
+			entry.LastSeen = now
+		}
+	default:
+		if !ok {
+			entry = &Entry{FirstSeen: now}
+			r.entries[ev.Device.UUID] = entry
+		}
+		entry.Device = ev.Device
+		entry.Source = source
+		entry.LastSeen = now
+	}
+
+	return true
+}
+
+// save write the entries to the store, if any
+func (r *Registry) save() {
+
+	r.mut.Lock()
+	store := r.store
+	r.mut.Unlock()
+
+	if store == nil {
+		return
+	}
+
+	if err := store.Save(r.List(nil)); err != nil {
+		log.Printf("Registry store error: %s\n", err)
+	}
+}
+
+// Subscribe return a channel receiving the events applied to the registry,
+// closed once ctx is done. Events are delivered in order, queued up to
+// subscriberQueue events while the subscriber is busy and dropped beyond.
+func (r *Registry) Subscribe(ctx context.Context) <-chan device.OnChangeEvent {
+
+	sub := &subscriber{
+		queue:  make(chan device.OnChangeEvent, subscriberQueue),
+		events: make(chan device.OnChangeEvent),
+		done:   make(chan struct{}),
+	}
+
+	r.mut.Lock()
+	id := r.nextID
+	r.nextID++
+	r.subscribers[id] = sub
+	r.mut.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mut.Lock()
+		delete(r.subscribers, id)
+		r.mut.Unlock()
+		close(sub.done)
+	}()
+
+	go sub.deliver()
+
+	return sub.events
+}
+
+// deliver forward the queued events to the subscriber, closing its channel
+// once done
+func (sub *subscriber) deliver() {
+	defer close(sub.events)
+	for {
+		select {
+		case <-sub.done:
+			return
+		case ev := <-sub.queue:
+			select {
+			case sub.events <- ev:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
+
+// Get return the entry of a device by UUID
+func (r *Registry) Get(uuid string) (Entry, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	entry, ok := r.entries[uuid]
+	if !ok {
+		return Entry{}, false
+	}
+	return *entry, true
+}
+
+// List return the entries matching filter, all if nil, sorted by UUID
+func (r *Registry) List(filter func(Entry) bool) []Entry {
+
+	r.mut.Lock()
+	entries := []Entry{}
+	for _, entry := range r.entries {
+		if filter == nil || filter(*entry) {
+			entries = append(entries, *entry)
+		}
+	}
+	r.mut.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Device.UUID < entries[j].Device.UUID
+	})
+
+	return entries
+}
+
+// Devices return the devices currently known, sorted by UUID
+func (r *Registry) Devices() []device.Device {
+	devices := []device.Device{}
+	for _, entry := range r.List(nil) {
+		devices = append(devices, entry.Device)
+	}
+	return devices
+}
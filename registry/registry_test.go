@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/muka/camd/device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := New()
+	events := r.Subscribe(ctx)
+	onvif := r.Input(ctx, SourceONVIF)
+	video := r.Input(ctx, SourceVideo)
+
+	received := func() device.OnChangeEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("No event received")
+		}
+		return device.OnChangeEvent{}
+	}
+
+	camera := device.Device{UUID: "urn:uuid:camera", Name: "Camera"}
+	onvif <- device.OnChanged(camera, device.DeviceAdded)
+	assert.Equal(t, device.DeviceAdded, received().Event)
+
+	video <- device.OnChanged(device.Device{UUID: "webcam", Path: "/dev/video0"}, device.DeviceAdded)
+	assert.Equal(t, "webcam", received().Device.UUID)
+
+	added, ok := r.Get(camera.UUID)
+	assert.True(t, ok)
+	assert.Equal(t, SourceONVIF, added.Source)
+	assert.Equal(t, added.FirstSeen, added.LastSeen)
+
+	camera.Name = "Renamed"
+	onvif <- device.OnChanged(camera, device.DeviceUpdated)
+	assert.Equal(t, "Renamed", received().Device.Name)
+
+	updated, _ := r.Get(camera.UUID)
+	assert.Equal(t, "Renamed", updated.Device.Name)
+	assert.Equal(t, added.FirstSeen, updated.FirstSeen)
+	assert.False(t, updated.LastSeen.Before(added.LastSeen))
+
+	assert.Len(t, r.Devices(), 2)
+	webcams := r.List(func(entry Entry) bool { return entry.Source == SourceVideo })
+	if assert.Len(t, webcams, 1) {
+		assert.Equal(t, "/dev/video0", webcams[0].Device.Path)
+	}
+
+	// removals of unknown devices are dropped
+	onvif <- device.OnChanged(device.Device{UUID: "urn:uuid:unknown"}, device.DeviceRemoved)
+	onvif <- device.OnChanged(camera, device.DeviceRemoved)
+	ev := received()
+	assert.Equal(t, device.DeviceRemoved, ev.Event)
+	assert.Equal(t, camera.UUID, ev.Device.UUID)
+
+	_, ok = r.Get(camera.UUID)
+	assert.False(t, ok)
+	assert.Len(t, r.Devices(), 1)
+
+	cancel()
+	_, open := <-events
+	assert.False(t, open)
+}
+
+func TestStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "registry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "devices.json"))
+	entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	r := New()
+	r.Persist(store)
+
+	camera := device.Device{UUID: "urn:uuid:camera", Name: "Camera"}
+	r.Update(SourceONVIF, device.OnChanged(camera, device.DeviceAdded))
+	r.Update(SourceVideo, device.OnChanged(device.Device{UUID: "webcam"}, device.DeviceAdded))
+
+	entries, err = store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	r.Update(SourceONVIF, device.OnChanged(camera, device.DeviceRemoved))
+
+	entries, err = store.Load()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "webcam", entries[0].Device.UUID)
+		assert.Equal(t, SourceVideo, entries[0].Source)
+	}
+
+	// the events published by the devices are not persisted
+	r.Update(SourceONVIF, device.OnChanged(camera, device.DeviceAdded))
+	stored, _ := store.Load()
+	r.Update(SourceONVIF, device.OnChanged(camera, device.DeviceEvent))
+	entries, _ = store.Load()
+	assert.ElementsMatch(t, stored, entries)
+}
+
+func TestLaggingSubscriber(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := New()
+	// a subscriber never receiving does not block the updates
+	lagging := r.Subscribe(ctx)
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberQueue+10; i++ {
+			r.Update(SourceONVIF, device.OnChanged(device.Device{UUID: fmt.Sprintf("urn:uuid:%d", i)}, device.DeviceAdded))
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Updates blocked by a lagging subscriber")
+	}
+
+	// the queued events are delivered in order, the overflow dropped
+	ev := <-lagging
+	assert.Equal(t, "urn:uuid:0", ev.Device.UUID)
+	assert.Equal(t, subscriberQueue+10, len(r.Devices()))
+
+	// the sources do not block once ctx is done
+	input := r.Input(ctx, SourceONVIF)
+	cancel()
+	select {
+	case input <- device.OnChanged(device.Device{UUID: "urn:uuid:late"}, device.DeviceAdded):
+	case <-time.After(time.Second):
+		t.Fatal("Source blocked on shutdown")
+	}
+	select {
+	case input <- device.OnChanged(device.Device{UUID: "urn:uuid:late"}, device.DeviceRemoved):
+	case <-time.After(time.Second):
+		t.Fatal("Source blocked on shutdown")
+	}
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// NewStore init a store persisting the registry entries in a JSON file
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Store persist the state of a registry, so that the commands run outside the
+// discover process can address the devices by UUID or name, reusing their
+// service endpoints without waiting for a discovery
+type Store struct {
+	path string
+	mut  sync.Mutex
+}
+
+// Load return the stored entries, none if the file does not exist yet
+func (s *Store) Load() ([]Entry, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]Entry{}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, entry := range stored {
+		// skip the devices written in the format preceding the registry
+		if entry.Device.UUID == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Save replace the stored entries
+func (s *Store) Save(entries []Entry) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	stored := map[string]Entry{}
+	for _, entry := range entries {
+		stored[entry.Device.UUID] = entry
+	}
+
+	b, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
@@ -15,12 +15,11 @@ import (
 
 var v4lPath = "/sys/class/video4linux/"
 
-var cachedDevices = map[string]device.Device{}
-
 // WatchDevices watch local video devices for changes
 func WatchDevices(emitter chan device.OnChangeEvent) error {
 
 	ticker := time.NewTicker(500 * time.Millisecond)
+	cachedDevices := map[string]device.Device{}
 
 	go func() {
 		for {